@@ -0,0 +1,239 @@
+// Package balancer spreads the requests of an endpoint over its upstream servers.
+package balancer
+
+import (
+	"cmp"
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bastienwirtz/corsair/breaker"
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/health"
+)
+
+// Target is an upstream server requests can be sent to.
+type Target struct {
+	URL     *url.URL
+	Weight  int
+	Health  *health.Target   // nil when the target is not health checked
+	Breaker *breaker.Breaker // nil without circuit breaker
+	active  atomic.Int64
+}
+
+// NewTarget creates a target at rawURL with the given weight, at least 1.
+func NewTarget(rawURL string, weight int) (*Target, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Target{URL: target, Weight: max(weight, 1)}, nil
+}
+
+// Healthy reports whether the target passes its health checks.
+func (t *Target) Healthy() bool {
+	return t.Health == nil || t.Health.Healthy()
+}
+
+// Available reports whether the target may receive traffic: it is healthy
+// and its circuit breaker lets requests through.
+func (t *Target) Available() bool {
+	return t.Healthy() && t.Breaker.Ready()
+}
+
+// Acquire counts a request in flight to the target until release is called.
+func (t *Target) Acquire() (release func()) {
+	t.active.Add(1)
+	return func() { t.active.Add(-1) }
+}
+
+// Active returns the number of requests in flight to the target.
+func (t *Target) Active() int64 {
+	return t.active.Load()
+}
+
+// Balancer selects the target of a request.
+type Balancer interface {
+	// Next returns the target r is sent to, or nil when no target is available.
+	Next(r *http.Request) *Target
+}
+
+// New creates the balancer of targets using the configured strategy.
+func New(cfg config.LoadBalancingConfig, targets []*Target) Balancer {
+	switch cfg.GetStrategy() {
+	case config.LB_WEIGHTED:
+		return &weighted{targets: targets}
+	case config.LB_LEAST_CONNECTIONS:
+		return &leastConnections{targets: targets}
+	case config.LB_CONSISTENT_HASH:
+		return newConsistentHash(cfg, targets)
+	}
+	return &roundRobin{targets: targets, current: make([]int, len(targets))}
+}
+
+// roundRobin cycles through available targets, using the smooth weighted
+// round-robin of nginx so heavier targets are not picked in bursts.
+type roundRobin struct {
+	mu      sync.Mutex
+	targets []*Target
+	current []int
+}
+
+func (b *roundRobin) Next(*http.Request) *Target {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best, total := -1, 0
+	for i, t := range b.targets {
+		if !t.Available() {
+			continue
+		}
+		b.current[i] += t.Weight
+		total += t.Weight
+		if best == -1 || b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	if best == -1 {
+		return nil
+	}
+	b.current[best] -= total
+	return b.targets[best]
+}
+
+// weighted picks a random available target with a probability proportional to
+// its weight.
+type weighted struct {
+	targets []*Target
+}
+
+func (b *weighted) Next(*http.Request) *Target {
+	total := 0
+	for _, t := range b.targets {
+		if t.Available() {
+			total += t.Weight
+		}
+	}
+	if total == 0 {
+		return nil
+	}
+	n := rand.IntN(total)
+	for _, t := range b.targets {
+		if !t.Available() {
+			continue
+		}
+		if n < t.Weight {
+			return t
+		}
+		n -= t.Weight
+	}
+	return nil
+}
+
+// leastConnections picks the available target with the fewest requests in
+// flight relative to its weight. Ties are broken in turn.
+type leastConnections struct {
+	targets []*Target
+	next    atomic.Uint64
+}
+
+func (b *leastConnections) Next(*http.Request) *Target {
+	var best *Target
+	offset := int(b.next.Add(1) % uint64(max(len(b.targets), 1)))
+	for i := range b.targets {
+		t := b.targets[(offset+i)%len(b.targets)]
+		if !t.Available() {
+			continue
+		}
+		// active/weight < best.active/best.weight, without divisions
+		if best == nil || t.Active()*int64(best.Weight) < best.Active()*int64(t.Weight) {
+			best = t
+		}
+	}
+	return best
+}
+
+// virtualNodes is the number of points a target of weight 1 has on the hash
+// ring. More points spread keys more evenly.
+const virtualNodes = 100
+
+// consistentHash maps requests to targets on a hash ring, so requests with the
+// same key reach the same target and only the keys of a removed target move.
+type consistentHash struct {
+	header string
+	cookie string
+	ring   []ringPoint // sorted by hash
+}
+
+type ringPoint struct {
+	hash   uint64
+	target *Target
+}
+
+func newConsistentHash(cfg config.LoadBalancingConfig, targets []*Target) *consistentHash {
+	b := &consistentHash{header: cfg.HashHeader, cookie: cfg.HashCookie}
+	for _, t := range targets {
+		for i := range virtualNodes * t.Weight {
+			b.ring = append(b.ring, ringPoint{hash: hashKey(t.URL.String() + "#" + strconv.Itoa(i)), target: t})
+		}
+	}
+	slices.SortFunc(b.ring, func(a, b ringPoint) int { return cmp.Compare(a.hash, b.hash) })
+	return b
+}
+
+func (b *consistentHash) Next(r *http.Request) *Target {
+	if len(b.ring) == 0 {
+		return nil
+	}
+	hash := hashKey(b.key(r))
+	start, _ := slices.BinarySearchFunc(b.ring, hash, func(p ringPoint, hash uint64) int { return cmp.Compare(p.hash, hash) })
+	// Walk the ring past unavailable targets
+	for i := range b.ring {
+		if t := b.ring[(start+i)%len(b.ring)].target; t.Available() {
+			return t
+		}
+	}
+	return nil
+}
+
+// key returns the value requests are hashed on. Requests without the
+// configured header or cookie are hashed on the client IP.
+func (b *consistentHash) key(r *http.Request) string {
+	if b.header != "" {
+		if value := r.Header.Get(b.header); value != "" {
+			return value
+		}
+	}
+	if b.cookie != "" {
+		if cookie, err := r.Cookie(b.cookie); err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hashKey hashes key deterministically, so corsair instances sharing a
+// configuration agree on the target of a key.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	// FNV barely mixes the high bits of short keys, finish with the
+	// murmur3 finalizer to spread them over the ring
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,200 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/health"
+)
+
+func newTargets(t *testing.T, weights ...int) []*Target {
+	t.Helper()
+	targets := make([]*Target, len(weights))
+	for i, weight := range weights {
+		target, err := NewTarget("http://backend-"+string(rune('a'+i))+".example.com", weight)
+		require.NoError(t, err)
+		targets[i] = target
+	}
+	return targets
+}
+
+// distribution sends n requests through b and counts them by target host.
+func distribution(b Balancer, n int, request func(i int) *http.Request) map[string]int {
+	counts := make(map[string]int)
+	for i := range n {
+		if target := b.Next(request(i)); target != nil {
+			counts[target.URL.Host]++
+		}
+	}
+	return counts
+}
+
+func anyRequest(int) *http.Request {
+	return httptest.NewRequest("GET", "/", nil)
+}
+
+func TestRoundRobin(t *testing.T) {
+	b := New(config.LoadBalancingConfig{}, newTargets(t, 1, 1, 1))
+
+	var order []string
+	for range 6 {
+		order = append(order, b.Next(anyRequest(0)).URL.Host)
+	}
+	assert.Equal(t, order[:3], order[3:], "targets are picked in turn")
+	assert.ElementsMatch(t, []string{"backend-a.example.com", "backend-b.example.com", "backend-c.example.com"}, order[:3])
+}
+
+func TestRoundRobinWeights(t *testing.T) {
+	b := New(config.LoadBalancingConfig{Strategy: config.LB_ROUND_ROBIN}, newTargets(t, 3, 1))
+
+	var order []string
+	for range 4 {
+		order = append(order, b.Next(anyRequest(0)).URL.Host)
+	}
+	// Smooth weighted round-robin interleaves the lighter target
+	assert.Equal(t, []string{"backend-a.example.com", "backend-a.example.com", "backend-b.example.com", "backend-a.example.com"}, order)
+}
+
+func TestWeighted(t *testing.T) {
+	b := New(config.LoadBalancingConfig{Strategy: config.LB_WEIGHTED}, newTargets(t, 9, 1))
+
+	counts := distribution(b, 10000, anyRequest)
+	assert.InDelta(t, 9000, counts["backend-a.example.com"], 500)
+	assert.InDelta(t, 1000, counts["backend-b.example.com"], 500)
+}
+
+func TestLeastConnections(t *testing.T) {
+	targets := newTargets(t, 1, 1, 2)
+	b := New(config.LoadBalancingConfig{Strategy: config.LB_LEAST_CONNECTIONS}, targets)
+
+	releaseA := targets[0].Acquire()
+	defer releaseA()
+	targets[2].Acquire()
+
+	// b has no request in flight
+	assert.Equal(t, targets[1], b.Next(anyRequest(0)))
+
+	// c has one request for a weight of 2, less than b's one for a weight of 1
+	releaseB := targets[1].Acquire()
+	assert.Equal(t, targets[2], b.Next(anyRequest(0)))
+
+	releaseB()
+	assert.Equal(t, targets[1], b.Next(anyRequest(0)))
+}
+
+func TestConsistentHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.LoadBalancingConfig
+		request func(key string) *http.Request
+	}{
+		{
+			name: "header",
+			cfg:  config.LoadBalancingConfig{Strategy: config.LB_CONSISTENT_HASH, HashHeader: "X-User-ID"},
+			request: func(key string) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.Header.Set("X-User-ID", key)
+				return r
+			},
+		},
+		{
+			name: "cookie",
+			cfg:  config.LoadBalancingConfig{Strategy: config.LB_CONSISTENT_HASH, HashCookie: "session"},
+			request: func(key string) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.AddCookie(&http.Cookie{Name: "session", Value: key})
+				return r
+			},
+		},
+		{
+			name: "client IP",
+			cfg:  config.LoadBalancingConfig{Strategy: config.LB_CONSISTENT_HASH},
+			request: func(key string) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = "10.0.0." + key + ":1234"
+				return r
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := New(tt.cfg, newTargets(t, 1, 1, 1))
+
+			counts := make(map[string]int)
+			for i := range 100 {
+				key := string(rune('0'+i%10)) + string(rune('0'+i/10))
+				first := b.Next(tt.request(key))
+				assert.Equal(t, first, b.Next(tt.request(key)), "same key, same target")
+				counts[first.URL.Host]++
+			}
+			assert.Len(t, counts, 3, "keys are spread over all targets")
+		})
+	}
+}
+
+func TestConsistentHashStability(t *testing.T) {
+	targets := newTargets(t, 1, 1, 1, 1)
+	cfg := config.LoadBalancingConfig{Strategy: config.LB_CONSISTENT_HASH, HashHeader: "X-Key"}
+	before := New(cfg, targets)
+	after := New(cfg, targets[:3])
+
+	moved := 0
+	for i := range 1000 {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Key", time.Duration(i).String())
+		previous := before.Next(r)
+		current := after.Next(r)
+		if previous != targets[3] && previous != current {
+			moved++
+		}
+	}
+	assert.Zero(t, moved, "only keys of the removed target move")
+}
+
+func TestUnhealthyTargetsAreSkipped(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer up.Close()
+
+	checker := health.NewChecker()
+	var targets []*Target
+	for _, rawURL := range []string{down.URL, up.URL} {
+		target, err := NewTarget(rawURL, 1)
+		require.NoError(t, err)
+		target.Health, err = checker.Add("/api", rawURL, nil, config.HealthCheckConfig{Interval: "1h"}, http.DefaultTransport)
+		require.NoError(t, err)
+		targets = append(targets, target)
+	}
+	checker.Start()
+	defer checker.Stop()
+	require.Eventually(t, func() bool {
+		return targets[0].Health.State() == health.StateUnhealthy && targets[1].Health.State() == health.StateHealthy
+	}, time.Second, 5*time.Millisecond)
+
+	for _, strategy := range []string{config.LB_ROUND_ROBIN, config.LB_WEIGHTED, config.LB_LEAST_CONNECTIONS, config.LB_CONSISTENT_HASH} {
+		t.Run(strategy, func(t *testing.T) {
+			b := New(config.LoadBalancingConfig{Strategy: strategy}, targets)
+			counts := distribution(b, 50, func(i int) *http.Request {
+				r := httptest.NewRequest("GET", "/", nil)
+				r.RemoteAddr = time.Duration(i).String() + ":1234"
+				return r
+			})
+			assert.Equal(t, map[string]int{targets[1].URL.Host: 50}, counts)
+		})
+	}
+
+	t.Run("no healthy target", func(t *testing.T) {
+		b := New(config.LoadBalancingConfig{}, targets[:1])
+		assert.Nil(t, b.Next(anyRequest(0)))
+	})
+}
@@ -0,0 +1,271 @@
+// Package breaker implements circuit breakers protecting upstream servers.
+package breaker
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+// State is the state of a circuit breaker.
+type State int
+
+const (
+	// StateClosed lets requests through and counts their failures.
+	StateClosed State = iota
+	// StateOpen rejects requests until the open duration elapsed.
+	StateOpen
+	// StateHalfOpen lets a limited number of probe requests through.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half_open"
+	}
+	return "closed"
+}
+
+// OpenError is returned for requests rejected by an open circuit breaker.
+type OpenError struct {
+	Target     string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of %s is open", e.Target)
+}
+
+// Breaker is the circuit breaker of an upstream target. A nil breaker lets
+// every request through.
+type Breaker struct {
+	endpoint string
+	target   string
+	cfg      config.CircuitBreakerConfig
+	now      func() time.Time
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int // probe requests let through while half-open
+	successes   int // successful probes
+	closed      bool
+}
+
+// series counts the breakers exporting the state of each endpoint and
+// target. A reload creates the breakers of the new routes before closing the
+// previous ones, the series is only deleted once the last one is closed.
+var (
+	seriesMu sync.Mutex
+	series   = make(map[[2]string]int)
+)
+
+// New creates the closed breaker of target, a remote server of endpoint.
+func New(endpoint, target string, cfg config.CircuitBreakerConfig) *Breaker {
+	b := &Breaker{
+		endpoint: endpoint,
+		target:   target,
+		cfg:      cfg,
+		now:      time.Now,
+	}
+	b.windowStart = b.now()
+
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	series[[2]string{endpoint, target}]++
+	metrics.CircuitBreakerState.WithLabelValues(endpoint, target).Set(float64(StateClosed))
+	return b
+}
+
+// Close stops exporting the state of the breaker, once it is no longer used
+// by new requests. Requests still in flight may complete normally. A nil
+// breaker can be closed.
+func (b *Breaker) Close() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	closed := b.closed
+	b.closed = true
+	b.mu.Unlock()
+	if closed {
+		return
+	}
+
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	key := [2]string{b.endpoint, b.target}
+	if series[key]--; series[key] > 0 {
+		return
+	}
+	delete(series, key)
+	metrics.CircuitBreakerState.DeleteLabelValues(b.endpoint, b.target)
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	return b.state
+}
+
+// Ready reports whether a request would currently be let through, without
+// reserving it.
+func (b *Breaker) Ready() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		return b.probes < b.cfg.GetHalfOpenProbes()
+	}
+	return true
+}
+
+// Allow reports whether a request may be sent. Every allowed request must be
+// followed by a call to Record with its outcome, or to Cancel.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	switch b.state {
+	case StateOpen:
+		return false
+	case StateHalfOpen:
+		if b.probes >= b.cfg.GetHalfOpenProbes() {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// Record records the outcome of an allowed request.
+func (b *Breaker) Record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+
+	switch b.state {
+	case StateClosed:
+		b.requests++
+		if !success {
+			b.failures++
+		}
+		ratio := float64(b.failures) / float64(b.requests)
+		if b.requests >= b.cfg.GetMinRequests() && ratio >= b.cfg.GetFailureRatio() {
+			b.transition(StateOpen, "requests", b.requests, "failures", b.failures)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.transition(StateOpen, "probes", b.probes)
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.GetHalfOpenProbes() {
+			b.transition(StateClosed, "probes", b.successes)
+		}
+	}
+	// Outcomes of requests allowed before the breaker opened are ignored
+}
+
+// Cancel records that an allowed request ended without outcome, like a
+// request canceled by the client. It counts as neither a success nor a
+// failure, and gives back its probe slot to a half-open breaker.
+func (b *Breaker) Cancel() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	if b.state == StateHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// RetryAfter returns the time left until an open breaker lets probe requests
+// through.
+func (b *Breaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != StateOpen {
+		return 0
+	}
+	return max(b.openedAt.Add(b.cfg.GetOpenDuration()).Sub(b.now()), 0)
+}
+
+// refresh applies the transitions due to time: the end of the counting
+// window, and the end of the open duration. b.mu must be held.
+func (b *Breaker) refresh() {
+	now := b.now()
+	switch b.state {
+	case StateClosed:
+		if now.Sub(b.windowStart) >= b.cfg.GetWindow() {
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+	case StateOpen:
+		if now.Sub(b.openedAt) >= b.cfg.GetOpenDuration() {
+			b.transition(StateHalfOpen)
+		}
+	}
+}
+
+// transition changes the state of the breaker, logging and exporting it.
+// b.mu must be held.
+func (b *Breaker) transition(state State, details ...any) {
+	previous := b.state
+	b.state = state
+	now := b.now()
+	switch state {
+	case StateOpen:
+		b.openedAt = now
+	case StateHalfOpen:
+		b.probes, b.successes = 0, 0
+	case StateClosed:
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+
+	if !b.closed {
+		metrics.CircuitBreakerState.WithLabelValues(b.endpoint, b.target).Set(float64(state))
+	}
+	metrics.CircuitBreakerTransitions.WithLabelValues(b.endpoint, b.target, state.String()).Inc()
+
+	attrs := append([]any{"endpoint", b.endpoint, "target", b.target, "previous_state", previous.String()}, details...)
+	switch state {
+	case StateOpen:
+		slog.Warn("Circuit breaker opened", append(attrs, "open_duration", b.cfg.GetOpenDuration())...)
+	case StateHalfOpen:
+		slog.Info("Circuit breaker half-open, probing upstream", attrs...)
+	case StateClosed:
+		slog.Info("Circuit breaker closed", attrs...)
+	}
+}
@@ -0,0 +1,161 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+func newTestBreaker(cfg config.CircuitBreakerConfig) (*Breaker, *time.Time) {
+	now := time.Unix(1000, 0)
+	b := New("/api", "api.example.com", cfg)
+	b.now = func() time.Time { return now }
+	b.windowStart = now
+	return b, &now
+}
+
+func record(b *Breaker, successes, failures int) {
+	for range successes {
+		if b.Allow() {
+			b.Record(true)
+		}
+	}
+	for range failures {
+		if b.Allow() {
+			b.Record(false)
+		}
+	}
+}
+
+func TestBreakerOpens(t *testing.T) {
+	b, _ := newTestBreaker(config.CircuitBreakerConfig{MinRequests: 10})
+
+	record(b, 0, 9)
+	assert.Equal(t, StateClosed, b.State(), "below minimum requests")
+
+	record(b, 0, 1)
+	assert.Equal(t, StateOpen, b.State())
+	assert.False(t, b.Ready())
+	assert.False(t, b.Allow())
+	assert.Equal(t, config.DEFAULT_BREAKER_OPEN_DURATION, b.RetryAfter())
+	assert.Equal(t, float64(StateOpen), testutil.ToFloat64(metrics.CircuitBreakerState.WithLabelValues("/api", "api.example.com")))
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	ratio := 0.5
+	b, _ := newTestBreaker(config.CircuitBreakerConfig{MinRequests: 4, FailureRatio: &ratio})
+
+	record(b, 3, 2)
+	assert.Equal(t, StateClosed, b.State(), "2 failures out of 5")
+
+	record(b, 0, 1)
+	assert.Equal(t, StateOpen, b.State(), "3 failures out of 6")
+}
+
+func TestBreakerWindow(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreakerConfig{MinRequests: 4, Window: "10s"})
+
+	record(b, 0, 3)
+	*now = now.Add(10 * time.Second)
+	record(b, 0, 1)
+	assert.Equal(t, StateClosed, b.State(), "failures of the previous window are forgotten")
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreakerConfig{MinRequests: 1, OpenDuration: "30s", HalfOpenProbes: 2})
+
+	record(b, 0, 1)
+	assert.Equal(t, StateOpen, b.State())
+
+	*now = now.Add(20 * time.Second)
+	assert.Equal(t, 10*time.Second, b.RetryAfter())
+	*now = now.Add(10 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	// Only the probes are let through
+	assert.True(t, b.Allow())
+	assert.True(t, b.Allow())
+	assert.False(t, b.Ready())
+	assert.False(t, b.Allow())
+
+	b.Record(true)
+	assert.Equal(t, StateHalfOpen, b.State())
+	b.Record(true)
+	assert.Equal(t, StateClosed, b.State())
+	assert.True(t, b.Allow())
+}
+
+func TestBreakerHalfOpenFailure(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreakerConfig{MinRequests: 1, OpenDuration: "30s"})
+
+	record(b, 0, 1)
+	*now = now.Add(30 * time.Second)
+	assert.True(t, b.Allow())
+	b.Record(false)
+
+	assert.Equal(t, StateOpen, b.State())
+	assert.Equal(t, 30*time.Second, b.RetryAfter(), "the open duration starts over")
+}
+
+func TestBreakerCancel(t *testing.T) {
+	b, now := newTestBreaker(config.CircuitBreakerConfig{MinRequests: 2, OpenDuration: "30s"})
+
+	// Canceled requests are not counted
+	for range 3 {
+		if b.Allow() {
+			b.Cancel()
+		}
+	}
+	record(b, 0, 1)
+	assert.Equal(t, StateClosed, b.State())
+	record(b, 0, 1)
+	assert.Equal(t, StateOpen, b.State())
+
+	// A canceled probe neither closes the breaker nor blocks the next probe
+	*now = now.Add(30 * time.Second)
+	assert.True(t, b.Allow())
+	b.Cancel()
+	assert.Equal(t, StateHalfOpen, b.State())
+	assert.True(t, b.Allow())
+	b.Record(true)
+	assert.Equal(t, StateClosed, b.State())
+}
+
+func TestBreakerClose(t *testing.T) {
+	count := func() int { return testutil.CollectAndCount(metrics.CircuitBreakerState) }
+	series := count()
+
+	cfg := config.CircuitBreakerConfig{MinRequests: 1}
+	previous := New("/close", "api.example.com", cfg)
+	current := New("/close", "api.example.com", cfg)
+	assert.Equal(t, series+1, count())
+
+	// The series is kept while another breaker exports it
+	previous.Close()
+	previous.Close()
+	assert.Equal(t, series+1, count())
+
+	current.Close()
+	assert.Equal(t, series, count())
+
+	// A closed breaker keeps working without exporting its state
+	record(current, 0, 1)
+	assert.Equal(t, StateOpen, current.State())
+	assert.Equal(t, series, count())
+}
+
+func TestNilBreaker(t *testing.T) {
+	var b *Breaker
+	assert.True(t, b.Ready())
+	assert.True(t, b.Allow())
+	b.Record(false)
+	b.Cancel()
+	b.Close()
+	assert.Equal(t, StateClosed, b.State())
+	assert.Zero(t, b.RetryAfter())
+}
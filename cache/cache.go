@@ -0,0 +1,136 @@
+// Package cache stores upstream responses so they can be served again
+// without contacting the upstream, following HTTP caching (RFC 9111).
+package cache
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// entryOverhead approximates the size of an entry besides its body and
+// headers.
+const entryOverhead = 256
+
+// Entry is a cached response.
+type Entry struct {
+	Key     string      // primary cache key, see Key
+	Vary    http.Header // request header values the response varies on
+	Status  int
+	Header  http.Header
+	Body    []byte
+	Date    time.Time // when the response was generated
+	Expires time.Time // when the response stops being fresh
+
+	// How long the response can be served once expired, see StaleWindows
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+
+	// GeneratedETag is the weak entity tag generated for responses without
+	// one, see WeakETag. It is never sent upstream.
+	GeneratedETag string
+}
+
+// ETag returns the entity tag of the response, the generated one when the
+// upstream sent none.
+func (e *Entry) ETag() string {
+	if etag := e.Header.Get("ETag"); etag != "" {
+		return etag
+	}
+	return e.GeneratedETag
+}
+
+// Age returns how long ago the response was generated.
+func (e *Entry) Age(now time.Time) time.Duration {
+	return max(now.Sub(e.Date), 0)
+}
+
+// Fresh reports whether the response can be served without contacting the
+// upstream.
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+// Revalidatable reports whether the expired response can be served while it
+// is refreshed in the background.
+func (e *Entry) Revalidatable(now time.Time) bool {
+	return !e.Fresh(now) && now.Before(e.Expires.Add(e.StaleWhileRevalidate))
+}
+
+// UsableOnError reports whether the response can be served when the upstream
+// fails.
+func (e *Entry) UsableOnError(now time.Time) bool {
+	return now.Before(e.Expires.Add(e.StaleIfError))
+}
+
+// Expired reports whether the response can no longer be served, even stale.
+// Responses with an ETag or Last-Modified header never expire as they can
+// be revalidated, they are only evicted.
+func (e *Entry) Expired(now time.Time) bool {
+	if e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != "" {
+		return false
+	}
+	return !now.Before(e.Expires.Add(max(e.StaleWhileRevalidate, e.StaleIfError)))
+}
+
+// matches reports whether the entry was stored for a request with the same
+// values of the headers the response varies on as r.
+func (e *Entry) matches(r *http.Request) bool {
+	for name, values := range e.Vary {
+		if !slices.Equal(values, r.Header.Values(name)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Entry) size() int64 {
+	size := int64(len(e.Key) + len(e.Body) + len(e.GeneratedETag) + entryOverhead)
+	for _, header := range []http.Header{e.Header, e.Vary} {
+		for name, values := range header {
+			size += int64(len(name))
+			for _, value := range values {
+				size += int64(len(value))
+			}
+		}
+	}
+	return size
+}
+
+// Store keeps cached responses. Implementations are safe for concurrent use.
+type Store interface {
+	// Get returns the entry of key matching the Vary headers of r, or nil.
+	Get(key string, r *http.Request) *Entry
+	// Set stores entry, replacing the entry of the same key and variant.
+	// Entries larger than the maximum entry size are not stored.
+	Set(entry *Entry)
+	// Delete removes all entries of key.
+	Delete(key string)
+	// MaxEntrySize returns the size in bytes of the largest body stored.
+	MaxEntrySize() int64
+	// Close releases the resources of the store. It may no longer store
+	// entries afterwards, but remains safe to use.
+	Close() error
+}
+
+// New creates the store selected by cfg.
+func New(cfg config.CacheConfig) (Store, error) {
+	if cfg.GetStore() == config.CACHE_STORE_DISK {
+		return OpenDisk(cfg)
+	}
+	return NewMemory(cfg), nil
+}
+
+func equalVary(a, b http.Header) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, values := range a {
+		if !slices.Equal(values, b[name]) {
+			return false
+		}
+	}
+	return true
+}
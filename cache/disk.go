@@ -0,0 +1,477 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+const (
+	// journalName is the file recording the entries of a disk store, one
+	// JSON record per line.
+	journalName = "index.log"
+	// objectsName is the directory holding response bodies, named by the
+	// SHA-256 digest of their content.
+	objectsName = "objects"
+	// tempPrefix starts the names of files being written.
+	tempPrefix = "tmp-"
+	// compactMinRecords is the number of obsolete journal records above which
+	// the journal is rewritten.
+	compactMinRecords = 1000
+	// maxRecordSize bounds the size of a journal record.
+	maxRecordSize = 1 << 20
+)
+
+// record is a journal line, adding an entry or removing a variant of a key.
+type record struct {
+	Remove               bool          `json:"remove,omitempty"`
+	Key                  string        `json:"key"`
+	Vary                 http.Header   `json:"vary,omitempty"`
+	Status               int           `json:"status,omitempty"`
+	Header               http.Header   `json:"header,omitempty"`
+	Date                 time.Time     `json:"date"`
+	Expires              time.Time     `json:"expires"`
+	StaleWhileRevalidate time.Duration `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         time.Duration `json:"stale_if_error,omitempty"`
+	GeneratedETag        string        `json:"generated_etag,omitempty"`
+	Object               string        `json:"object,omitempty"`
+}
+
+// object is a body file, shared by the entries with the same body.
+type object struct {
+	refs int
+	size int64
+}
+
+// Disk keeps entries in a directory so they survive restarts, up to a
+// maximum size, evicting the least recently used ones.
+//
+// Bodies are stored in content-addressed files, and entries in a journal
+// replayed when the store is opened. Files are written to a temporary name,
+// synced then renamed, journal records partially written by a crash are
+// skipped, and bodies are checked against their digest when read, so a crash
+// can lose recent entries but never serve corrupted ones. Recency is only
+// tracked in memory: after a restart, entries are evicted in the order they
+// were stored.
+type Disk struct {
+	dir          string
+	maxSize      int64
+	maxEntrySize int64
+
+	mu      sync.Mutex
+	size    int64
+	index   *index
+	objects map[string]*object
+	journal *os.File // nil once closed
+	records int      // records in the journal
+}
+
+// OpenDisk opens the disk store in the directory of cfg, creating it when
+// needed, and loads the entries it holds.
+func OpenDisk(cfg config.CacheConfig) (*Disk, error) {
+	d := &Disk{
+		dir:          cfg.Path,
+		maxSize:      cfg.GetMaxSize(),
+		maxEntrySize: cfg.GetMaxEntrySize(),
+		index:        newIndex(),
+		objects:      make(map[string]*object),
+	}
+	if err := os.MkdirAll(filepath.Join(d.dir, objectsName), 0o700); err != nil {
+		return nil, err
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	d.collectGarbage()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The maximum size may have been lowered since the entries were stored
+	d.evict()
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+	d.updateMetrics()
+	slog.Info("Opened disk cache", "path", d.dir, "entries", d.index.len(), "size", d.size)
+	return d, nil
+}
+
+func (d *Disk) MaxEntrySize() int64 {
+	return d.maxEntrySize
+}
+
+func (d *Disk) Get(key string, r *http.Request) *Entry {
+	d.mu.Lock()
+	it := d.index.get(key, r)
+	if it == nil || d.journal == nil {
+		d.mu.Unlock()
+		return nil
+	}
+	d.mu.Unlock()
+
+	// Read outside of the lock, the file may be removed meanwhile
+	body, err := os.ReadFile(d.objectPath(it.object))
+	if err == nil && digest(body) != it.object {
+		err = errors.New("body does not match its digest")
+	}
+	if err != nil {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.remove(it) {
+			slog.Warn("Dropping unreadable cache entry", "key", key, "error", err)
+			d.updateMetrics()
+		}
+		return nil
+	}
+
+	entry := *it.entry
+	entry.Body = body
+	return &entry
+}
+
+func (d *Disk) Set(entry *Entry) {
+	if int64(len(entry.Body)) > d.maxEntrySize {
+		return
+	}
+	meta := *entry
+	meta.Body = nil
+	it := &item{entry: &meta, size: meta.size(), object: digest(entry.Body)}
+	if it.size+int64(len(entry.Body)) > d.maxSize {
+		return
+	}
+
+	// Write the body before taking the lock, it is only renamed to its
+	// final name when no entry stores the same body
+	temp, err := d.writeTemp(entry.Body)
+	if err != nil {
+		slog.Warn("Failed to write cache entry", "key", entry.Key, "error", err)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.journal == nil {
+		os.Remove(temp)
+		return
+	}
+	if d.objects[it.object] != nil {
+		// Another entry has the same body
+		os.Remove(temp)
+	} else if err := d.commitObject(temp, it.object); err != nil {
+		os.Remove(temp)
+		slog.Warn("Failed to write cache entry", "key", entry.Key, "error", err)
+		return
+	}
+
+	d.append(d.record(it, false))
+	d.insert(it, int64(len(entry.Body)))
+	d.evict()
+	d.updateMetrics()
+}
+
+func (d *Disk) Delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.journal == nil {
+		return
+	}
+	for _, it := range d.index.variants(key) {
+		d.remove(it)
+	}
+	d.updateMetrics()
+}
+
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.journal == nil {
+		return nil
+	}
+	err := d.journal.Close()
+	d.journal = nil
+	return err
+}
+
+// load replays the journal.
+func (d *Disk) load() error {
+	file, err := os.Open(filepath.Join(d.dir, journalName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxRecordSize)
+	for scanner.Scan() {
+		var rec record
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err == nil && !rec.Remove && len(rec.Object) != 2*sha256.Size {
+			err = errors.New("invalid object digest")
+		}
+		if err != nil {
+			// Records are only partially written when the process stops
+			// while appending them
+			slog.Warn("Skipping invalid cache journal record", "path", d.dir, "error", err)
+			continue
+		}
+		if rec.Remove {
+			for _, existing := range d.index.variants(rec.Key) {
+				if equalVary(existing.entry.Vary, rec.Vary) {
+					d.index.remove(existing)
+				}
+			}
+			continue
+		}
+		it := &item{
+			entry: &Entry{
+				Key:                  rec.Key,
+				Vary:                 rec.Vary,
+				Status:               rec.Status,
+				Header:               rec.Header,
+				Date:                 rec.Date,
+				Expires:              rec.Expires,
+				StaleWhileRevalidate: rec.StaleWhileRevalidate,
+				StaleIfError:         rec.StaleIfError,
+				GeneratedETag:        rec.GeneratedETag,
+			},
+			object: rec.Object,
+		}
+		it.size = it.entry.size()
+		d.index.add(it)
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Warn("Failed to read cache journal, later records ignored", "path", d.dir, "error", err)
+	}
+
+	// Keep entries that can still be served and whose body was written
+	now := time.Now()
+	for _, it := range d.index.all() {
+		d.index.remove(it)
+		if info, err := os.Stat(d.objectPath(it.object)); err == nil && !it.entry.Expired(now) {
+			d.insert(it, info.Size())
+		}
+	}
+	return nil
+}
+
+// collectGarbage removes the files no entry references: bodies of entries
+// lost in a crash, and files that were being written.
+func (d *Disk) collectGarbage() {
+	root := filepath.Join(d.dir, objectsName)
+	filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return nil
+		}
+		if d.objects[entry.Name()] == nil {
+			if err := os.Remove(path); err != nil {
+				slog.Warn("Failed to remove unused cache file", "path", path, "error", err)
+			}
+		}
+		return nil
+	})
+}
+
+// insert indexes it, whose body has bodySize bytes. d.mu must be held.
+func (d *Disk) insert(it *item, bodySize int64) {
+	// Reference the body before releasing the replaced entry, which may
+	// have the same one
+	if obj := d.objects[it.object]; obj != nil {
+		obj.refs++
+	} else {
+		d.objects[it.object] = &object{refs: 1, size: bodySize}
+		d.size += bodySize
+	}
+	d.size += it.size
+	if replaced := d.index.add(it); replaced != nil {
+		d.release(replaced)
+	}
+}
+
+// remove drops it from the store and the journal, and reports whether it was
+// stored. d.mu must be held.
+func (d *Disk) remove(it *item) bool {
+	if !d.index.remove(it) {
+		return false
+	}
+	d.release(it)
+	if d.journal != nil {
+		d.append(d.record(it, true))
+	}
+	return true
+}
+
+// release accounts for a removed item, deleting its body file when no
+// other entry uses it. d.mu must be held.
+func (d *Disk) release(it *item) {
+	d.size -= it.size
+	obj := d.objects[it.object]
+	if obj == nil {
+		return
+	}
+	if obj.refs--; obj.refs > 0 {
+		return
+	}
+	delete(d.objects, it.object)
+	d.size -= obj.size
+	if err := os.Remove(d.objectPath(it.object)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Failed to remove cache file", "path", d.objectPath(it.object), "error", err)
+	}
+}
+
+// evict removes the least recently used entries until the store fits its
+// maximum size. d.mu must be held.
+func (d *Disk) evict() {
+	for d.size > d.maxSize {
+		oldest := d.index.oldest()
+		if oldest == nil {
+			return
+		}
+		d.remove(oldest)
+		metrics.CacheEvictions.Inc()
+	}
+}
+
+func (d *Disk) record(it *item, remove bool) record {
+	rec := record{Remove: remove, Key: it.entry.Key, Vary: it.entry.Vary}
+	if !remove {
+		rec.Status = it.entry.Status
+		rec.Header = it.entry.Header
+		rec.Date = it.entry.Date
+		rec.Expires = it.entry.Expires
+		rec.StaleWhileRevalidate = it.entry.StaleWhileRevalidate
+		rec.StaleIfError = it.entry.StaleIfError
+		rec.GeneratedETag = it.entry.GeneratedETag
+		rec.Object = it.object
+	}
+	return rec
+}
+
+// append writes rec to the journal, rewriting it once it holds too many
+// obsolete records. d.mu must be held.
+func (d *Disk) append(rec record) {
+	line, err := json.Marshal(rec)
+	if err == nil {
+		_, err = d.journal.Write(append(line, '\n'))
+	}
+	if err != nil {
+		slog.Warn("Failed to write cache journal", "path", d.dir, "error", err)
+		return
+	}
+	d.records++
+	if d.records > 2*d.index.len()+compactMinRecords {
+		if err := d.compact(); err != nil {
+			slog.Warn("Failed to compact cache journal", "path", d.dir, "error", err)
+		}
+	}
+}
+
+// compact replaces the journal with the records of the current entries, and
+// opens it for appending. d.mu must be held.
+func (d *Disk) compact() error {
+	var buf bytes.Buffer
+	items := d.index.all()
+	for _, it := range items {
+		line, err := json.Marshal(d.record(it, false))
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+	path := filepath.Join(d.dir, journalName)
+	temp, err := d.writeTemp(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return err
+	}
+	syncDir(d.dir)
+
+	journal, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if d.journal != nil {
+		d.journal.Close()
+	}
+	d.journal = journal
+	d.records = len(items)
+	return nil
+}
+
+// writeTemp writes data to a new synced temporary file in the objects
+// directory, and returns its path.
+func (d *Disk) writeTemp(data []byte) (string, error) {
+	file, err := os.CreateTemp(filepath.Join(d.dir, objectsName), tempPrefix+"*")
+	if err != nil {
+		return "", err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// commitObject moves the temporary file to the path of the body with digest
+// sum. d.mu must be held.
+func (d *Disk) commitObject(temp, sum string) error {
+	path := d.objectPath(sum)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// objectPath returns the path of the body with digest sum. Bodies are spread
+// in subdirectories named by the first digest byte.
+func (d *Disk) objectPath(sum string) string {
+	return filepath.Join(d.dir, objectsName, sum[:2], sum)
+}
+
+// updateMetrics exports the size of the cache, d.mu must be held.
+func (d *Disk) updateMetrics() {
+	metrics.CacheSize.Set(float64(d.size))
+	metrics.CacheEntries.Set(float64(d.index.len()))
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// syncDir makes the renames in dir durable.
+func syncDir(dir string) {
+	if f, err := os.Open(dir); err == nil {
+		f.Sync()
+		f.Close()
+	}
+}
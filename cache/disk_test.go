@@ -0,0 +1,165 @@
+package cache
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func openTestDisk(t *testing.T, cfg config.CacheConfig) *Disk {
+	t.Helper()
+	d, err := OpenDisk(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+// objectFiles returns the names of the files in the objects directory.
+func objectFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	filepath.WalkDir(filepath.Join(dir, objectsName), func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+		return nil
+	})
+	return names
+}
+
+func TestDiskPersistence(t *testing.T) {
+	cfg := config.CacheConfig{Store: "disk", Path: t.TempDir()}
+	r := httptest.NewRequest("GET", "/api/users", nil)
+	r.Header.Set("Accept-Language", "fr")
+
+	d := openTestDisk(t, cfg)
+	entry := newEntry("key", 10)
+	entry.Vary = http.Header{"Accept-Language": {"fr"}}
+	entry.Header.Set("Content-Type", "text/plain")
+	entry.StaleIfError = time.Hour
+	entry.GeneratedETag = WeakETag(entry.Body)
+	d.Set(entry)
+	d.Set(newEntry("deleted", 10))
+	d.Delete("deleted")
+
+	got := d.Get("key", r)
+	assert.Equal(t, entry.Body, got.Body)
+	assert.Nil(t, d.Get("key", httptest.NewRequest("GET", "/api/users", nil)), "other variant")
+	require.NoError(t, d.Close())
+	assert.Nil(t, d.Get("key", r), "closed")
+
+	d = openTestDisk(t, cfg)
+	got = d.Get("key", r)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, entry.Body, got.Body)
+		assert.Equal(t, "text/plain", got.Header.Get("Content-Type"))
+		assert.Equal(t, time.Hour, got.StaleIfError)
+		assert.Equal(t, entry.GeneratedETag, got.GeneratedETag)
+		assert.True(t, entry.Expires.Equal(got.Expires))
+	}
+	assert.Nil(t, d.Get("deleted", r))
+}
+
+func TestDiskDeduplication(t *testing.T) {
+	cfg := config.CacheConfig{Store: "disk", Path: t.TempDir()}
+	d := openTestDisk(t, cfg)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	d.Set(newEntry("a", 100))
+	d.Set(newEntry("b", 100))
+	d.Set(newEntry("b", 100)) // replaced by the same body
+	assert.Len(t, objectFiles(t, cfg.Path), 1, "same body stored once")
+
+	d.Delete("a")
+	assert.NotNil(t, d.Get("b", r), "body still used")
+	assert.Len(t, objectFiles(t, cfg.Path), 1)
+
+	d.Delete("b")
+	assert.Empty(t, objectFiles(t, cfg.Path))
+}
+
+func TestDiskEviction(t *testing.T) {
+	cfg := config.CacheConfig{Store: "disk", Path: t.TempDir(), MaxSize: "3KB", MaxEntrySize: "2KB"}
+	d := openTestDisk(t, cfg)
+	r := httptest.NewRequest("GET", "/", nil)
+
+	a, b, c := newEntry("a", 1000), newEntry("b", 1001), newEntry("c", 1002)
+	d.Set(a)
+	d.Set(b)
+	d.Get("a", r) // b becomes the least recently used
+	d.Set(c)
+
+	assert.NotNil(t, d.Get("a", r))
+	assert.Nil(t, d.Get("b", r), "least recently used entry evicted")
+	assert.NotNil(t, d.Get("c", r))
+	assert.ElementsMatch(t, []string{digest(a.Body), digest(c.Body)}, objectFiles(t, cfg.Path))
+
+	d.Set(newEntry("large", 3000))
+	assert.Nil(t, d.Get("large", r), "entry larger than max entry size")
+
+	// Lowering the maximum size evicts entries when opening
+	require.NoError(t, d.Close())
+	cfg.MaxSize = "2KB"
+	d = openTestDisk(t, cfg)
+	assert.Nil(t, d.Get("a", r))
+	assert.NotNil(t, d.Get("c", r))
+}
+
+func TestDiskRecovery(t *testing.T) {
+	cfg := config.CacheConfig{Store: "disk", Path: t.TempDir()}
+	r := httptest.NewRequest("GET", "/", nil)
+
+	d := openTestDisk(t, cfg)
+	d.Set(newEntry("kept", 10))
+	d.Set(newEntry("corrupted", 20))
+	expired := newEntry("expired", 30)
+	expired.Expires = time.Now().Add(-time.Second)
+	d.Set(expired)
+	require.NoError(t, d.Close())
+
+	// Simulate a crash while writing a record and a body
+	journal, err := os.OpenFile(filepath.Join(cfg.Path, journalName), os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = journal.WriteString(`{"key":"partial","sta`)
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(cfg.Path, objectsName, tempPrefix+"123"), []byte("partial"), 0o600))
+	require.NoError(t, os.WriteFile(d.objectPath(digest(newEntry("corrupted", 20).Body)), []byte("garbage"), 0o600))
+
+	d = openTestDisk(t, cfg)
+	assert.NotNil(t, d.Get("kept", r))
+	assert.Nil(t, d.Get("expired", r), "expired entries dropped")
+	assert.Nil(t, d.Get("corrupted", r), "body not matching its digest")
+	assert.ElementsMatch(t, []string{digest(newEntry("kept", 10).Body)}, objectFiles(t, cfg.Path), "unused files removed")
+
+	// Later records are still appended after the partial one
+	d.Set(newEntry("new", 40))
+	require.NoError(t, d.Close())
+	d = openTestDisk(t, cfg)
+	assert.NotNil(t, d.Get("new", r))
+}
+
+func TestNew(t *testing.T) {
+	store, err := New(config.CacheConfig{})
+	require.NoError(t, err)
+	assert.IsType(t, &Memory{}, store)
+
+	store, err = New(config.CacheConfig{Store: "disk", Path: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &Disk{}, store)
+	store.Close()
+
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	_, err = New(config.CacheConfig{Store: "disk", Path: file})
+	assert.Error(t, err)
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"slices"
+)
+
+// item is an entry in an index.
+type item struct {
+	entry   *Entry
+	size    int64  // size accounted for the entry
+	object  string // digest of the body file of disk stores
+	element *list.Element
+}
+
+// index orders entries from the most to the least recently used, and finds
+// them by key and variant. It is not safe for concurrent use.
+type index struct {
+	lru     *list.List // of *item
+	entries map[string][]*item
+}
+
+func newIndex() *index {
+	return &index{
+		lru:     list.New(),
+		entries: make(map[string][]*item),
+	}
+}
+
+// get returns the item of key matching the Vary headers of r, or nil, and
+// marks it as the most recently used.
+func (x *index) get(key string, r *http.Request) *item {
+	for _, it := range x.entries[key] {
+		if it.entry.matches(r) {
+			x.lru.MoveToFront(it.element)
+			return it
+		}
+	}
+	return nil
+}
+
+// add inserts it as the most recently used item. The item of the same key
+// and variant it replaces is returned, or nil.
+func (x *index) add(it *item) *item {
+	var replaced *item
+	for _, existing := range x.entries[it.entry.Key] {
+		if equalVary(existing.entry.Vary, it.entry.Vary) {
+			replaced = existing
+			x.remove(existing)
+			break
+		}
+	}
+	it.element = x.lru.PushFront(it)
+	x.entries[it.entry.Key] = append(x.entries[it.entry.Key], it)
+	return replaced
+}
+
+// remove drops it from the index, and reports whether it was indexed.
+func (x *index) remove(it *item) bool {
+	items := x.entries[it.entry.Key]
+	i := slices.Index(items, it)
+	if i < 0 {
+		return false
+	}
+	x.lru.Remove(it.element)
+	if items = slices.Delete(items, i, i+1); len(items) == 0 {
+		delete(x.entries, it.entry.Key)
+	} else {
+		x.entries[it.entry.Key] = items
+	}
+	return true
+}
+
+// variants returns the items of key.
+func (x *index) variants(key string) []*item {
+	return slices.Clone(x.entries[key])
+}
+
+// oldest returns the least recently used item, or nil when empty.
+func (x *index) oldest() *item {
+	if element := x.lru.Back(); element != nil {
+		return element.Value.(*item)
+	}
+	return nil
+}
+
+// all returns the items from the least to the most recently used.
+func (x *index) all() []*item {
+	items := make([]*item, 0, x.lru.Len())
+	for element := x.lru.Back(); element != nil; element = element.Prev() {
+		items = append(items, element.Value.(*item))
+	}
+	return items
+}
+
+func (x *index) len() int {
+	return x.lru.Len()
+}
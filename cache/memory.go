@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+// Memory keeps entries in memory up to a maximum size, evicting the least
+// recently used ones. A key can hold several entries, one per variant of a
+// response with a Vary header.
+type Memory struct {
+	maxSize      int64
+	maxEntrySize int64
+
+	mu    sync.Mutex
+	size  int64
+	index *index
+}
+
+func NewMemory(cfg config.CacheConfig) *Memory {
+	metrics.CacheSize.Set(0)
+	metrics.CacheEntries.Set(0)
+	return &Memory{
+		maxSize:      cfg.GetMaxSize(),
+		maxEntrySize: cfg.GetMaxEntrySize(),
+		index:        newIndex(),
+	}
+}
+
+func (m *Memory) MaxEntrySize() int64 {
+	return m.maxEntrySize
+}
+
+func (m *Memory) Get(key string, r *http.Request) *Entry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if it := m.index.get(key, r); it != nil {
+		return it.entry
+	}
+	return nil
+}
+
+func (m *Memory) Set(entry *Entry) {
+	size := entry.size()
+	if int64(len(entry.Body)) > m.maxEntrySize || size > m.maxSize {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if replaced := m.index.add(&item{entry: entry, size: size}); replaced != nil {
+		m.size -= replaced.size
+	}
+	m.size += size
+
+	for m.size > m.maxSize {
+		oldest := m.index.oldest()
+		m.index.remove(oldest)
+		m.size -= oldest.size
+		metrics.CacheEvictions.Inc()
+	}
+	m.updateMetrics()
+}
+
+func (m *Memory) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, it := range m.index.variants(key) {
+		m.index.remove(it)
+		m.size -= it.size
+	}
+	m.updateMetrics()
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+// updateMetrics exports the size of the cache, m.mu must be held.
+func (m *Memory) updateMetrics() {
+	metrics.CacheSize.Set(float64(m.size))
+	metrics.CacheEntries.Set(float64(m.index.len()))
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+func newEntry(key string, bodySize int) *Entry {
+	return &Entry{
+		Key:     key,
+		Status:  http.StatusOK,
+		Header:  http.Header{},
+		Body:    []byte(strings.Repeat("x", bodySize)),
+		Expires: time.Now().Add(time.Minute),
+	}
+}
+
+func TestMemoryGetSet(t *testing.T) {
+	c := NewMemory(config.CacheConfig{})
+	r := httptest.NewRequest("GET", "/api/users", nil)
+
+	assert.Nil(t, c.Get("key", r))
+
+	entry := newEntry("key", 10)
+	c.Set(entry)
+	assert.Same(t, entry, c.Get("key", r))
+
+	replacement := newEntry("key", 20)
+	c.Set(replacement)
+	assert.Same(t, replacement, c.Get("key", r), "same variant replaced")
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.CacheEntries))
+
+	c.Delete("key")
+	assert.Nil(t, c.Get("key", r))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.CacheSize))
+}
+
+func TestMemoryVary(t *testing.T) {
+	c := NewMemory(config.CacheConfig{})
+
+	english := newEntry("key", 10)
+	english.Vary = http.Header{"Accept-Language": {"en"}}
+	french := newEntry("key", 10)
+	french.Vary = http.Header{"Accept-Language": {"fr"}}
+	c.Set(english)
+	c.Set(french)
+
+	r := httptest.NewRequest("GET", "/api/users", nil)
+	r.Header.Set("Accept-Language", "fr")
+	assert.Same(t, french, c.Get("key", r))
+
+	r.Header.Set("Accept-Language", "en")
+	assert.Same(t, english, c.Get("key", r))
+
+	r.Header.Set("Accept-Language", "de")
+	assert.Nil(t, c.Get("key", r))
+
+	c.Delete("key")
+	r.Header.Set("Accept-Language", "en")
+	assert.Nil(t, c.Get("key", r), "all variants deleted")
+}
+
+func TestMemoryEviction(t *testing.T) {
+	entrySize := newEntry("a", 1000).size()
+	c := NewMemory(config.CacheConfig{MaxSize: "3KB", MaxEntrySize: "2KB"})
+	r := httptest.NewRequest("GET", "/", nil)
+	evictions := testutil.ToFloat64(metrics.CacheEvictions)
+
+	c.Set(newEntry("a", 1000))
+	c.Set(newEntry("b", 1000))
+	c.Get("a", r) // b becomes the least recently used
+	c.Set(newEntry("c", 1000))
+
+	assert.NotNil(t, c.Get("a", r))
+	assert.Nil(t, c.Get("b", r), "least recently used entry evicted")
+	assert.NotNil(t, c.Get("c", r))
+	assert.Equal(t, evictions+1, testutil.ToFloat64(metrics.CacheEvictions))
+	assert.Equal(t, float64(2*entrySize), testutil.ToFloat64(metrics.CacheSize))
+
+	c.Set(newEntry("large", 3000))
+	assert.Nil(t, c.Get("large", r), "entry larger than max entry size")
+	assert.NotNil(t, c.Get("a", r))
+}
+
+func TestEntryFreshness(t *testing.T) {
+	now := time.Now()
+	entry := &Entry{
+		Date:                 now.Add(-30 * time.Second),
+		Expires:              now.Add(30 * time.Second),
+		StaleWhileRevalidate: time.Minute,
+		StaleIfError:         time.Hour,
+	}
+
+	assert.Equal(t, 30*time.Second, entry.Age(now))
+	assert.True(t, entry.Fresh(now))
+	assert.False(t, entry.Revalidatable(now), "fresh")
+	assert.True(t, entry.UsableOnError(now))
+
+	later := now.Add(time.Minute)
+	assert.False(t, entry.Fresh(later))
+	assert.True(t, entry.Revalidatable(later))
+
+	later = now.Add(30 * time.Minute)
+	assert.False(t, entry.Revalidatable(later), "past stale-while-revalidate")
+	assert.True(t, entry.UsableOnError(later))
+	assert.False(t, entry.Expired(later))
+
+	later = now.Add(2 * time.Hour)
+	assert.False(t, entry.UsableOnError(later))
+	assert.True(t, entry.Expired(later))
+
+	entry.Header = http.Header{"Etag": {`"v1"`}}
+	assert.False(t, entry.Expired(later), "revalidatable")
+}
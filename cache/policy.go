@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// Directives are the directives of Cache-Control headers, by lowercase name.
+// Directives without argument have an empty value.
+type Directives map[string]string
+
+// ParseCacheControl parses the Cache-Control directives of header.
+func ParseCacheControl(header http.Header) Directives {
+	directives := make(Directives)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, argument, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(argument, `"`)
+		}
+	}
+	return directives
+}
+
+// Has reports whether the directive is present.
+func (d Directives) Has(name string) bool {
+	_, ok := d[name]
+	return ok
+}
+
+// Duration returns the delta-seconds argument of a directive.
+func (d Directives) Duration(name string) (time.Duration, bool) {
+	value, ok := d[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// Key returns the primary cache key of a request: its method, path, query
+// parameters sorted by name, and the values of keyHeaders.
+func Key(r *http.Request, keyHeaders []string) string {
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(r.URL.Path)
+	if query := r.URL.Query(); len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+	for _, name := range keyHeaders {
+		b.WriteByte('\n')
+		b.WriteString(http.CanonicalHeaderKey(name))
+		b.WriteString(": ")
+		b.WriteString(strings.Join(r.Header.Values(name), ", "))
+	}
+	return b.String()
+}
+
+// InvalidatedKeys returns the keys of the cached responses a request with an
+// unsafe method invalidates, the GET and HEAD responses of its URL.
+func InvalidatedKeys(r *http.Request, keyHeaders []string) []string {
+	var keys []string
+	for _, method := range []string{http.MethodGet, http.MethodHead} {
+		lookup := &http.Request{Method: method, URL: &url.URL{Path: r.URL.Path, RawQuery: r.URL.RawQuery}, Header: r.Header}
+		keys = append(keys, Key(lookup, keyHeaders))
+	}
+	return keys
+}
+
+// Cacheable reports whether the response to r may come from or go to the cache.
+func Cacheable(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return !ParseCacheControl(r.Header).Has("no-store")
+}
+
+// Usable reports whether entry can answer r without contacting the upstream,
+// given the request cache directives.
+func Usable(entry *Entry, r *http.Request, now time.Time) bool {
+	return acceptable(entry, r, now) && entry.Fresh(now)
+}
+
+// UsableWhileRevalidating reports whether the expired entry can answer r
+// while it is refreshed in the background.
+func UsableWhileRevalidating(entry *Entry, r *http.Request, now time.Time) bool {
+	return acceptable(entry, r, now) && entry.Revalidatable(now)
+}
+
+// acceptable reports whether the request cache directives let entry answer r.
+func acceptable(entry *Entry, r *http.Request, now time.Time) bool {
+	directives := ParseCacheControl(r.Header)
+	if directives.Has("no-cache") || (len(directives) == 0 && r.Header.Get("Pragma") == "no-cache") {
+		return false
+	}
+	if maxAge, ok := directives.Duration("max-age"); ok && entry.Age(now) > maxAge {
+		return false
+	}
+	return true
+}
+
+// statuses that can be cached (RFC 9110 section 15.1).
+var cacheableStatuses = []int{
+	http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+	http.StatusMultipleChoices, http.StatusMovedPermanently, http.StatusPermanentRedirect,
+	http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone,
+	http.StatusRequestURITooLong, http.StatusNotImplemented,
+}
+
+// Freshness returns for how long the response to r stays fresh once received
+// at now, or false when it must not be stored. The lifetime comes from the
+// response Cache-Control or Expires headers, adjusted by the endpoint cache
+// configuration, minus the time the response spent in upstream caches. It is
+// negative or zero for responses that are already stale.
+func Freshness(r *http.Request, status int, header http.Header, cfg config.EndpointCacheConfig, now time.Time) (time.Duration, bool) {
+	if !slices.Contains(cacheableStatuses, status) {
+		return 0, false
+	}
+	directives := ParseCacheControl(header)
+	if directives.Has("no-store") || directives.Has("private") || directives.Has("no-cache") {
+		return 0, false
+	}
+	if header.Get("Vary") == "*" || header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	// Responses to authenticated requests are only shared when allowed
+	if r.Header.Get("Authorization") != "" &&
+		!directives.Has("public") && !directives.Has("s-maxage") && !directives.Has("must-revalidate") {
+		return 0, false
+	}
+
+	lifetime, ok := cfg.GetTTL(), cfg.GetTTL() > 0
+	if !ok {
+		lifetime, ok = directives.Duration("s-maxage")
+	}
+	if !ok {
+		lifetime, ok = directives.Duration("max-age")
+	}
+	if !ok && header.Get("Expires") != "" {
+		date := now
+		if d, err := http.ParseTime(header.Get("Date")); err == nil {
+			date = d
+		}
+		// Invalid dates, like "0", mean already expired
+		expires, _ := http.ParseTime(header.Get("Expires"))
+		lifetime, ok = expires.Sub(date), true
+	}
+	if !ok {
+		lifetime = cfg.GetDefaultTTL()
+	}
+	if maxTTL := cfg.GetMaxTTL(); maxTTL > 0 {
+		lifetime = min(lifetime, maxTTL)
+	}
+
+	if age, err := strconv.Atoi(header.Get("Age")); err == nil && age > 0 {
+		lifetime -= time.Duration(age) * time.Second
+	}
+	return lifetime, true
+}
+
+// StaleWindows returns for how long a response can be served once expired,
+// while it is revalidated and when the upstream fails. The stale-while-revalidate
+// and stale-if-error directives of the response replace the windows of the
+// endpoint cache configuration, must-revalidate forbids serving it stale.
+func StaleWindows(header http.Header, cfg config.EndpointCacheConfig) (whileRevalidate, ifError time.Duration) {
+	directives := ParseCacheControl(header)
+	// s-maxage implies proxy-revalidate for shared caches (RFC 9111 section 5.2.2.10)
+	if directives.Has("must-revalidate") || directives.Has("proxy-revalidate") || directives.Has("s-maxage") {
+		return 0, 0
+	}
+	whileRevalidate, ok := directives.Duration("stale-while-revalidate")
+	if !ok {
+		whileRevalidate = cfg.GetStaleWhileRevalidate()
+	}
+	ifError, ok = directives.Duration("stale-if-error")
+	if !ok {
+		ifError = cfg.GetStaleIfError()
+	}
+	return whileRevalidate, ifError
+}
+
+// VaryValues returns the values of the request headers listed by the Vary
+// header of a response.
+func VaryValues(r *http.Request, header http.Header) http.Header {
+	vary := make(http.Header)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = http.CanonicalHeaderKey(strings.TrimSpace(name)); name != "" {
+				vary[name] = r.Header.Values(name)
+			}
+		}
+	}
+	return vary
+}
+
+// Validators returns the conditional request headers revalidating entry with
+// the validators the upstream sent, or nil when it sent none.
+func Validators(entry *Entry) http.Header {
+	validators := make(http.Header)
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		validators.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		validators.Set("If-Modified-Since", lastModified)
+	}
+	if len(validators) == 0 {
+		return nil
+	}
+	return validators
+}
+
+// NotModified reports whether the If-None-Match or If-Modified-Since
+// preconditions of r fail for entry, so r can be answered with 304 Not
+// Modified (RFC 9110 section 13.2.2).
+func NotModified(r *http.Request, entry *Entry) bool {
+	// Preconditions only apply to successful responses
+	if entry.Status < 200 || entry.Status > 299 {
+		return false
+	}
+	if values := r.Header.Values("If-None-Match"); len(values) > 0 {
+		etag := entry.ETag()
+		for _, tag := range strings.Split(strings.Join(values, ","), ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || (etag != "" && weakMatch(tag, etag)) {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
+
+// weakMatch compares entity tags ignoring their weakness (RFC 9110 section
+// 8.8.3.2).
+func weakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// WeakETag generates a weak entity tag from the content of body.
+func WeakETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
@@ -0,0 +1,268 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	header := http.Header{"Cache-Control": {`public, max-age=60`, `No-Cache="Set-Cookie"`}}
+	directives := ParseCacheControl(header)
+
+	assert.True(t, directives.Has("public"))
+	assert.True(t, directives.Has("no-cache"))
+	assert.False(t, directives.Has("private"))
+
+	maxAge, ok := directives.Duration("max-age")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, maxAge)
+
+	_, ok = directives.Duration("public")
+	assert.False(t, ok, "directive without delta-seconds")
+}
+
+func TestKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/users?b=2&a=1", nil)
+	r.Header.Set("Accept-Language", "fr")
+
+	assert.Equal(t, "GET /api/users?a=1&b=2", Key(r, nil), "query sorted")
+	assert.Equal(t, "GET /api/users?a=1&b=2\nAccept-Language: fr\nX-Tenant: ", Key(r, []string{"accept-language", "X-Tenant"}))
+
+	head := httptest.NewRequest("HEAD", "/api/users?a=1&b=2", nil)
+	assert.NotEqual(t, Key(r, nil), Key(head, nil))
+
+	post := httptest.NewRequest("POST", "/api/users?b=2&a=1", nil)
+	assert.Equal(t, []string{Key(r, nil), "HEAD /api/users?a=1&b=2"}, InvalidatedKeys(post, nil))
+}
+
+func TestCacheable(t *testing.T) {
+	assert.True(t, Cacheable(httptest.NewRequest("GET", "/", nil)))
+	assert.True(t, Cacheable(httptest.NewRequest("HEAD", "/", nil)))
+	assert.False(t, Cacheable(httptest.NewRequest("POST", "/", nil)))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cache-Control", "no-store")
+	assert.False(t, Cacheable(r))
+}
+
+func TestUsable(t *testing.T) {
+	now := time.Now()
+	entry := &Entry{Date: now.Add(-30 * time.Second), Expires: now.Add(30 * time.Second)}
+
+	tests := []struct {
+		name   string
+		header http.Header
+		want   bool
+	}{
+		{name: "fresh", want: true},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache"}}},
+		{name: "pragma no-cache", header: http.Header{"Pragma": {"no-cache"}}},
+		{name: "max-age exceeded", header: http.Header{"Cache-Control": {"max-age=10"}}},
+		{name: "max-age", header: http.Header{"Cache-Control": {"max-age=60"}}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for key, values := range tt.header {
+				r.Header[key] = values
+			}
+			assert.Equal(t, tt.want, Usable(entry, r, now))
+		})
+	}
+
+	assert.False(t, Usable(entry, httptest.NewRequest("GET", "/", nil), now.Add(time.Minute)), "expired")
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		cfg       config.EndpointCacheConfig
+		status    int
+		header    http.Header
+		request   http.Header
+		want      time.Duration
+		notStored bool
+	}{
+		{name: "max-age", header: http.Header{"Cache-Control": {"max-age=60"}}, want: time.Minute},
+		{name: "s-maxage preferred", header: http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, want: 2 * time.Minute},
+		{
+			name: "expires",
+			header: http.Header{
+				"Date":    {now.Format(http.TimeFormat)},
+				"Expires": {now.Add(time.Hour).Format(http.TimeFormat)},
+			},
+			want: time.Hour,
+		},
+		{name: "invalid expires", header: http.Header{"Expires": {"0"}}, want: time.Time{}.Sub(now)},
+		{name: "age subtracted", header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"20"}}, want: 40 * time.Second},
+		{name: "already stale", header: http.Header{"Cache-Control": {"max-age=60"}, "Age": {"90"}}, want: -30 * time.Second},
+		{name: "no freshness information"},
+		{name: "default ttl", cfg: config.EndpointCacheConfig{DefaultTTL: "5m"}, want: 5 * time.Minute},
+		{name: "ttl override", cfg: config.EndpointCacheConfig{TTL: "10s"}, header: http.Header{"Cache-Control": {"max-age=60"}}, want: 10 * time.Second},
+		{name: "max ttl", cfg: config.EndpointCacheConfig{MaxTTL: "30s"}, header: http.Header{"Cache-Control": {"max-age=60"}}, want: 30 * time.Second},
+		{name: "no-store", cfg: config.EndpointCacheConfig{TTL: "10s"}, header: http.Header{"Cache-Control": {"no-store"}}, notStored: true},
+		{name: "private", header: http.Header{"Cache-Control": {"private, max-age=60"}}, notStored: true},
+		{name: "no-cache", header: http.Header{"Cache-Control": {"no-cache"}}, notStored: true},
+		{name: "vary all", header: http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, notStored: true},
+		{name: "set-cookie", header: http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"session=1"}}, notStored: true},
+		{name: "status not cacheable", status: http.StatusInternalServerError, header: http.Header{"Cache-Control": {"max-age=60"}}, notStored: true},
+		{name: "not found", status: http.StatusNotFound, header: http.Header{"Cache-Control": {"max-age=60"}}, want: time.Minute},
+		{
+			name:      "authorization",
+			header:    http.Header{"Cache-Control": {"max-age=60"}},
+			request:   http.Header{"Authorization": {"Bearer token"}},
+			notStored: true,
+		},
+		{
+			name:    "authorization with public",
+			header:  http.Header{"Cache-Control": {"public, max-age=60"}},
+			request: http.Header{"Authorization": {"Bearer token"}},
+			want:    time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			for key, values := range tt.request {
+				r.Header[key] = values
+			}
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+
+			lifetime, ok := Freshness(r, status, header, tt.cfg, now)
+			assert.Equal(t, !tt.notStored, ok)
+			assert.Equal(t, tt.want, lifetime)
+		})
+	}
+}
+
+func TestVaryValues(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Language", "fr")
+
+	vary := VaryValues(r, http.Header{"Vary": {"accept-language, Accept-Encoding"}})
+	assert.Equal(t, http.Header{"Accept-Language": {"fr"}, "Accept-Encoding": nil}, vary)
+}
+
+func TestStaleWindows(t *testing.T) {
+	cfg := config.EndpointCacheConfig{StaleWhileRevalidate: "30s", StaleIfError: "1h"}
+
+	tests := []struct {
+		name                string
+		cacheControl        string
+		cfg                 config.EndpointCacheConfig
+		wantWhileRevalidate time.Duration
+		wantIfError         time.Duration
+	}{
+		{name: "not configured", cacheControl: "max-age=60"},
+		{name: "configured", cacheControl: "max-age=60", cfg: cfg, wantWhileRevalidate: 30 * time.Second, wantIfError: time.Hour},
+		{
+			name:                "response directives",
+			cacheControl:        "max-age=60, stale-while-revalidate=10, stale-if-error=600",
+			wantWhileRevalidate: 10 * time.Second,
+			wantIfError:         10 * time.Minute,
+		},
+		{
+			name:                "response directives replace configuration",
+			cacheControl:        "max-age=60, stale-while-revalidate=0",
+			cfg:                 cfg,
+			wantWhileRevalidate: 0,
+			wantIfError:         time.Hour,
+		},
+		{name: "must-revalidate", cacheControl: "max-age=60, must-revalidate, stale-if-error=600", cfg: cfg},
+		{name: "s-maxage", cacheControl: "s-maxage=60", cfg: cfg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			whileRevalidate, ifError := StaleWindows(http.Header{"Cache-Control": {tt.cacheControl}}, tt.cfg)
+			assert.Equal(t, tt.wantWhileRevalidate, whileRevalidate)
+			assert.Equal(t, tt.wantIfError, ifError)
+		})
+	}
+}
+
+func TestValidators(t *testing.T) {
+	entry := &Entry{Header: http.Header{
+		"Etag":          {`"v1"`},
+		"Last-Modified": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+	}}
+	assert.Equal(t, http.Header{
+		"If-None-Match":     {`"v1"`},
+		"If-Modified-Since": {"Mon, 02 Jan 2006 15:04:05 GMT"},
+	}, Validators(entry))
+
+	// Generated entity tags are unknown upstream
+	assert.Nil(t, Validators(&Entry{Header: http.Header{}, GeneratedETag: `W/"abc"`}))
+}
+
+func TestNotModified(t *testing.T) {
+	lastModified := "Mon, 02 Jan 2006 15:04:05 GMT"
+
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		etag   string // generated
+		conds  http.Header
+		want   bool
+	}{
+		{name: "unconditional", header: http.Header{"Etag": {`"v1"`}}},
+		{name: "etag match", header: http.Header{"Etag": {`"v1"`}}, conds: http.Header{"If-None-Match": {`"v0", "v1"`}}, want: true},
+		{name: "etag mismatch", header: http.Header{"Etag": {`"v1"`}}, conds: http.Header{"If-None-Match": {`"v0"`}}},
+		{name: "weak comparison", header: http.Header{"Etag": {`W/"v1"`}}, conds: http.Header{"If-None-Match": {`"v1"`}}, want: true},
+		{name: "wildcard", conds: http.Header{"If-None-Match": {"*"}}, want: true},
+		{name: "generated etag", etag: `W/"abc"`, conds: http.Header{"If-None-Match": {`W/"abc"`}}, want: true},
+		{
+			name:   "if-none-match takes precedence",
+			header: http.Header{"Etag": {`"v1"`}, "Last-Modified": {lastModified}},
+			conds:  http.Header{"If-None-Match": {`"v0"`}, "If-Modified-Since": {lastModified}},
+		},
+		{name: "not modified since", header: http.Header{"Last-Modified": {lastModified}}, conds: http.Header{"If-Modified-Since": {lastModified}}, want: true},
+		{name: "modified since", header: http.Header{"Last-Modified": {lastModified}}, conds: http.Header{"If-Modified-Since": {"Sun, 01 Jan 2006 15:04:05 GMT"}}},
+		{name: "invalid date", header: http.Header{"Last-Modified": {lastModified}}, conds: http.Header{"If-Modified-Since": {"yesterday"}}},
+		{name: "error response", status: http.StatusNotFound, header: http.Header{"Etag": {`"v1"`}}, conds: http.Header{"If-None-Match": {`"v1"`}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			header := tt.header
+			if header == nil {
+				header = http.Header{}
+			}
+			r := httptest.NewRequest("GET", "/api/users", nil)
+			r.Header = tt.conds
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			assert.Equal(t, tt.want, NotModified(r, &Entry{Status: status, Header: header, GeneratedETag: tt.etag}))
+		})
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	etag := WeakETag([]byte("hello"))
+	assert.Regexp(t, `^W/"[0-9a-f]{32}"$`, etag)
+	assert.Equal(t, etag, WeakETag([]byte("hello")))
+	assert.NotEqual(t, etag, WeakETag([]byte("world")))
+}
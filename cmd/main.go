@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -35,16 +36,22 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := server.SetupLogger(cfg.Logging, version); err != nil {
+	if err := server.SetupLogger(cfg.Logging, version, cfg.TemplateValues()); err != nil {
 		slog.Error("Failed to setup logger", "error", err)
 		os.Exit(1)
 	}
 
 	slog.Info("Starting Corsair", "config_file", *configPath, "log_level", cfg.Logging.Level)
 
+	// Tracing settings are applied at startup only
+	shutdownTracing := server.SetupTracing(cfg.Tracing, version)
+
+	server.Version = version
+	handler := server.NewDynamicRoutingHandler(*cfg)
+
 	httpServer := &http.Server{
 		Addr:         net.JoinHostPort(cfg.Server.Address, strconv.Itoa(cfg.Server.Port)),
-		Handler:      server.NewDynamicRoutingHandler(*cfg),
+		Handler:      handler,
 		ReadTimeout:  30 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -63,11 +70,141 @@ func main() {
 		}
 	}()
 
-	// Wait for shutdown signal
+	// Serve metrics on a dedicated listener if configured
+	metricsServer := server.NewMetricsServer(*cfg)
+	if metricsServer != nil {
+		go func() {
+			slog.Info("Starting metrics server", "addr", metricsServer.Addr, "path", cfg.Metrics.GetPath())
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("Metrics server failed", "error", err, "addr", metricsServer.Addr)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Reloads can be triggered concurrently by the file watcher and SIGHUP,
+	// funnel them through a single goroutine.
+	reloadChan := make(chan string, 1)
+	requestReload := func(reason string) {
+		select {
+		case reloadChan <- reason:
+		default:
+			// A reload is already pending, it will pick up the latest file content.
+		}
+	}
+
+	go config.Watch(ctx, *configPath, cfg.GetConfigWatchInterval(), func() {
+		requestReload("file_changed")
+	})
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case reason := <-reloadChan:
+				reloadConfig(handler, *configPath, reason)
+			}
+		}
+	}()
+
+	// Wait for shutdown signal, SIGHUP triggers a configuration reload
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig == syscall.SIGHUP {
+			slog.Info("Received reload signal", "signal", sig.String())
+			requestReload("signal")
+			continue
+		}
+
+		slog.Info("Received shutdown signal", "signal", sig.String())
+		break
+	}
+	cancel()
+
+	// A second shutdown signal stops waiting for requests to complete, and
+	// restores the default behavior so another one terminates the process
+	forceCtx, force := context.WithCancel(context.Background())
+	defer force()
+	go func() {
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP {
+				continue
+			}
+			slog.Warn("Received second shutdown signal, closing remaining connections", "signal", sig.String())
+			signal.Stop(sigChan)
+			force()
+			return
+		}
+	}()
+
+	shutdown(forceCtx, httpServer, handler)
+	handler.Close()
+	shutdownTracing()
+
+	if metricsServer != nil {
+		// Metrics stay available while draining, stop them last
+		if err := metricsServer.Close(); err != nil {
+			slog.Error("Failed to close metrics server", "error", err)
+		}
+	}
+}
+
+// shutdown gracefully stops the server: readiness flips to unhealthy first, then
+// the listener is closed and in-flight requests are given the configured
+// shutdown timeout to complete before remaining connections are forcibly closed.
+// Canceling ctx closes them right away.
+func shutdown(ctx context.Context, httpServer *http.Server, handler *server.Handler) {
+	cfg := handler.Config()
+	handler.BeginShutdown()
+
+	if delay := cfg.GetShutdownDelay(); delay > 0 {
+		slog.Info("Waiting before closing listener", "shutdown_delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+
+	timeout := cfg.GetShutdownTimeout()
+	slog.Info("Shutting down server", "shutdown_timeout", timeout, "active_requests", handler.ActiveRequests())
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := httpServer.Shutdown(ctx); err != nil {
+		slog.Warn("Graceful shutdown interrupted, closing remaining connections",
+			"error", err,
+			"active_requests", handler.ActiveRequests())
+		if err := httpServer.Close(); err != nil {
+			slog.Error("Failed to close server", "error", err)
+		}
+	}
 
-	slog.Info("Received shutdown signal", "signal", sig.String())
 	slog.Info("Server shutdown complete")
 }
+
+// reloadConfig loads and validates the configuration file and applies it to the
+// running handler. On any error the previous configuration stays live.
+func reloadConfig(handler *server.Handler, configPath string, reason string) {
+	slog.Info("Reloading configuration", "config_file", configPath, "reason", reason)
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		slog.Error("Failed to reload config, keeping previous configuration", "config_file", configPath, "error", err)
+		return
+	}
+
+	if err := handler.Reload(*cfg); err != nil {
+		slog.Error("Failed to apply config, keeping previous configuration", "config_file", configPath, "error", err)
+		return
+	}
+
+	if err := server.SetupLogger(cfg.Logging, version, cfg.TemplateValues()); err != nil {
+		slog.Error("Failed to setup logger, keeping previous logger", "error", err)
+	}
+}
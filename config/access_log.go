@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+const DEFAULT_ACCESS_LOG_FORMAT = "json"
+
+// AccessLogConfig controls the access log, one line per request emitted
+// through the application logger.
+type AccessLogConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Format       string   `yaml:"format"`
+	SampleRatio  *float64 `yaml:"sample_ratio"`
+	ExcludePaths []string `yaml:"exclude_paths"`
+}
+
+// GetFormat returns the access log format: "json", "common" or "combined".
+func (a *AccessLogConfig) GetFormat() string {
+	if a.Format == "" {
+		return DEFAULT_ACCESS_LOG_FORMAT
+	}
+	return strings.ToLower(a.Format)
+}
+
+// GetSampleRatio returns the ratio of successful requests that are logged.
+func (a *AccessLogConfig) GetSampleRatio() float64 {
+	if a.SampleRatio == nil {
+		return 1
+	}
+	return *a.SampleRatio
+}
+
+func validateAccessLogConfig(accessLog *AccessLogConfig) error {
+	switch accessLog.GetFormat() {
+	case "json", "common", "combined":
+	default:
+		return fmt.Errorf("invalid format '%s' (use 'json', 'common' or 'combined')", accessLog.Format)
+	}
+
+	if ratio := accessLog.GetSampleRatio(); ratio < 0 || ratio > 1 {
+		return fmt.Errorf("sample_ratio %v must be between 0 and 1", ratio)
+	}
+
+	for _, path := range accessLog.ExcludePaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("exclude path '%s' must start with '/'", path)
+		}
+	}
+	return nil
+}
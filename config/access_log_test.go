@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAccessLogConfig(t *testing.T) {
+	ratio := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name      string
+		accessLog AccessLogConfig
+		wantErr   bool
+	}{
+		{name: "defaults", accessLog: AccessLogConfig{Enabled: true}},
+		{name: "combined format", accessLog: AccessLogConfig{Format: "Combined"}},
+		{name: "sampling and exclusions", accessLog: AccessLogConfig{SampleRatio: ratio(0.5), ExcludePaths: []string{"/metrics"}}},
+		{name: "unknown format", accessLog: AccessLogConfig{Format: "apache"}, wantErr: true},
+		{name: "invalid sample ratio", accessLog: AccessLogConfig{SampleRatio: ratio(2)}, wantErr: true},
+		{name: "relative exclude path", accessLog: AccessLogConfig{ExcludePaths: []string{"metrics"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAccessLogConfig(&tt.accessLog)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Storages of cached responses.
+const (
+	CACHE_STORE_MEMORY = "memory"
+	CACHE_STORE_DISK   = "disk"
+)
+
+const (
+	DEFAULT_CACHE_STORE          = CACHE_STORE_MEMORY
+	DEFAULT_CACHE_MAX_SIZE       = 64 << 20 // 64MB
+	DEFAULT_CACHE_MAX_ENTRY_SIZE = 1 << 20  // 1MB
+)
+
+// CacheConfig selects and bounds the response cache shared by the endpoints
+// with caching enabled. The disk store keeps responses in the Path directory
+// so they survive restarts.
+type CacheConfig struct {
+	Store        string `yaml:"store"`
+	Path         string `yaml:"path"`
+	MaxSize      string `yaml:"max_size"`
+	MaxEntrySize string `yaml:"max_entry_size"`
+}
+
+func (c *CacheConfig) GetStore() string {
+	if c.Store == "" {
+		return DEFAULT_CACHE_STORE
+	}
+	return c.Store
+}
+
+// GetMaxSize returns the maximum size in bytes of the cached responses.
+func (c *CacheConfig) GetMaxSize() int64 {
+	return parseCacheSize(c.MaxSize, DEFAULT_CACHE_MAX_SIZE)
+}
+
+// GetMaxEntrySize returns the size in bytes of the largest response cached.
+func (c *CacheConfig) GetMaxEntrySize() int64 {
+	return parseCacheSize(c.MaxEntrySize, DEFAULT_CACHE_MAX_ENTRY_SIZE)
+}
+
+// EndpointCacheConfig enables caching of the GET and HEAD responses of an
+// endpoint. Responses are fresh for the time set by their Cache-Control or
+// Expires headers; TTL replaces it, DefaultTTL applies to responses without
+// one and MaxTTL caps it. KeyHeaders are request headers added to the cache
+// key, on top of the headers listed by the Vary header of responses.
+//
+// Once expired, responses can still be served for StaleWhileRevalidate while
+// they are refreshed in the background, and for StaleIfError when the
+// upstream fails (RFC 5861). The stale-while-revalidate and stale-if-error
+// directives of responses replace these windows.
+//
+// Expired responses with an ETag or Last-Modified header are revalidated with
+// a conditional request. GenerateETag adds a weak ETag to cached responses
+// without one, so clients can revalidate them too.
+type EndpointCacheConfig struct {
+	TTL                  string   `yaml:"ttl"`
+	DefaultTTL           string   `yaml:"default_ttl"`
+	MaxTTL               string   `yaml:"max_ttl"`
+	KeyHeaders           []string `yaml:"key_headers"`
+	StaleWhileRevalidate string   `yaml:"stale_while_revalidate"`
+	StaleIfError         string   `yaml:"stale_if_error"`
+	GenerateETag         bool     `yaml:"generate_etag"`
+}
+
+// GetTTL returns the freshness lifetime overriding the upstream one, 0 when
+// not configured.
+func (c *EndpointCacheConfig) GetTTL() time.Duration {
+	return parseCacheDuration(c.TTL)
+}
+
+// GetDefaultTTL returns the freshness lifetime of responses without caching
+// headers, 0 when they are not cached.
+func (c *EndpointCacheConfig) GetDefaultTTL() time.Duration {
+	return parseCacheDuration(c.DefaultTTL)
+}
+
+// GetMaxTTL returns the longest freshness lifetime, 0 for no limit.
+func (c *EndpointCacheConfig) GetMaxTTL() time.Duration {
+	return parseCacheDuration(c.MaxTTL)
+}
+
+// GetStaleWhileRevalidate returns for how long expired responses are served
+// while being refreshed, 0 when not configured.
+func (c *EndpointCacheConfig) GetStaleWhileRevalidate() time.Duration {
+	return parseCacheDuration(c.StaleWhileRevalidate)
+}
+
+// GetStaleIfError returns for how long expired responses are served when the
+// upstream fails, 0 when not configured.
+func (c *EndpointCacheConfig) GetStaleIfError() time.Duration {
+	return parseCacheDuration(c.StaleIfError)
+}
+
+func parseCacheSize(value string, fallback int64) int64 {
+	if value == "" {
+		return fallback
+	}
+	size, err := ParseSize(value)
+	if err != nil {
+		slog.Warn("Invalid cache size, using default", "value", value, "error", err)
+		return fallback
+	}
+	return size
+}
+
+func parseCacheDuration(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid cache duration", "value", value, "error", err)
+		return 0
+	}
+	return duration
+}
+
+func validateCacheConfig(cache *CacheConfig) error {
+	switch cache.GetStore() {
+	case CACHE_STORE_MEMORY:
+	case CACHE_STORE_DISK:
+		if cache.Path == "" {
+			return fmt.Errorf("path is required for the %s store", CACHE_STORE_DISK)
+		}
+	default:
+		return fmt.Errorf("invalid store '%s' (use '%s' or '%s')", cache.Store, CACHE_STORE_MEMORY, CACHE_STORE_DISK)
+	}
+	for name, value := range map[string]string{"max_size": cache.MaxSize, "max_entry_size": cache.MaxEntrySize} {
+		if value == "" {
+			continue
+		}
+		if _, err := ParseSize(value); err != nil {
+			return fmt.Errorf("invalid %s: %w (use format like '512KB', '64MB')", name, err)
+		}
+	}
+	if cache.GetMaxEntrySize() > cache.GetMaxSize() {
+		return fmt.Errorf("max_entry_size cannot be greater than max_size")
+	}
+	return nil
+}
+
+func validateEndpointCacheConfig(cache *EndpointCacheConfig) error {
+	durations := map[string]string{
+		"ttl":                    cache.TTL,
+		"default_ttl":            cache.DefaultTTL,
+		"max_ttl":                cache.MaxTTL,
+		"stale_while_revalidate": cache.StaleWhileRevalidate,
+		"stale_if_error":         cache.StaleIfError,
+	}
+	for name, value := range durations {
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': %w (use format like '30s', '5m')", name, value, err)
+		}
+		if duration < 0 {
+			return fmt.Errorf("%s cannot be negative, got '%s'", name, value)
+		}
+	}
+	for _, header := range cache.KeyHeaders {
+		if !validHeaderName(header) {
+			return fmt.Errorf("invalid key_headers entry '%s'", header)
+		}
+	}
+	return nil
+}
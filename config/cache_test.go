@@ -0,0 +1,87 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCacheConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   CacheConfig
+		wantErr bool
+	}{
+		{name: "defaults", cache: CacheConfig{}},
+		{name: "all settings", cache: CacheConfig{MaxSize: "256MB", MaxEntrySize: "4MB"}},
+		{name: "disk store", cache: CacheConfig{Store: "disk", Path: "/var/cache/corsair"}},
+		{name: "disk store without path", cache: CacheConfig{Store: "disk"}, wantErr: true},
+		{name: "invalid store", cache: CacheConfig{Store: "redis"}, wantErr: true},
+		{name: "invalid max size", cache: CacheConfig{MaxSize: "lots"}, wantErr: true},
+		{name: "invalid max entry size", cache: CacheConfig{MaxEntrySize: "-1KB"}, wantErr: true},
+		{name: "entry larger than cache", cache: CacheConfig{MaxSize: "1MB", MaxEntrySize: "2MB"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCacheConfig(&tt.cache)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateEndpointCacheConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   EndpointCacheConfig
+		wantErr bool
+	}{
+		{name: "defaults", cache: EndpointCacheConfig{}},
+		{
+			name:  "all settings",
+			cache: EndpointCacheConfig{TTL: "30s", DefaultTTL: "1m", MaxTTL: "1h", KeyHeaders: []string{"Accept-Language"}},
+		},
+		{name: "stale windows", cache: EndpointCacheConfig{StaleWhileRevalidate: "30s", StaleIfError: "1h"}},
+		{name: "generate etag", cache: EndpointCacheConfig{GenerateETag: true}},
+		{name: "invalid stale if error", cache: EndpointCacheConfig{StaleIfError: "1 day"}, wantErr: true},
+		{name: "invalid ttl", cache: EndpointCacheConfig{TTL: "soon"}, wantErr: true},
+		{name: "negative default ttl", cache: EndpointCacheConfig{DefaultTTL: "-1m"}, wantErr: true},
+		{name: "invalid key header", cache: EndpointCacheConfig{KeyHeaders: []string{"Bad Header"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEndpointCacheConfig(&tt.cache)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCacheConfigDefaults(t *testing.T) {
+	cache := CacheConfig{}
+	assert.Equal(t, CACHE_STORE_MEMORY, cache.GetStore())
+	assert.Equal(t, int64(DEFAULT_CACHE_MAX_SIZE), cache.GetMaxSize())
+	assert.Equal(t, int64(DEFAULT_CACHE_MAX_ENTRY_SIZE), cache.GetMaxEntrySize())
+
+	cache.MaxSize = "1GB"
+	assert.Equal(t, int64(1<<30), cache.GetMaxSize())
+
+	endpoint := EndpointCacheConfig{}
+	assert.Zero(t, endpoint.GetTTL())
+	assert.Zero(t, endpoint.GetDefaultTTL())
+	assert.Zero(t, endpoint.GetMaxTTL())
+	assert.Zero(t, endpoint.GetStaleWhileRevalidate())
+	assert.Zero(t, endpoint.GetStaleIfError())
+
+	endpoint.DefaultTTL = "5m"
+	assert.Equal(t, 5*time.Minute, endpoint.GetDefaultTTL())
+}
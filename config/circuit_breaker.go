@@ -0,0 +1,95 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DEFAULT_BREAKER_FAILURE_RATIO    = 0.5
+	DEFAULT_BREAKER_MIN_REQUESTS     = 20
+	DEFAULT_BREAKER_WINDOW           = 10 * time.Second
+	DEFAULT_BREAKER_OPEN_DURATION    = 30 * time.Second
+	DEFAULT_BREAKER_HALF_OPEN_PROBES = 1
+)
+
+// CircuitBreakerConfig configures the circuit breakers of the upstreams of an
+// endpoint. A breaker opens when the ratio of failed requests over a window
+// reaches FailureRatio, once MinRequests were sent. After OpenDuration, it
+// lets HalfOpenProbes requests through and closes when they all succeed.
+type CircuitBreakerConfig struct {
+	FailureRatio   *float64 `yaml:"failure_ratio"`
+	MinRequests    int      `yaml:"min_requests"`
+	Window         string   `yaml:"window"`
+	OpenDuration   string   `yaml:"open_duration"`
+	HalfOpenProbes int      `yaml:"half_open_probes"`
+}
+
+func (c *CircuitBreakerConfig) GetFailureRatio() float64 {
+	if c.FailureRatio == nil {
+		return DEFAULT_BREAKER_FAILURE_RATIO
+	}
+	return *c.FailureRatio
+}
+
+func (c *CircuitBreakerConfig) GetMinRequests() int {
+	if c.MinRequests == 0 {
+		return DEFAULT_BREAKER_MIN_REQUESTS
+	}
+	return c.MinRequests
+}
+
+// GetWindow returns the period over which failures are counted. Counts are
+// reset at the end of each window.
+func (c *CircuitBreakerConfig) GetWindow() time.Duration {
+	return parseBreakerDuration(c.Window, DEFAULT_BREAKER_WINDOW)
+}
+
+func (c *CircuitBreakerConfig) GetOpenDuration() time.Duration {
+	return parseBreakerDuration(c.OpenDuration, DEFAULT_BREAKER_OPEN_DURATION)
+}
+
+func (c *CircuitBreakerConfig) GetHalfOpenProbes() int {
+	if c.HalfOpenProbes == 0 {
+		return DEFAULT_BREAKER_HALF_OPEN_PROBES
+	}
+	return c.HalfOpenProbes
+}
+
+func parseBreakerDuration(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid circuit breaker duration", "value", value, "error", err)
+		return fallback
+	}
+	return duration
+}
+
+func validateCircuitBreakerConfig(breaker *CircuitBreakerConfig) error {
+	if ratio := breaker.GetFailureRatio(); ratio <= 0 || ratio > 1 {
+		return fmt.Errorf("failure_ratio must be in (0, 1], got %g", ratio)
+	}
+	if breaker.MinRequests < 0 {
+		return fmt.Errorf("min_requests cannot be negative, got %d", breaker.MinRequests)
+	}
+	if breaker.HalfOpenProbes < 0 {
+		return fmt.Errorf("half_open_probes cannot be negative, got %d", breaker.HalfOpenProbes)
+	}
+	for name, value := range map[string]string{"window": breaker.Window, "open_duration": breaker.OpenDuration} {
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': %w (use format like '10s', '1m')", name, value, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("%s must be positive, got '%s'", name, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCircuitBreakerConfig(t *testing.T) {
+	ratio := 0.25
+	zero := 0.0
+
+	tests := []struct {
+		name    string
+		breaker CircuitBreakerConfig
+		wantErr bool
+	}{
+		{name: "defaults", breaker: CircuitBreakerConfig{}},
+		{
+			name:    "all settings",
+			breaker: CircuitBreakerConfig{FailureRatio: &ratio, MinRequests: 5, Window: "1m", OpenDuration: "10s", HalfOpenProbes: 3},
+		},
+		{name: "zero failure ratio", breaker: CircuitBreakerConfig{FailureRatio: &zero}, wantErr: true},
+		{name: "negative min requests", breaker: CircuitBreakerConfig{MinRequests: -1}, wantErr: true},
+		{name: "negative probes", breaker: CircuitBreakerConfig{HalfOpenProbes: -1}, wantErr: true},
+		{name: "invalid window", breaker: CircuitBreakerConfig{Window: "forever"}, wantErr: true},
+		{name: "zero open duration", breaker: CircuitBreakerConfig{OpenDuration: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCircuitBreakerConfig(&tt.breaker)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerConfigDefaults(t *testing.T) {
+	breaker := CircuitBreakerConfig{}
+	assert.Equal(t, DEFAULT_BREAKER_FAILURE_RATIO, breaker.GetFailureRatio())
+	assert.Equal(t, DEFAULT_BREAKER_MIN_REQUESTS, breaker.GetMinRequests())
+	assert.Equal(t, DEFAULT_BREAKER_WINDOW, breaker.GetWindow())
+	assert.Equal(t, DEFAULT_BREAKER_OPEN_DURATION, breaker.GetOpenDuration())
+	assert.Equal(t, DEFAULT_BREAKER_HALF_OPEN_PROBES, breaker.GetHalfOpenProbes())
+
+	breaker.OpenDuration = "1m"
+	assert.Equal(t, time.Minute, breaker.GetOpenDuration())
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const DEFAULT_COALESCE_MAX_BUFFER_SIZE = 1 << 20 // 1MB
+
+// DEFAULT_COALESCE_KEY_HEADERS are the request headers keying coalesced
+// requests when none are configured, so responses depending on the client
+// or its credentials are not shared.
+var DEFAULT_COALESCE_KEY_HEADERS = []string{"Accept", "Accept-Encoding", "Accept-Language", "Authorization", "Cookie"}
+
+// CoalesceConfig shares the upstream response of a GET or HEAD request with
+// the identical requests received while it is in flight. Requests are
+// identical when they have the same method, URL and values of KeyHeaders.
+//
+// The response is streamed to all clients as it is received. MaxBufferSize
+// bounds the part of the response kept for the slowest clients, the upstream
+// response is read no faster than they receive it beyond that.
+type CoalesceConfig struct {
+	KeyHeaders    []string `yaml:"key_headers"`
+	MaxBufferSize string   `yaml:"max_buffer_size"`
+}
+
+// GetKeyHeaders returns the request headers that must match for requests to
+// be coalesced.
+func (c *CoalesceConfig) GetKeyHeaders() []string {
+	if c.KeyHeaders == nil {
+		return DEFAULT_COALESCE_KEY_HEADERS
+	}
+	return c.KeyHeaders
+}
+
+// GetMaxBufferSize returns the maximum size in bytes of the response part
+// not yet received by all clients.
+func (c *CoalesceConfig) GetMaxBufferSize() int64 {
+	if c.MaxBufferSize == "" {
+		return DEFAULT_COALESCE_MAX_BUFFER_SIZE
+	}
+	size, err := ParseSize(c.MaxBufferSize)
+	if err != nil {
+		slog.Warn("Invalid coalesce max_buffer_size, using default", "max_buffer_size", c.MaxBufferSize, "error", err)
+		return DEFAULT_COALESCE_MAX_BUFFER_SIZE
+	}
+	return size
+}
+
+func validateCoalesceConfig(coalesce *CoalesceConfig) error {
+	for _, header := range coalesce.KeyHeaders {
+		if !validHeaderName(header) {
+			return fmt.Errorf("invalid key_headers entry '%s'", header)
+		}
+	}
+	if coalesce.MaxBufferSize != "" {
+		size, err := ParseSize(coalesce.MaxBufferSize)
+		if err != nil {
+			return fmt.Errorf("invalid max_buffer_size: %w (use format like '64KB', '1MB')", err)
+		}
+		if size == 0 {
+			return fmt.Errorf("max_buffer_size must be positive")
+		}
+	}
+	return nil
+}
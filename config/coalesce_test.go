@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCoalesceConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		coalesce CoalesceConfig
+		wantErr  bool
+	}{
+		{name: "defaults", coalesce: CoalesceConfig{}},
+		{name: "all settings", coalesce: CoalesceConfig{KeyHeaders: []string{"Authorization"}, MaxBufferSize: "256KB"}},
+		{name: "url only", coalesce: CoalesceConfig{KeyHeaders: []string{}}},
+		{name: "invalid key header", coalesce: CoalesceConfig{KeyHeaders: []string{"Bad Header"}}, wantErr: true},
+		{name: "invalid max buffer size", coalesce: CoalesceConfig{MaxBufferSize: "lots"}, wantErr: true},
+		{name: "zero max buffer size", coalesce: CoalesceConfig{MaxBufferSize: "0KB"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCoalesceConfig(&tt.coalesce)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCoalesceConfigDefaults(t *testing.T) {
+	coalesce := CoalesceConfig{}
+	assert.Equal(t, DEFAULT_COALESCE_KEY_HEADERS, coalesce.GetKeyHeaders())
+	assert.Equal(t, int64(DEFAULT_COALESCE_MAX_BUFFER_SIZE), coalesce.GetMaxBufferSize())
+
+	coalesce = CoalesceConfig{KeyHeaders: []string{}, MaxBufferSize: "64KB"}
+	assert.Empty(t, coalesce.GetKeyHeaders())
+	assert.Equal(t, int64(64<<10), coalesce.GetMaxBufferSize())
+}
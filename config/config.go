@@ -4,49 +4,100 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"slices"
+	"strings"
 	"time"
 
 	"github.com/goccy/go-yaml"
 )
 
 const (
-	DEFAULT_TIMEOUT = 10 * time.Second
-	DEFAULT_PATH    = "/etc/corsair/config.yaml"
+	DEFAULT_TIMEOUT        = 10 * time.Second
+	DEFAULT_PATH           = "/etc/corsair/config.yaml"
+	DEFAULT_WATCH_INTERVAL = 5 * time.Second
+	DEFAULT_SHUTDOWN       = 30 * time.Second
+	DEFAULT_SHUTDOWN_DELAY = 5 * time.Second
+	DEFAULT_METRICS_PATH   = "/metrics"
+	DEFAULT_REQUEST_ID     = "X-Request-ID"
 )
 
 type Config struct {
-	Server    ServerConfig  `yaml:"server"`
-	CORS      CORSConfig    `yaml:"cors"`
-	Logging   LoggingConfig `yaml:"logging"`
-	Endpoints []Endpoint    `yaml:"endpoints"`
+	Server      ServerConfig      `yaml:"server"`
+	CORS        CORSConfig        `yaml:"cors"`
+	Logging     LoggingConfig     `yaml:"logging"`
+	Transport   TransportConfig   `yaml:"transport"`
+	RetryBudget RetryBudgetConfig `yaml:"retry_budget"`
+	Cache       CacheConfig       `yaml:"cache"`
+	Metrics     MetricsConfig     `yaml:"metrics"`
+	Tracing     TracingConfig     `yaml:"tracing"`
+	Endpoints   []Endpoint        `yaml:"endpoints"`
 }
 
 type ServerConfig struct {
-	Address                string `yaml:"address"`
-	Port                   int    `yaml:"port"`
-	ForwardEndpointEnabled *bool  `yaml:"forward_endpoint_enabled"`
-	DefaultTimeout         string `yaml:"default_timeout"`
+	Address                string        `yaml:"address"`
+	Port                   int           `yaml:"port"`
+	ForwardEndpointEnabled *bool         `yaml:"forward_endpoint_enabled"`
+	DefaultTimeout         string        `yaml:"default_timeout"`
+	ConfigWatchInterval    string        `yaml:"config_watch_interval"`
+	ShutdownTimeout        string        `yaml:"shutdown_timeout"`
+	ShutdownDelay          string        `yaml:"shutdown_delay"`
+	RequestIDHeader        string        `yaml:"request_id_header"`
+	Forward                ForwardConfig `yaml:"forward"`
+	Probes                 ProbesConfig  `yaml:"probes"`
 }
 
-type CORSConfig struct {
-	Origins     []string `yaml:"allow_origins"`
-	Methods     string   `yaml:"allow_methods"`
-	Headers     string   `yaml:"allow_headers"`
-	Credentials bool     `yaml:"allow_credentials"`
+type LoggingConfig struct {
+	Level     string          `yaml:"level"`
+	Format    string          `yaml:"format"`
+	AccessLog AccessLogConfig `yaml:"access_log"`
+	Redact    RedactConfig    `yaml:"redact"`
 }
 
-type LoggingConfig struct {
-	Level  string `yaml:"level"`
-	Format string `yaml:"format"`
+// RedactConfig lists query parameters and headers whose values are masked in
+// logs, in addition to the built-in sensitive names.
+type RedactConfig struct {
+	QueryParams []string `yaml:"query_params"`
+	Headers     []string `yaml:"headers"`
+}
+
+// MetricsConfig controls the Prometheus metrics endpoint. Metrics are served
+// on the main listener unless a dedicated port is configured.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"`
+	Address string `yaml:"address"`
+	Port    int    `yaml:"port"`
+}
+
+// GetPath returns the path metrics are served on.
+func (m *MetricsConfig) GetPath() string {
+	if m.Path == "" {
+		return DEFAULT_METRICS_PATH
+	}
+	return m.Path
+}
+
+// SeparateListener reports whether metrics are served on a dedicated listener.
+func (m *MetricsConfig) SeparateListener() bool {
+	return m.Port != 0
 }
 
 type Endpoint struct {
-	Path        string              `yaml:"path"`
-	RemoteURL   string              `yaml:"remote_url"`
-	Headers     []map[string]string `yaml:"headers"`
-	QueryParams []map[string]string `yaml:"query_params"`
-	Timeout     string              `yaml:"timeout"`
+	Path           string                `yaml:"path"`
+	RemoteURL      string                `yaml:"remote_url"`
+	RemoteURLs     []string              `yaml:"remote_urls"`
+	Upstreams      []UpstreamConfig      `yaml:"upstreams"`
+	LoadBalancing  LoadBalancingConfig   `yaml:"load_balancing"`
+	Headers        []map[string]string   `yaml:"headers"`
+	QueryParams    []map[string]string   `yaml:"query_params"`
+	Timeout        string                `yaml:"timeout"`
+	Transport      TransportConfig       `yaml:"transport"`
+	CORS           *CORSOverride         `yaml:"cors"`
+	HealthCheck    *HealthCheckConfig    `yaml:"health_check"`
+	Failover       *FailoverConfig       `yaml:"failover"`
+	Retry          *RetryConfig          `yaml:"retry"`
+	CircuitBreaker *CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Cache          *EndpointCacheConfig  `yaml:"cache"`
+	Coalesce       *CoalesceConfig       `yaml:"coalesce"`
 }
 
 func LoadConfig(filename string) (*Config, error) {
@@ -86,39 +137,132 @@ func validateConfig(config *Config) error {
 		return fmt.Errorf("timeout configuration invalid: %w", err)
 	}
 
+	if header := config.Server.RequestIDHeader; header != "" && !validHeaderName(header) {
+		return fmt.Errorf("invalid request_id_header '%s'", header)
+	}
+
+	// Validate forward endpoint configuration
+	if err := validateForwardConfig(&config.Server.Forward); err != nil {
+		return fmt.Errorf("forward configuration invalid: %w", err)
+	}
+	if config.Server.Forward.CORS != nil {
+		effective := config.GetForwardCORS()
+		if err := validateCORSConfig(&effective); err != nil {
+			return fmt.Errorf("forward CORS configuration invalid: %w", err)
+		}
+	}
+
+	// Validate access log configuration
+	if err := validateAccessLogConfig(&config.Logging.AccessLog); err != nil {
+		return fmt.Errorf("access log configuration invalid: %w", err)
+	}
+
+	// Validate metrics configuration
+	if config.Metrics.Path != "" && !strings.HasPrefix(config.Metrics.Path, "/") {
+		return fmt.Errorf("metrics path '%s' must start with '/'", config.Metrics.Path)
+	}
+	if config.Metrics.Port < 0 || config.Metrics.Port > 65535 {
+		return fmt.Errorf("metrics port %d is out of range", config.Metrics.Port)
+	}
+	// Configured endpoints are never dropped in favor of the metrics endpoint
+	if config.Metrics.Enabled && !config.Metrics.SeparateListener() {
+		metricsPath := strings.TrimSuffix(config.Metrics.GetPath(), "/")
+		for i, endpoint := range config.Endpoints {
+			if strings.TrimSuffix(endpoint.Path, "/") == metricsPath {
+				return fmt.Errorf("metrics path '%s' is already used by endpoint %d, change one of the paths or serve metrics on a separate port", config.Metrics.GetPath(), i)
+			}
+		}
+	}
+
+	// Validate probes configuration
+	if err := validateProbesConfig(config); err != nil {
+		return fmt.Errorf("probes configuration invalid: %w", err)
+	}
+
+	// Validate tracing configuration
+	if err := validateTracingConfig(&config.Tracing); err != nil {
+		return fmt.Errorf("tracing configuration invalid: %w", err)
+	}
+
+	// Validate transport configuration
+	if err := validateTransportConfig(&config.Transport); err != nil {
+		return fmt.Errorf("transport configuration invalid: %w", err)
+	}
+
+	// Validate cache configuration
+	if err := validateCacheConfig(&config.Cache); err != nil {
+		return fmt.Errorf("cache configuration invalid: %w", err)
+	}
+
+	// Validate retry budget configuration
+	if err := validateRetryBudgetConfig(&config.RetryBudget); err != nil {
+		return fmt.Errorf("retry budget configuration invalid: %w", err)
+	}
+
 	// Validate endpoints
+	paths := make(map[string]int, len(config.Endpoints))
 	for i, endpoint := range config.Endpoints {
 		if endpoint.Path == "" {
 			return fmt.Errorf("endpoint %d: path cannot be empty", i)
 		}
-		if endpoint.RemoteURL == "" {
-			return fmt.Errorf("endpoint %d: remote_url cannot be empty", i)
+		if err := validateUpstreams(&endpoint); err != nil {
+			return fmt.Errorf("endpoint %d: %w", i, err)
 		}
-	}
-	return nil
-}
 
-func (c *CORSConfig) WildcardOriginAllowed() bool {
-	return slices.Contains(c.Origins, "*")
-}
+		if endpoint.CORS != nil {
+			effective := config.GetEffectiveCORS(endpoint)
+			if err := validateCORSConfig(&effective); err != nil {
+				return fmt.Errorf("endpoint %d: CORS configuration invalid: %w", i, err)
+			}
+		}
 
-func (c *CORSConfig) HasAnyConfiguration() bool {
-	return len(c.Origins) > 0 || c.Methods != "" || c.Headers != "" || c.Credentials
-}
+		if err := validateTransportConfig(&endpoint.Transport); err != nil {
+			return fmt.Errorf("endpoint %d: transport configuration invalid: %w", i, err)
+		}
 
-func validateCORSConfig(corsConfig *CORSConfig) error {
-	hasWildcard := corsConfig.WildcardOriginAllowed()
+		if endpoint.HealthCheck != nil {
+			if err := validateHealthCheckConfig(endpoint.HealthCheck); err != nil {
+				return fmt.Errorf("endpoint %d: health check configuration invalid: %w", i, err)
+			}
+		}
 
-	// Check for CORS spec violation: wildcard origins with credentials
-	if corsConfig.Credentials && hasWildcard {
-		return fmt.Errorf("allow_origins cannot contain '*' when allow_credentials is true - this violates CORS specification and browsers will reject requests")
-	}
+		if endpoint.Failover != nil {
+			if err := validateFailoverConfig(endpoint.Failover); err != nil {
+				return fmt.Errorf("endpoint %d: failover configuration invalid: %w", i, err)
+			}
+		}
 
-	// Check for invalid wildcard usage: '*' must be the only origin when used
-	if hasWildcard && len(corsConfig.Origins) > 1 {
-		return fmt.Errorf("allow_origins: '*' wildcard must be the only origin when used, cannot be mixed with specific origins")
-	}
+		if endpoint.Retry != nil {
+			if err := validateRetryConfig(endpoint.Retry); err != nil {
+				return fmt.Errorf("endpoint %d: retry configuration invalid: %w", i, err)
+			}
+		}
+
+		if endpoint.CircuitBreaker != nil {
+			if err := validateCircuitBreakerConfig(endpoint.CircuitBreaker); err != nil {
+				return fmt.Errorf("endpoint %d: circuit breaker configuration invalid: %w", i, err)
+			}
+		}
+
+		if endpoint.Cache != nil {
+			if err := validateEndpointCacheConfig(endpoint.Cache); err != nil {
+				return fmt.Errorf("endpoint %d: cache configuration invalid: %w", i, err)
+			}
+		}
+
+		if endpoint.Coalesce != nil {
+			if err := validateCoalesceConfig(endpoint.Coalesce); err != nil {
+				return fmt.Errorf("endpoint %d: coalesce configuration invalid: %w", i, err)
+			}
+		}
 
+		// Paths are registered with a trailing slash, so "/api" and "/api/" collide.
+		normalized := strings.TrimSuffix(endpoint.Path, "/") + "/"
+		if previous, exists := paths[normalized]; exists {
+			return fmt.Errorf("endpoint %d: path '%s' is already used by endpoint %d", i, endpoint.Path, previous)
+		}
+		paths[normalized] = i
+	}
 	return nil
 }
 
@@ -130,6 +274,24 @@ func validateTimeoutConfig(config *Config) error {
 		}
 	}
 
+	if config.Server.ConfigWatchInterval != "" {
+		if _, err := time.ParseDuration(config.Server.ConfigWatchInterval); err != nil {
+			return fmt.Errorf("invalid server config_watch_interval '%s': %w (use format like '5s', '1m', or '0s' to disable)", config.Server.ConfigWatchInterval, err)
+		}
+	}
+
+	if config.Server.ShutdownTimeout != "" {
+		if _, err := time.ParseDuration(config.Server.ShutdownTimeout); err != nil {
+			return fmt.Errorf("invalid server shutdown_timeout '%s': %w (use format like '30s', '1m')", config.Server.ShutdownTimeout, err)
+		}
+	}
+
+	if config.Server.ShutdownDelay != "" {
+		if _, err := time.ParseDuration(config.Server.ShutdownDelay); err != nil {
+			return fmt.Errorf("invalid server shutdown_delay '%s': %w (use format like '5s', '10s')", config.Server.ShutdownDelay, err)
+		}
+	}
+
 	// Validate endpoint timeouts
 	for i, endpoint := range config.Endpoints {
 		if endpoint.Timeout != "" {
@@ -151,6 +313,70 @@ func (c *Config) GetDefaultTimeout() time.Duration {
 	return timeout
 }
 
+// GetConfigWatchInterval returns how often the configuration file is checked for changes.
+// A zero duration means file watching is disabled.
+func (c *Config) GetConfigWatchInterval() time.Duration {
+	if c.Server.ConfigWatchInterval == "" {
+		return DEFAULT_WATCH_INTERVAL
+	}
+
+	interval, err := time.ParseDuration(c.Server.ConfigWatchInterval)
+	if err != nil {
+		slog.Warn("Invalid config watch interval", "configured_interval", c.Server.ConfigWatchInterval, "error", err)
+		return DEFAULT_WATCH_INTERVAL
+	}
+	return interval
+}
+
+// GetShutdownTimeout returns how long in-flight requests are given to complete
+// during shutdown before remaining connections are forcibly closed.
+func (c *Config) GetShutdownTimeout() time.Duration {
+	if c.Server.ShutdownTimeout == "" {
+		return DEFAULT_SHUTDOWN
+	}
+
+	timeout, err := time.ParseDuration(c.Server.ShutdownTimeout)
+	if err != nil {
+		slog.Warn("Invalid shutdown timeout", "configured_timeout", c.Server.ShutdownTimeout, "error", err)
+		return DEFAULT_SHUTDOWN
+	}
+	return timeout
+}
+
+// GetShutdownDelay returns how long the server keeps accepting connections after
+// being marked as not ready, giving load balancers time to stop routing traffic.
+// Set it to 0s when nothing routes traffic based on readiness.
+func (c *Config) GetShutdownDelay() time.Duration {
+	if c.Server.ShutdownDelay == "" {
+		return DEFAULT_SHUTDOWN_DELAY
+	}
+
+	delay, err := time.ParseDuration(c.Server.ShutdownDelay)
+	if err != nil {
+		slog.Warn("Invalid shutdown delay", "configured_delay", c.Server.ShutdownDelay, "error", err)
+		return DEFAULT_SHUTDOWN_DELAY
+	}
+	return delay
+}
+
+// GetRequestIDHeader returns the header carrying the request ID.
+func (c *Config) GetRequestIDHeader() string {
+	if c.Server.RequestIDHeader == "" {
+		return DEFAULT_REQUEST_ID
+	}
+	return c.Server.RequestIDHeader
+}
+
+// validHeaderName reports whether name is a valid HTTP header field name (RFC 9110 token).
+func validHeaderName(name string) bool {
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return name != ""
+}
+
 // GetEffectiveTimeout returns the timeout duration for an endpoint, using endpoint-specific timeout if set, otherwise the global default
 func (c *Config) GetEffectiveTimeout(endpoint Endpoint) time.Duration {
 	timeoutStr := endpoint.Timeout
@@ -268,6 +268,66 @@ func TestValidateConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "duplicate endpoint paths",
+			config: &Config{
+				Endpoints: []Endpoint{
+					{Path: "/test", RemoteURL: "http://example.com"},
+					{Path: "/test/", RemoteURL: "http://other.example.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid config watch interval",
+			config: &Config{
+				Server: ServerConfig{ConfigWatchInterval: "often"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "custom request ID header",
+			config: &Config{
+				Server: ServerConfig{RequestIDHeader: "X-Correlation-ID"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid request ID header",
+			config: &Config{
+				Server: ServerConfig{RequestIDHeader: "X Request ID"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "endpoint using the metrics path",
+			config: &Config{
+				Metrics: MetricsConfig{Enabled: true},
+				Endpoints: []Endpoint{
+					{Path: "/metrics/", RemoteURL: "http://example.com"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "endpoint using the path of metrics on a separate port",
+			config: &Config{
+				Metrics: MetricsConfig{Enabled: true, Port: 9090},
+				Endpoints: []Endpoint{
+					{Path: "/metrics", RemoteURL: "http://example.com"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "endpoint using the path of disabled metrics",
+			config: &Config{
+				Endpoints: []Endpoint{
+					{Path: "/metrics", RemoteURL: "http://example.com"},
+				},
+			},
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,278 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+const DEFAULT_CORS_MAX_AGE = 24 * time.Hour
+
+type CORSConfig struct {
+	Origins       []string `yaml:"allow_origins"`
+	Methods       string   `yaml:"allow_methods"`
+	Headers       string   `yaml:"allow_headers"`
+	Credentials   bool     `yaml:"allow_credentials"`
+	ExposeHeaders string   `yaml:"expose_headers"`
+	MaxAge        string   `yaml:"max_age"`
+	// Enforce rejects requests from disallowed origins before they reach the
+	// upstream, instead of only omitting the CORS headers.
+	Enforce            bool `yaml:"enforce"`
+	AllowMissingOrigin bool `yaml:"allow_missing_origin"`
+	RefererFallback    bool `yaml:"referer_fallback"`
+}
+
+func (c *CORSConfig) WildcardOriginAllowed() bool {
+	return slices.Contains(c.Origins, "*")
+}
+
+func (c *CORSConfig) HasAnyConfiguration() bool {
+	return len(c.Origins) > 0 || c.Methods != "" || c.Headers != "" || c.Credentials || c.ExposeHeaders != ""
+}
+
+// GetMaxAge returns how long browsers may cache preflight responses.
+func (c *CORSConfig) GetMaxAge() time.Duration {
+	if c.MaxAge == "" {
+		return DEFAULT_CORS_MAX_AGE
+	}
+
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		slog.Warn("Invalid CORS max age", "configured_max_age", c.MaxAge, "error", err)
+		return DEFAULT_CORS_MAX_AGE
+	}
+	return maxAge
+}
+
+// CORSOverride replaces parts of the global CORS policy for a single endpoint.
+// Fields left unset keep their global value, unless Inherit is false in which
+// case the global policy is ignored and only this block applies.
+type CORSOverride struct {
+	Inherit       *bool    `yaml:"inherit"`
+	Origins       []string `yaml:"allow_origins"`
+	Methods       *string  `yaml:"allow_methods"`
+	Headers       *string  `yaml:"allow_headers"`
+	Credentials   *bool    `yaml:"allow_credentials"`
+	ExposeHeaders *string  `yaml:"expose_headers"`
+	MaxAge        *string  `yaml:"max_age"`
+
+	Enforce            *bool `yaml:"enforce"`
+	AllowMissingOrigin *bool `yaml:"allow_missing_origin"`
+	RefererFallback    *bool `yaml:"referer_fallback"`
+}
+
+// Apply returns the CORS policy resulting from applying the override on base.
+func (o *CORSOverride) Apply(base CORSConfig) CORSConfig {
+	if o == nil {
+		return base
+	}
+
+	result := base
+	if o.Inherit != nil && !*o.Inherit {
+		result = CORSConfig{}
+	}
+
+	if o.Origins != nil {
+		result.Origins = o.Origins
+	}
+	if o.Methods != nil {
+		result.Methods = *o.Methods
+	}
+	if o.Headers != nil {
+		result.Headers = *o.Headers
+	}
+	if o.Credentials != nil {
+		result.Credentials = *o.Credentials
+	}
+	if o.ExposeHeaders != nil {
+		result.ExposeHeaders = *o.ExposeHeaders
+	}
+	if o.MaxAge != nil {
+		result.MaxAge = *o.MaxAge
+	}
+	if o.Enforce != nil {
+		result.Enforce = *o.Enforce
+	}
+	if o.AllowMissingOrigin != nil {
+		result.AllowMissingOrigin = *o.AllowMissingOrigin
+	}
+	if o.RefererFallback != nil {
+		result.RefererFallback = *o.RefererFallback
+	}
+	return result
+}
+
+// GetEffectiveCORS returns the CORS policy of an endpoint, the global policy
+// with the endpoint overrides applied.
+func (c *Config) GetEffectiveCORS(endpoint Endpoint) CORSConfig {
+	return endpoint.CORS.Apply(c.CORS)
+}
+
+// GetForwardCORS returns the CORS policy of the /forward endpoint.
+func (c *Config) GetForwardCORS() CORSConfig {
+	return c.Server.Forward.CORS.Apply(c.CORS)
+}
+
+func validateCORSConfig(corsConfig *CORSConfig) error {
+	hasWildcard := corsConfig.WildcardOriginAllowed()
+
+	// Check for CORS spec violation: wildcard origins with credentials
+	if corsConfig.Credentials && hasWildcard {
+		return fmt.Errorf("allow_origins cannot contain '*' when allow_credentials is true - this violates CORS specification and browsers will reject requests")
+	}
+
+	// Check for invalid wildcard usage: '*' must be the only origin when used
+	if hasWildcard && len(corsConfig.Origins) > 1 {
+		return fmt.Errorf("allow_origins: '*' wildcard must be the only origin when used, cannot be mixed with specific origins")
+	}
+
+	// Enforcement without any allowed origin would reject every request
+	if corsConfig.Enforce && len(corsConfig.Origins) == 0 {
+		return fmt.Errorf("enforce requires allow_origins to be configured")
+	}
+
+	if _, err := ParseOriginPatterns(corsConfig.Origins); err != nil {
+		return fmt.Errorf("allow_origins: %w", err)
+	}
+
+	if corsConfig.MaxAge != "" {
+		if _, err := time.ParseDuration(corsConfig.MaxAge); err != nil {
+			return fmt.Errorf("invalid max_age '%s': %w (use format like '10m', '24h')", corsConfig.MaxAge, err)
+		}
+	}
+
+	return nil
+}
+
+const regexOriginPrefix = "regex:"
+
+// OriginPattern matches request origins. Supported patterns are:
+//   - "*": any origin
+//   - "https://app.example.com": exact origin
+//   - "https://*.example.com": any subdomain, scheme must match
+//   - "*.example.com" or "example.com": https only, so a subdomain cannot be
+//     allowed over plain http by mistake; write "http://" to allow http
+//   - "http://localhost:*": any port
+//   - "regex:^https://app-[a-z]+\.example\.com$": regular expression, always anchored
+//
+// Without an explicit port, only the default port of the scheme matches.
+type OriginPattern struct {
+	raw    string
+	any    bool
+	scheme string // http or https
+	host   string // lowercase, may start with "*." for subdomains
+	port   string // empty for the scheme default port, "*" for any port
+	regex  *regexp.Regexp
+}
+
+// ParseOriginPattern compiles an origin pattern as used in allow_origins.
+func ParseOriginPattern(pattern string) (OriginPattern, error) {
+	result := OriginPattern{raw: pattern}
+	pattern = strings.TrimSpace(pattern)
+
+	if pattern == "*" {
+		result.any = true
+		return result, nil
+	}
+
+	if expr, ok := strings.CutPrefix(pattern, regexOriginPrefix); ok {
+		regex, err := regexp.Compile(`^(?:` + expr + `)$`)
+		if err != nil {
+			return OriginPattern{}, fmt.Errorf("invalid regular expression: %w", err)
+		}
+		result.regex = regex
+		return result, nil
+	}
+
+	hostPort := pattern
+	result.scheme = "https"
+	if scheme, rest, ok := strings.Cut(pattern, "://"); ok {
+		result.scheme = strings.ToLower(scheme)
+		if result.scheme != "http" && result.scheme != "https" {
+			return OriginPattern{}, fmt.Errorf("unsupported scheme '%s' (use http or https)", scheme)
+		}
+		hostPort = rest
+	}
+	if strings.Contains(hostPort, "/") {
+		return OriginPattern{}, fmt.Errorf("origin must not contain a path")
+	}
+
+	result.host = hostPort
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		result.host, result.port = host, port
+		if port == "" {
+			return OriginPattern{}, fmt.Errorf("port cannot be empty")
+		}
+	}
+	result.host = strings.ToLower(result.host)
+	if result.port == defaultPort(result.scheme) {
+		result.port = ""
+	}
+
+	domain := strings.TrimPrefix(result.host, "*.")
+	if domain == "" || strings.Contains(domain, "*") {
+		return OriginPattern{}, fmt.Errorf("invalid host '%s' (use 'example.com' or '*.example.com')", result.host)
+	}
+
+	return result, nil
+}
+
+// ParseOriginPatterns compiles a list of origin patterns.
+func ParseOriginPatterns(patterns []string) ([]OriginPattern, error) {
+	result := make([]OriginPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		parsed, err := ParseOriginPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid origin pattern '%s': %w", pattern, err)
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// Matches reports whether the origin header value matches the pattern.
+func (p OriginPattern) Matches(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.any {
+		return true
+	}
+	if p.regex != nil {
+		return p.regex.MatchString(origin)
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+
+	scheme := strings.ToLower(parsed.Scheme)
+	if scheme != p.scheme {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if domain, ok := strings.CutPrefix(p.host, "*."); ok {
+		if !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	} else if host != p.host {
+		return false
+	}
+
+	port := parsed.Port()
+	if port == defaultPort(scheme) {
+		port = ""
+	}
+	return p.port == "*" || port == p.port
+}
+
+func (p OriginPattern) String() string {
+	return p.raw
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORSOverrideApply(t *testing.T) {
+	global := CORSConfig{
+		Origins:     []string{"https://app.example.com"},
+		Methods:     "GET, POST",
+		Headers:     "Content-Type",
+		Credentials: true,
+	}
+	enabled, disabled := true, false
+	wildcardHeaders := "*"
+
+	tests := []struct {
+		name     string
+		override *CORSOverride
+		expected CORSConfig
+	}{
+		{
+			name:     "no override uses global policy",
+			override: nil,
+			expected: global,
+		},
+		{
+			name: "partial override",
+			override: &CORSOverride{
+				Origins:     []string{"*"},
+				Credentials: &disabled,
+			},
+			expected: CORSConfig{
+				Origins:     []string{"*"},
+				Methods:     "GET, POST",
+				Headers:     "Content-Type",
+				Credentials: false,
+			},
+		},
+		{
+			name: "full override",
+			override: &CORSOverride{
+				Inherit: &disabled,
+				Origins: []string{"*"},
+				Headers: &wildcardHeaders,
+			},
+			expected: CORSConfig{
+				Origins: []string{"*"},
+				Headers: "*",
+			},
+		},
+		{
+			name: "explicit inherit",
+			override: &CORSOverride{
+				Inherit: &enabled,
+				Headers: &wildcardHeaders,
+			},
+			expected: CORSConfig{
+				Origins:     []string{"https://app.example.com"},
+				Methods:     "GET, POST",
+				Headers:     "*",
+				Credentials: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.override.Apply(global))
+		})
+	}
+}
+
+func TestEndpointCORSValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{
+			name: "valid endpoint overrides",
+			content: `
+cors:
+  allow_origins: ["https://app.example.com"]
+  allow_credentials: true
+server:
+  forward:
+    cors:
+      inherit: false
+      allow_origins: ["*"]
+endpoints:
+  - path: /public
+    remote_url: http://example.com
+    cors:
+      allow_origins: ["*"]
+      allow_credentials: false
+  - path: /private
+    remote_url: http://example.com
+`,
+			wantErr: false,
+		},
+		{
+			name: "wildcard override with inherited credentials",
+			content: `
+cors:
+  allow_origins: ["https://app.example.com"]
+  allow_credentials: true
+endpoints:
+  - path: /public
+    remote_url: http://example.com
+    cors:
+      allow_origins: ["*"]
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid forward override",
+			content: `
+server:
+  forward:
+    cors:
+      allow_origins: ["*", "https://app.example.com"]
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile, err := os.CreateTemp("", "config-test-*.yaml")
+			require.NoError(t, err)
+			defer os.Remove(tmpFile.Name())
+
+			_, err = tmpFile.WriteString(tt.content)
+			require.NoError(t, err)
+			tmpFile.Close()
+
+			cfg, err := LoadConfig(tmpFile.Name())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, []string{"*"}, cfg.GetEffectiveCORS(cfg.Endpoints[0]).Origins)
+			assert.False(t, cfg.GetEffectiveCORS(cfg.Endpoints[0]).Credentials)
+			assert.Equal(t, cfg.CORS, cfg.GetEffectiveCORS(cfg.Endpoints[1]))
+			assert.Equal(t, CORSConfig{Origins: []string{"*"}}, cfg.GetForwardCORS())
+		})
+	}
+}
+
+func TestCORSMaxAge(t *testing.T) {
+	assert.Equal(t, DEFAULT_CORS_MAX_AGE, (&CORSConfig{}).GetMaxAge())
+	assert.Equal(t, 10*time.Minute, (&CORSConfig{MaxAge: "10m"}).GetMaxAge())
+
+	assert.NoError(t, validateCORSConfig(&CORSConfig{MaxAge: "1h"}))
+	assert.Error(t, validateCORSConfig(&CORSConfig{MaxAge: "one day"}))
+}
+
+func TestOriginPatternMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		origin   string
+		expected bool
+	}{
+		{name: "global wildcard", pattern: "*", origin: "https://anything.org", expected: true},
+		{name: "exact origin", pattern: "https://app.example.com", origin: "https://app.example.com", expected: true},
+		{name: "exact origin case insensitive", pattern: "https://App.Example.com", origin: "https://app.example.com", expected: true},
+		{name: "exact origin other scheme", pattern: "https://app.example.com", origin: "http://app.example.com", expected: false},
+		{name: "exact origin explicit default port", pattern: "https://app.example.com:443", origin: "https://app.example.com", expected: true},
+		{name: "exact origin with port", pattern: "http://localhost:3000", origin: "http://localhost:3000", expected: true},
+		{name: "exact origin other port", pattern: "http://localhost:3000", origin: "http://localhost:3001", expected: false},
+		{name: "exact origin missing port", pattern: "http://localhost:3000", origin: "http://localhost", expected: false},
+		{name: "port wildcard", pattern: "http://localhost:*", origin: "http://localhost:5173", expected: true},
+		{name: "port wildcard default port", pattern: "http://localhost:*", origin: "http://localhost", expected: true},
+		{name: "port wildcard other host", pattern: "http://localhost:*", origin: "http://localhost.evil.org:80", expected: false},
+		{name: "scheme-aware subdomain", pattern: "https://*.example.com", origin: "https://api.example.com", expected: true},
+		{name: "scheme-aware subdomain wrong scheme", pattern: "https://*.example.com", origin: "http://api.example.com", expected: false},
+		{name: "scheme-aware subdomain with port wildcard", pattern: "https://*.example.com:*", origin: "https://api.example.com:8443", expected: true},
+		{name: "subdomain does not match root", pattern: "https://*.example.com", origin: "https://example.com", expected: false},
+		{name: "subdomain does not match suffix", pattern: "https://*.example.com", origin: "https://evilexample.com", expected: false},
+		{name: "scheme-less subdomain rejects http", pattern: "*.example.com", origin: "http://api.example.com", expected: false},
+		{name: "scheme-less exact origin rejects http", pattern: "example.com", origin: "http://example.com", expected: false},
+		{name: "scheme-less exact origin", pattern: "example.com", origin: "https://example.com", expected: true},
+		{name: "scheme-less subdomain https", pattern: "*.example.com", origin: "https://api.example.com", expected: true},
+		{name: "scheme-less subdomain other port", pattern: "*.example.com", origin: "https://api.example.com:8443", expected: false},
+		{name: "regex", pattern: `regex:https://(app|admin)\.example\.com`, origin: "https://admin.example.com", expected: true},
+		{name: "regex is anchored at start", pattern: `regex:https://app\.example\.com`, origin: "https://evil.org?https://app.example.com", expected: false},
+		{name: "regex is anchored at end", pattern: `regex:https://app\.example\.com`, origin: "https://app.example.com.evil.org", expected: false},
+		{name: "empty origin", pattern: "*", origin: "", expected: false},
+		{name: "null origin", pattern: "https://app.example.com", origin: "null", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := ParseOriginPattern(tt.pattern)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, pattern.Matches(tt.origin))
+		})
+	}
+}
+
+func TestParseOriginPatternErrors(t *testing.T) {
+	invalid := []string{
+		"ftp://example.com",
+		"https://example.com/path",
+		"https://",
+		"https://*.",
+		"https://api.*.example.com",
+		"http://localhost:",
+		"regex:https://[a-z",
+	}
+	for _, pattern := range invalid {
+		_, err := ParseOriginPattern(pattern)
+		assert.Error(t, err, "pattern %q should be rejected", pattern)
+	}
+
+	err := validateCORSConfig(&CORSConfig{Origins: []string{"regex:(unclosed"}})
+	assert.ErrorContains(t, err, "allow_origins")
+}
+
+func TestCORSEnforceValidation(t *testing.T) {
+	assert.Error(t, validateCORSConfig(&CORSConfig{Enforce: true}))
+	assert.NoError(t, validateCORSConfig(&CORSConfig{Enforce: true, Origins: []string{"https://app.example.com"}}))
+
+	enabled := true
+	override := &CORSOverride{Enforce: &enabled, RefererFallback: &enabled}
+	result := override.Apply(CORSConfig{Origins: []string{"https://app.example.com"}, AllowMissingOrigin: true})
+	assert.True(t, result.Enforce)
+	assert.True(t, result.RefererFallback)
+	assert.True(t, result.AllowMissingOrigin)
+}
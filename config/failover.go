@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+const DEFAULT_FAILOVER_MAX_BODY_SIZE = 1 << 20 // 1MB
+
+// FailoverConfig declares backup upstreams of an endpoint, tried in order when
+// the upstream selected for a request fails with a connection error, a
+// timeout or one of the OnStatus response statuses.
+type FailoverConfig struct {
+	Upstreams []string `yaml:"upstreams"`
+	OnStatus  []int    `yaml:"on_status"`
+	// MaxBodySize bounds the request bodies buffered so they can be sent
+	// again. Requests with larger bodies are not failed over.
+	MaxBodySize string `yaml:"max_body_size"`
+}
+
+// GetMaxBodySize returns the maximum size in bytes of replayable request bodies.
+func (f *FailoverConfig) GetMaxBodySize() int64 {
+	if f.MaxBodySize == "" {
+		return DEFAULT_FAILOVER_MAX_BODY_SIZE
+	}
+	size, err := ParseSize(f.MaxBodySize)
+	if err != nil {
+		slog.Warn("Invalid failover max_body_size, using default", "max_body_size", f.MaxBodySize, "error", err)
+		return DEFAULT_FAILOVER_MAX_BODY_SIZE
+	}
+	return size
+}
+
+func validateFailoverConfig(failover *FailoverConfig) error {
+	if len(failover.Upstreams) == 0 {
+		return fmt.Errorf("upstreams cannot be empty")
+	}
+	for i, upstream := range failover.Upstreams {
+		if upstream == "" {
+			return fmt.Errorf("upstream %d: url cannot be empty", i)
+		}
+	}
+	for _, status := range failover.OnStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("on_status %d is not a valid HTTP status", status)
+		}
+	}
+	if failover.MaxBodySize != "" {
+		if _, err := ParseSize(failover.MaxBodySize); err != nil {
+			return fmt.Errorf("invalid max_body_size: %w (use format like '512KB', '1MB')", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1024", want: 1024},
+		{value: "10B", want: 10},
+		{value: "512KB", want: 512 << 10},
+		{value: "1mb", want: 1 << 20},
+		{value: "2 GB", want: 2 << 30},
+		{value: "", wantErr: true},
+		{value: "MB", wantErr: true},
+		{value: "1.5MB", wantErr: true},
+		{value: "-1KB", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			size, err := ParseSize(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.want, size)
+			}
+		})
+	}
+}
+
+func TestValidateFailoverConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		failover FailoverConfig
+		wantErr  bool
+	}{
+		{name: "backup upstream", failover: FailoverConfig{Upstreams: []string{"http://backup.example.com"}}},
+		{
+			name:     "all settings",
+			failover: FailoverConfig{Upstreams: []string{"http://backup.example.com"}, OnStatus: []int{502, 503}, MaxBodySize: "64KB"},
+		},
+		{name: "no upstream", failover: FailoverConfig{OnStatus: []int{503}}, wantErr: true},
+		{name: "empty upstream", failover: FailoverConfig{Upstreams: []string{""}}, wantErr: true},
+		{name: "invalid status", failover: FailoverConfig{Upstreams: []string{"http://backup.example.com"}, OnStatus: []int{1000}}, wantErr: true},
+		{name: "invalid body size", failover: FailoverConfig{Upstreams: []string{"http://backup.example.com"}, MaxBodySize: "large"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFailoverConfig(&tt.failover)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFailoverMaxBodySize(t *testing.T) {
+	failover := FailoverConfig{}
+	assert.Equal(t, int64(DEFAULT_FAILOVER_MAX_BODY_SIZE), failover.GetMaxBodySize())
+
+	failover.MaxBodySize = "16KB"
+	assert.Equal(t, int64(16<<10), failover.GetMaxBodySize())
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// ForwardConfig holds the security settings of the /forward endpoint.
+type ForwardConfig struct {
+	// AllowCIDRs re-allows destinations inside the ranges blocked by default
+	// (private, loopback, link-local, ...).
+	AllowCIDRs []string `yaml:"allow_cidrs"`
+	// DenyCIDRs blocks additional destinations, it takes precedence over AllowCIDRs.
+	DenyCIDRs []string `yaml:"deny_cidrs"`
+	// AllowedHosts restricts forwarding to matching targets when not empty.
+	AllowedHosts []string `yaml:"allowed_hosts"`
+	// DeniedHosts blocks matching targets, it takes precedence over AllowedHosts.
+	DeniedHosts []string `yaml:"denied_hosts"`
+	// CORS overrides the global CORS policy for the /forward endpoint.
+	CORS *CORSOverride `yaml:"cors"`
+}
+
+// HostPattern matches forward target URLs. Patterns look like
+// "api.example.com", "*.example.com", "api.example.com:8443" or
+// "api.example.com/v1", and ports and path prefixes can be combined.
+type HostPattern struct {
+	Host       string // lowercase host, optionally starting with "*." for subdomains
+	Port       string // empty for any port
+	PathPrefix string // empty for any path
+}
+
+// ParseHostPattern parses a host pattern as used in allowed_hosts and denied_hosts.
+func ParseHostPattern(pattern string) (HostPattern, error) {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return HostPattern{}, fmt.Errorf("pattern cannot be empty")
+	}
+	if strings.Contains(pattern, "://") {
+		return HostPattern{}, fmt.Errorf("pattern must not include a scheme")
+	}
+
+	hostPort, pathPrefix, hasPath := strings.Cut(pattern, "/")
+	result := HostPattern{Host: hostPort}
+	if hasPath {
+		result.PathPrefix = strings.TrimSuffix(path.Clean("/"+pathPrefix), "/")
+	}
+
+	if host, port, err := net.SplitHostPort(hostPort); err == nil {
+		result.Host, result.Port = host, port
+		if port == "" {
+			return HostPattern{}, fmt.Errorf("port cannot be empty")
+		}
+	} else if strings.HasPrefix(hostPort, "[") {
+		// Bare IPv6 literal without port
+		result.Host = strings.Trim(hostPort, "[]")
+	}
+
+	result.Host = strings.TrimSuffix(strings.ToLower(result.Host), ".")
+	domain := strings.TrimPrefix(result.Host, "*.")
+	if domain == "" || strings.Contains(domain, "*") {
+		return HostPattern{}, fmt.Errorf("invalid host '%s' (use 'example.com' or '*.example.com')", result.Host)
+	}
+
+	return result, nil
+}
+
+// Matches reports whether target matches the pattern. Wildcard hosts match
+// subdomains only, ports are compared using the scheme default when not
+// explicit and path prefixes match on path segment boundaries.
+func (p HostPattern) Matches(target *url.URL) bool {
+	host := strings.TrimSuffix(strings.ToLower(target.Hostname()), ".")
+	if domain, ok := strings.CutPrefix(p.Host, "*."); ok {
+		if !strings.HasSuffix(host, "."+domain) {
+			return false
+		}
+	} else if host != p.Host {
+		return false
+	}
+
+	if p.Port != "" {
+		port := target.Port()
+		if port == "" {
+			port = defaultPort(target.Scheme)
+		}
+		if port != p.Port {
+			return false
+		}
+	}
+
+	if p.PathPrefix != "" {
+		// Clean the path so "/v1/../admin" cannot escape the allowed prefix
+		targetPath := path.Clean("/" + target.Path)
+		if targetPath != p.PathPrefix && !strings.HasPrefix(targetPath, p.PathPrefix+"/") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p HostPattern) String() string {
+	result := p.Host
+	if p.Port != "" {
+		result = net.JoinHostPort(p.Host, p.Port)
+	}
+	return result + p.PathPrefix
+}
+
+func defaultPort(scheme string) string {
+	if scheme == "http" {
+		return "80"
+	}
+	return "443"
+}
+
+// ParseHostPatterns parses a list of host patterns.
+func ParseHostPatterns(patterns []string) ([]HostPattern, error) {
+	result := make([]HostPattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		parsed, err := ParseHostPattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host pattern '%s': %w", pattern, err)
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+// ParseCIDR parses a CIDR range. A bare IP address is accepted as a single host range.
+func ParseCIDR(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+func validateForwardConfig(forward *ForwardConfig) error {
+	for _, cidr := range forward.AllowCIDRs {
+		if _, err := ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("allow_cidrs: invalid range '%s': %w", cidr, err)
+		}
+	}
+	for _, cidr := range forward.DenyCIDRs {
+		if _, err := ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("deny_cidrs: invalid range '%s': %w", cidr, err)
+		}
+	}
+	if _, err := ParseHostPatterns(forward.AllowedHosts); err != nil {
+		return fmt.Errorf("allowed_hosts: %w", err)
+	}
+	if _, err := ParseHostPatterns(forward.DeniedHosts); err != nil {
+		return fmt.Errorf("denied_hosts: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCIDR(t *testing.T) {
+	prefix, err := ParseCIDR("10.0.0.0/8")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.0/8", prefix.String())
+
+	prefix, err = ParseCIDR("192.168.1.10/24")
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.1.0/24", prefix.String())
+
+	prefix, err = ParseCIDR("169.254.169.254")
+	assert.NoError(t, err)
+	assert.Equal(t, "169.254.169.254/32", prefix.String())
+
+	prefix, err = ParseCIDR("::1")
+	assert.NoError(t, err)
+	assert.Equal(t, "::1/128", prefix.String())
+
+	_, err = ParseCIDR("10.0.0.0/33")
+	assert.Error(t, err)
+}
+
+func TestValidateForwardConfig(t *testing.T) {
+	assert.NoError(t, validateForwardConfig(&ForwardConfig{
+		AllowCIDRs: []string{"10.0.0.0/8", "fd00::/8"},
+		DenyCIDRs:  []string{"203.0.113.7"},
+	}))
+	assert.Error(t, validateForwardConfig(&ForwardConfig{AllowCIDRs: []string{"invalid"}}))
+	assert.Error(t, validateForwardConfig(&ForwardConfig{DenyCIDRs: []string{"10.0.0.0/99"}}))
+}
+
+func TestHostPatternMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		target   string
+		expected bool
+	}{
+		{name: "exact host", pattern: "api.example.com", target: "https://api.example.com/data", expected: true},
+		{name: "exact host case insensitive", pattern: "API.example.com", target: "https://api.EXAMPLE.com/", expected: true},
+		{name: "exact host other domain", pattern: "api.example.com", target: "https://api.example.org/", expected: false},
+		{name: "exact host does not match subdomain", pattern: "example.com", target: "https://api.example.com/", expected: false},
+		{name: "wildcard matches subdomain", pattern: "*.example.com", target: "https://api.example.com/", expected: true},
+		{name: "wildcard matches nested subdomain", pattern: "*.example.com", target: "https://a.b.example.com/", expected: true},
+		{name: "wildcard does not match root", pattern: "*.example.com", target: "https://example.com/", expected: false},
+		{name: "wildcard does not match suffix", pattern: "*.example.com", target: "https://evilexample.com/", expected: false},
+		{name: "explicit port matches", pattern: "api.example.com:8443", target: "https://api.example.com:8443/", expected: true},
+		{name: "explicit port mismatch", pattern: "api.example.com:8443", target: "https://api.example.com/", expected: false},
+		{name: "default https port", pattern: "api.example.com:443", target: "https://api.example.com/", expected: true},
+		{name: "default http port", pattern: "api.example.com:80", target: "http://api.example.com/", expected: true},
+		{name: "path prefix matches", pattern: "api.example.com/v1", target: "https://api.example.com/v1/users", expected: true},
+		{name: "path prefix exact", pattern: "api.example.com/v1/", target: "https://api.example.com/v1", expected: true},
+		{name: "path prefix segment boundary", pattern: "api.example.com/v1", target: "https://api.example.com/v10/users", expected: false},
+		{name: "path prefix traversal", pattern: "api.example.com/v1", target: "https://api.example.com/v1/../admin", expected: false},
+		{name: "wildcard with port and path", pattern: "*.example.com:8443/api", target: "https://eu.example.com:8443/api/x", expected: true},
+		{name: "IPv6 literal", pattern: "[2001:db8::1]:8080", target: "http://[2001:db8::1]:8080/", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := ParseHostPattern(tt.pattern)
+			require.NoError(t, err)
+
+			target, err := url.Parse(tt.target)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, pattern.Matches(target))
+		})
+	}
+}
+
+func TestParseHostPatternErrors(t *testing.T) {
+	invalid := []string{"", "*", "*.", "https://api.example.com", "api.*.example.com", "api.example.com:"}
+	for _, pattern := range invalid {
+		_, err := ParseHostPattern(pattern)
+		assert.Error(t, err, "pattern %q should be rejected", pattern)
+	}
+
+	assert.Error(t, validateForwardConfig(&ForwardConfig{AllowedHosts: []string{"*"}}))
+	assert.NoError(t, validateForwardConfig(&ForwardConfig{
+		AllowedHosts: []string{"api.partner.com", "*.partner.io:443/v2"},
+		DeniedHosts:  []string{"internal.partner.com"},
+	}))
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_HEALTH_CHECK_INTERVAL = 10 * time.Second
+	DEFAULT_HEALTH_CHECK_TIMEOUT  = 2 * time.Second
+	DEFAULT_HEALTHY_THRESHOLD     = 2
+	DEFAULT_UNHEALTHY_THRESHOLD   = 3
+)
+
+// HealthCheckConfig configures active health checks of an endpoint upstream.
+// The path is appended to the remote URL, like the sub-path of proxied requests.
+type HealthCheckConfig struct {
+	Path               string `yaml:"path"`
+	Interval           string `yaml:"interval"`
+	Timeout            string `yaml:"timeout"`
+	ExpectedStatus     int    `yaml:"expected_status"`
+	HealthyThreshold   int    `yaml:"healthy_threshold"`
+	UnhealthyThreshold int    `yaml:"unhealthy_threshold"`
+}
+
+func (h *HealthCheckConfig) GetInterval() time.Duration {
+	return parseHealthCheckDuration(h.Interval, DEFAULT_HEALTH_CHECK_INTERVAL)
+}
+
+func (h *HealthCheckConfig) GetTimeout() time.Duration {
+	return parseHealthCheckDuration(h.Timeout, DEFAULT_HEALTH_CHECK_TIMEOUT)
+}
+
+// ExpectsStatus reports whether a health check response status is healthy:
+// the expected status when configured, any 2xx status otherwise.
+func (h *HealthCheckConfig) ExpectsStatus(status int) bool {
+	if h.ExpectedStatus == 0 {
+		return status >= 200 && status <= 299
+	}
+	return status == h.ExpectedStatus
+}
+
+// GetHealthyThreshold returns the number of consecutive successful checks
+// marking an unhealthy upstream healthy again.
+func (h *HealthCheckConfig) GetHealthyThreshold() int {
+	if h.HealthyThreshold == 0 {
+		return DEFAULT_HEALTHY_THRESHOLD
+	}
+	return h.HealthyThreshold
+}
+
+// GetUnhealthyThreshold returns the number of consecutive failed checks
+// marking a healthy upstream unhealthy.
+func (h *HealthCheckConfig) GetUnhealthyThreshold() int {
+	if h.UnhealthyThreshold == 0 {
+		return DEFAULT_UNHEALTHY_THRESHOLD
+	}
+	return h.UnhealthyThreshold
+}
+
+func parseHealthCheckDuration(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid health check duration", "value", value, "error", err)
+		return fallback
+	}
+	return duration
+}
+
+func validateHealthCheckConfig(health *HealthCheckConfig) error {
+	if health.Path != "" && !strings.HasPrefix(health.Path, "/") {
+		return fmt.Errorf("path '%s' must start with '/'", health.Path)
+	}
+
+	for name, value := range map[string]string{"interval": health.Interval, "timeout": health.Timeout} {
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': %w (use format like '10s', '500ms')", name, value, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("%s must be positive, got '%s'", name, value)
+		}
+	}
+
+	if health.ExpectedStatus != 0 && (health.ExpectedStatus < 100 || health.ExpectedStatus > 599) {
+		return fmt.Errorf("expected_status %d is not a valid HTTP status", health.ExpectedStatus)
+	}
+	if health.HealthyThreshold < 0 || health.UnhealthyThreshold < 0 {
+		return fmt.Errorf("thresholds cannot be negative")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateHealthCheckConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		health  HealthCheckConfig
+		wantErr bool
+	}{
+		{name: "defaults", health: HealthCheckConfig{}},
+		{
+			name:   "all settings",
+			health: HealthCheckConfig{Path: "/health", Interval: "5s", Timeout: "1s", ExpectedStatus: 204, HealthyThreshold: 1, UnhealthyThreshold: 5},
+		},
+		{name: "relative path", health: HealthCheckConfig{Path: "health"}, wantErr: true},
+		{name: "invalid interval", health: HealthCheckConfig{Interval: "often"}, wantErr: true},
+		{name: "zero timeout", health: HealthCheckConfig{Timeout: "0s"}, wantErr: true},
+		{name: "invalid expected status", health: HealthCheckConfig{ExpectedStatus: 42}, wantErr: true},
+		{name: "negative threshold", health: HealthCheckConfig{UnhealthyThreshold: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateHealthCheckConfig(&tt.health)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestHealthCheckConfigDefaults(t *testing.T) {
+	health := HealthCheckConfig{}
+	assert.Equal(t, DEFAULT_HEALTH_CHECK_INTERVAL, health.GetInterval())
+	assert.Equal(t, DEFAULT_HEALTH_CHECK_TIMEOUT, health.GetTimeout())
+	assert.Equal(t, DEFAULT_HEALTHY_THRESHOLD, health.GetHealthyThreshold())
+	assert.Equal(t, DEFAULT_UNHEALTHY_THRESHOLD, health.GetUnhealthyThreshold())
+	assert.True(t, health.ExpectsStatus(http.StatusNoContent))
+	assert.False(t, health.ExpectsStatus(http.StatusMovedPermanently))
+
+	health = HealthCheckConfig{Interval: "30s", ExpectedStatus: http.StatusMovedPermanently}
+	assert.Equal(t, 30*time.Second, health.GetInterval())
+	assert.True(t, health.ExpectsStatus(http.StatusMovedPermanently))
+	assert.False(t, health.ExpectsStatus(http.StatusOK))
+}
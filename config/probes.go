@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_LIVENESS_PATH    = "/healthz"
+	DEFAULT_READINESS_PATH   = "/readyz"
+	DEFAULT_VERSION_PATH     = "/version"
+	DEFAULT_UPSTREAM_TIMEOUT = 2 * time.Second
+)
+
+// ProbesConfig controls the health, readiness and version endpoints. They are
+// disabled by default so their paths stay available to configured endpoints.
+type ProbesConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	LivenessPath    string `yaml:"liveness_path"`
+	ReadinessPath   string `yaml:"readiness_path"`
+	VersionPath     string `yaml:"version_path"`
+	CheckUpstreams  bool   `yaml:"check_upstreams"`
+	UpstreamTimeout string `yaml:"upstream_timeout"`
+}
+
+// IsEnabled reports whether the probe endpoints are served.
+func (p *ProbesConfig) IsEnabled() bool {
+	return p.Enabled
+}
+
+func (p *ProbesConfig) GetLivenessPath() string {
+	if p.LivenessPath == "" {
+		return DEFAULT_LIVENESS_PATH
+	}
+	return p.LivenessPath
+}
+
+func (p *ProbesConfig) GetReadinessPath() string {
+	if p.ReadinessPath == "" {
+		return DEFAULT_READINESS_PATH
+	}
+	return p.ReadinessPath
+}
+
+func (p *ProbesConfig) GetVersionPath() string {
+	if p.VersionPath == "" {
+		return DEFAULT_VERSION_PATH
+	}
+	return p.VersionPath
+}
+
+// GetUpstreamTimeout returns how long readiness waits for each upstream to
+// accept a connection when check_upstreams is enabled.
+func (p *ProbesConfig) GetUpstreamTimeout() time.Duration {
+	if p.UpstreamTimeout == "" {
+		return DEFAULT_UPSTREAM_TIMEOUT
+	}
+
+	timeout, err := time.ParseDuration(p.UpstreamTimeout)
+	if err != nil {
+		slog.Warn("Invalid probes upstream timeout", "configured_timeout", p.UpstreamTimeout, "error", err)
+		return DEFAULT_UPSTREAM_TIMEOUT
+	}
+	return timeout
+}
+
+func validateProbesConfig(config *Config) error {
+	probes := &config.Server.Probes
+	if !probes.IsEnabled() {
+		return nil
+	}
+
+	if probes.UpstreamTimeout != "" {
+		if timeout, err := time.ParseDuration(probes.UpstreamTimeout); err != nil {
+			return fmt.Errorf("invalid upstream_timeout '%s': %w (use format like '2s', '500ms')", probes.UpstreamTimeout, err)
+		} else if timeout <= 0 {
+			return fmt.Errorf("upstream_timeout must be positive, got '%s'", probes.UpstreamTimeout)
+		}
+	}
+
+	// Probe paths must not collide with each other or other internal endpoints
+	used := map[string]string{"/forward": "forward endpoint"}
+	if config.Metrics.Enabled && !config.Metrics.SeparateListener() {
+		used[strings.TrimSuffix(config.Metrics.GetPath(), "/")] = "metrics endpoint"
+	}
+	probePaths := []struct{ name, path string }{
+		{"liveness_path", probes.GetLivenessPath()},
+		{"readiness_path", probes.GetReadinessPath()},
+		{"version_path", probes.GetVersionPath()},
+	}
+	for _, probe := range probePaths {
+		if !strings.HasPrefix(probe.path, "/") || probe.path == "/" {
+			return fmt.Errorf("%s '%s' must start with '/' and cannot be the root path", probe.name, probe.path)
+		}
+		normalized := strings.TrimSuffix(probe.path, "/")
+		if owner, exists := used[normalized]; exists {
+			return fmt.Errorf("%s '%s' is already used by the %s", probe.name, probe.path, owner)
+		}
+		used[normalized] = probe.name
+	}
+
+	// Configured endpoints are never dropped in favor of a probe
+	for i, endpoint := range config.Endpoints {
+		normalized := strings.TrimSuffix(endpoint.Path, "/")
+		for _, probe := range probePaths {
+			if normalized == strings.TrimSuffix(probe.path, "/") {
+				return fmt.Errorf("%s '%s' is already used by endpoint %d, change one of the paths or disable probes", probe.name, probe.path, i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateProbesConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "defaults", config: Config{}},
+		{name: "enabled", config: Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true}}, Endpoints: []Endpoint{{Path: "/api"}}}},
+		{
+			name:   "custom paths",
+			config: Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, LivenessPath: "/live", ReadinessPath: "/ready", VersionPath: "/_version"}}},
+		},
+		{
+			name:    "invalid upstream timeout",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, UpstreamTimeout: "fast"}}},
+			wantErr: true,
+		},
+		{
+			name:    "negative upstream timeout",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, UpstreamTimeout: "-1s"}}},
+			wantErr: true,
+		},
+		{
+			name:    "relative path",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, LivenessPath: "healthz"}}},
+			wantErr: true,
+		},
+		{
+			name:    "root path",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, ReadinessPath: "/"}}},
+			wantErr: true,
+		},
+		{
+			name:    "same path for two probes",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, ReadinessPath: "/healthz/"}}},
+			wantErr: true,
+		},
+		{
+			name:    "forward path",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true, VersionPath: "/forward"}}},
+			wantErr: true,
+		},
+		{
+			name: "metrics path on main listener",
+			config: Config{
+				Server:  ServerConfig{Probes: ProbesConfig{Enabled: true, LivenessPath: "/metrics"}},
+				Metrics: MetricsConfig{Enabled: true},
+			},
+			wantErr: true,
+		},
+		{
+			name: "metrics path on separate listener",
+			config: Config{
+				Server:  ServerConfig{Probes: ProbesConfig{Enabled: true, LivenessPath: "/metrics"}},
+				Metrics: MetricsConfig{Enabled: true, Port: 9090},
+			},
+		},
+		{
+			name:    "endpoint path",
+			config:  Config{Server: ServerConfig{Probes: ProbesConfig{Enabled: true}}, Endpoints: []Endpoint{{Path: "/version/"}}},
+			wantErr: true,
+		},
+		{
+			name:   "disabled probes are not validated",
+			config: Config{Server: ServerConfig{Probes: ProbesConfig{LivenessPath: "healthz"}}, Endpoints: []Endpoint{{Path: "/healthz"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateProbesConfig(&tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProbesConfigDefaults(t *testing.T) {
+	probes := ProbesConfig{}
+	assert.False(t, probes.IsEnabled())
+	assert.Equal(t, DEFAULT_LIVENESS_PATH, probes.GetLivenessPath())
+	assert.Equal(t, DEFAULT_READINESS_PATH, probes.GetReadinessPath())
+	assert.Equal(t, DEFAULT_VERSION_PATH, probes.GetVersionPath())
+	assert.Equal(t, DEFAULT_UPSTREAM_TIMEOUT, probes.GetUpstreamTimeout())
+	assert.Equal(t, 500*time.Millisecond, (&ProbesConfig{UpstreamTimeout: "500ms"}).GetUpstreamTimeout())
+}
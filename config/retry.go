@@ -0,0 +1,185 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DEFAULT_RETRY_MAX_ATTEMPTS    = 3
+	DEFAULT_RETRY_INITIAL_BACKOFF = 100 * time.Millisecond
+	DEFAULT_RETRY_MAX_BACKOFF     = 2 * time.Second
+	DEFAULT_RETRY_MAX_BODY_SIZE   = 1 << 20 // 1MB
+
+	DEFAULT_RETRY_BUDGET_RATIO          = 0.2
+	DEFAULT_RETRY_BUDGET_MIN_PER_SECOND = 10
+	DEFAULT_RETRY_BUDGET_WINDOW         = 10 * time.Second
+)
+
+// Error classes of failed upstream requests that can be retried.
+const (
+	RETRY_ON_CONNECTION = "connection"
+	RETRY_ON_TIMEOUT    = "timeout"
+)
+
+var (
+	DEFAULT_RETRY_ON_STATUS = []int{502, 503, 504}
+	DEFAULT_RETRY_ON_ERRORS = []string{RETRY_ON_CONNECTION, RETRY_ON_TIMEOUT}
+)
+
+// RetryConfig retries failed upstream requests of an endpoint with exponential
+// backoff. Only requests with an idempotent method are retried unless
+// NonIdempotent is set.
+type RetryConfig struct {
+	MaxAttempts    int      `yaml:"max_attempts"`
+	OnStatus       []int    `yaml:"on_status"`
+	OnErrors       []string `yaml:"on_errors"`
+	InitialBackoff string   `yaml:"initial_backoff"`
+	MaxBackoff     string   `yaml:"max_backoff"`
+	NonIdempotent  bool     `yaml:"non_idempotent"`
+	// MaxBodySize bounds the request bodies buffered so they can be sent
+	// again. Requests with larger bodies are not retried.
+	MaxBodySize string `yaml:"max_body_size"`
+}
+
+// GetMaxAttempts returns the maximum number of upstream requests, including
+// the first one.
+func (r *RetryConfig) GetMaxAttempts() int {
+	if r.MaxAttempts == 0 {
+		return DEFAULT_RETRY_MAX_ATTEMPTS
+	}
+	return r.MaxAttempts
+}
+
+func (r *RetryConfig) GetOnStatus() []int {
+	if r.OnStatus == nil {
+		return DEFAULT_RETRY_ON_STATUS
+	}
+	return r.OnStatus
+}
+
+func (r *RetryConfig) GetOnErrors() []string {
+	if r.OnErrors == nil {
+		return DEFAULT_RETRY_ON_ERRORS
+	}
+	return r.OnErrors
+}
+
+func (r *RetryConfig) GetInitialBackoff() time.Duration {
+	return parseRetryDuration(r.InitialBackoff, DEFAULT_RETRY_INITIAL_BACKOFF)
+}
+
+// GetMaxBackoff returns the longest wait between two attempts. Responses
+// asking to retry later than that with Retry-After are not retried.
+func (r *RetryConfig) GetMaxBackoff() time.Duration {
+	return parseRetryDuration(r.MaxBackoff, DEFAULT_RETRY_MAX_BACKOFF)
+}
+
+// GetMaxBodySize returns the maximum size in bytes of replayable request bodies.
+func (r *RetryConfig) GetMaxBodySize() int64 {
+	if r.MaxBodySize == "" {
+		return DEFAULT_RETRY_MAX_BODY_SIZE
+	}
+	size, err := ParseSize(r.MaxBodySize)
+	if err != nil {
+		slog.Warn("Invalid retry max_body_size, using default", "max_body_size", r.MaxBodySize, "error", err)
+		return DEFAULT_RETRY_MAX_BODY_SIZE
+	}
+	return size
+}
+
+// RetryBudgetConfig caps retries across all endpoints so they cannot amplify
+// an outage: over the window, retries may not exceed Ratio of the requests
+// plus MinRetriesPerSecond.
+type RetryBudgetConfig struct {
+	Ratio               *float64 `yaml:"ratio"`
+	MinRetriesPerSecond *int     `yaml:"min_retries_per_second"`
+	Window              string   `yaml:"window"`
+}
+
+func (b *RetryBudgetConfig) GetRatio() float64 {
+	if b.Ratio == nil {
+		return DEFAULT_RETRY_BUDGET_RATIO
+	}
+	return *b.Ratio
+}
+
+func (b *RetryBudgetConfig) GetMinRetriesPerSecond() int {
+	if b.MinRetriesPerSecond == nil {
+		return DEFAULT_RETRY_BUDGET_MIN_PER_SECOND
+	}
+	return *b.MinRetriesPerSecond
+}
+
+func (b *RetryBudgetConfig) GetWindow() time.Duration {
+	return parseRetryDuration(b.Window, DEFAULT_RETRY_BUDGET_WINDOW)
+}
+
+func parseRetryDuration(value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid retry duration", "value", value, "error", err)
+		return fallback
+	}
+	return duration
+}
+
+func validateRetryConfig(retry *RetryConfig) error {
+	if retry.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts cannot be negative, got %d", retry.MaxAttempts)
+	}
+	for _, status := range retry.OnStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("on_status %d is not a valid HTTP status", status)
+		}
+	}
+	for _, class := range retry.OnErrors {
+		if class != RETRY_ON_CONNECTION && class != RETRY_ON_TIMEOUT {
+			return fmt.Errorf("invalid on_errors '%s' (use '%s' or '%s')", class, RETRY_ON_CONNECTION, RETRY_ON_TIMEOUT)
+		}
+	}
+	for name, value := range map[string]string{"initial_backoff": retry.InitialBackoff, "max_backoff": retry.MaxBackoff} {
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': %w (use format like '100ms', '2s')", name, value, err)
+		}
+		if duration <= 0 {
+			return fmt.Errorf("%s must be positive, got '%s'", name, value)
+		}
+	}
+	if retry.GetInitialBackoff() > retry.GetMaxBackoff() {
+		return fmt.Errorf("initial_backoff cannot be greater than max_backoff")
+	}
+	if retry.MaxBodySize != "" {
+		if _, err := ParseSize(retry.MaxBodySize); err != nil {
+			return fmt.Errorf("invalid max_body_size: %w (use format like '512KB', '1MB')", err)
+		}
+	}
+	return nil
+}
+
+func validateRetryBudgetConfig(budget *RetryBudgetConfig) error {
+	if ratio := budget.GetRatio(); ratio < 0 {
+		return fmt.Errorf("ratio cannot be negative, got %g", ratio)
+	}
+	if budget.GetMinRetriesPerSecond() < 0 {
+		return fmt.Errorf("min_retries_per_second cannot be negative, got %d", budget.GetMinRetriesPerSecond())
+	}
+	if budget.Window != "" {
+		window, err := time.ParseDuration(budget.Window)
+		if err != nil {
+			return fmt.Errorf("invalid window '%s': %w (use format like '10s', '1m')", budget.Window, err)
+		}
+		if window < time.Second {
+			return fmt.Errorf("window must be at least 1s, got '%s'", budget.Window)
+		}
+	}
+	return nil
+}
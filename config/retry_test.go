@@ -0,0 +1,94 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRetryConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   RetryConfig
+		wantErr bool
+	}{
+		{name: "defaults", retry: RetryConfig{}},
+		{
+			name: "all settings",
+			retry: RetryConfig{
+				MaxAttempts:    5,
+				OnStatus:       []int{429, 503},
+				OnErrors:       []string{"connection"},
+				InitialBackoff: "50ms",
+				MaxBackoff:     "5s",
+				NonIdempotent:  true,
+				MaxBodySize:    "64KB",
+			},
+		},
+		{name: "negative max attempts", retry: RetryConfig{MaxAttempts: -1}, wantErr: true},
+		{name: "invalid status", retry: RetryConfig{OnStatus: []int{42}}, wantErr: true},
+		{name: "unknown error class", retry: RetryConfig{OnErrors: []string{"canceled"}}, wantErr: true},
+		{name: "invalid backoff", retry: RetryConfig{InitialBackoff: "fast"}, wantErr: true},
+		{name: "initial above max backoff", retry: RetryConfig{InitialBackoff: "5s", MaxBackoff: "1s"}, wantErr: true},
+		{name: "invalid body size", retry: RetryConfig{MaxBodySize: "big"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRetryConfig(&tt.retry)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestRetryConfigDefaults(t *testing.T) {
+	retry := RetryConfig{}
+	assert.Equal(t, DEFAULT_RETRY_MAX_ATTEMPTS, retry.GetMaxAttempts())
+	assert.Equal(t, DEFAULT_RETRY_ON_STATUS, retry.GetOnStatus())
+	assert.Equal(t, DEFAULT_RETRY_ON_ERRORS, retry.GetOnErrors())
+	assert.Equal(t, DEFAULT_RETRY_INITIAL_BACKOFF, retry.GetInitialBackoff())
+	assert.Equal(t, DEFAULT_RETRY_MAX_BACKOFF, retry.GetMaxBackoff())
+
+	// An explicit empty list disables retries on statuses
+	retry.OnStatus = []int{}
+	assert.Empty(t, retry.GetOnStatus())
+}
+
+func TestValidateRetryBudgetConfig(t *testing.T) {
+	ratio := 0.5
+	negativeRatio := -0.1
+	minRetries := 5
+
+	tests := []struct {
+		name    string
+		budget  RetryBudgetConfig
+		wantErr bool
+	}{
+		{name: "defaults", budget: RetryBudgetConfig{}},
+		{name: "all settings", budget: RetryBudgetConfig{Ratio: &ratio, MinRetriesPerSecond: &minRetries, Window: "30s"}},
+		{name: "negative ratio", budget: RetryBudgetConfig{Ratio: &negativeRatio}, wantErr: true},
+		{name: "invalid window", budget: RetryBudgetConfig{Window: "a while"}, wantErr: true},
+		{name: "window too short", budget: RetryBudgetConfig{Window: "100ms"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRetryBudgetConfig(&tt.budget)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	budget := RetryBudgetConfig{}
+	assert.Equal(t, DEFAULT_RETRY_BUDGET_RATIO, budget.GetRatio())
+	assert.Equal(t, DEFAULT_RETRY_BUDGET_MIN_PER_SECOND, budget.GetMinRetriesPerSecond())
+	assert.Equal(t, 10*time.Second, budget.GetWindow())
+}
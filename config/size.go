@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// ParseSize parses a size like "512KB", "10MB" or "1GB". Units are powers of
+// 1024 and a number without unit is a count of bytes.
+func ParseSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	number, multiplier := value, int64(1)
+	for _, unit := range sizeUnits {
+		if trimmed, found := strings.CutSuffix(strings.ToUpper(value), unit.suffix); found {
+			number, multiplier = strings.TrimSpace(trimmed), unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("size cannot be negative, got '%s'", value)
+	}
+	return size * multiplier, nil
+}
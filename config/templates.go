@@ -18,18 +18,63 @@ func ProcessTemplates(input string) string {
 	})
 }
 
+// ProcessEndpointTemplates resolves the templates of endpoint. Headers and
+// query parameters are copied rather than updated in place: the maps are
+// shared with the loaded configuration, whose templates are still needed to
+// mask their values in logs.
 func ProcessEndpointTemplates(endpoint *Endpoint) {
 	endpoint.RemoteURL = ProcessTemplates(endpoint.RemoteURL)
 	
-	for i, headerMap := range endpoint.Headers {
-		for key, value := range headerMap {
-			endpoint.Headers[i][key] = ProcessTemplates(value)
+	endpoint.Headers = processTemplateMaps(endpoint.Headers)
+	
+	endpoint.QueryParams = processTemplateMaps(endpoint.QueryParams)
+}
+
+func processTemplateMaps(maps []map[string]string) []map[string]string {
+	if maps == nil {
+		return nil
+	}
+	processed := make([]map[string]string, len(maps))
+	for i, m := range maps {
+		processed[i] = make(map[string]string, len(m))
+		for key, value := range m {
+			processed[i][key] = ProcessTemplates(value)
 		}
 	}
-	
-	for i, paramMap := range endpoint.QueryParams {
-		for key, value := range paramMap {
-			endpoint.QueryParams[i][key] = ProcessTemplates(value)
+	return processed
+}
+
+// TemplateValues returns the values templates of the endpoints resolve to,
+// so they can be masked in logs.
+func (c *Config) TemplateValues() []string {
+	var values []string
+	collect := func(input string) {
+		for _, match := range templateRegex.FindAllStringSubmatch(input, -1) {
+			if value := os.Getenv(strings.TrimSpace(match[1])); value != "" {
+				values = append(values, value)
+			}
 		}
 	}
-}
\ No newline at end of file
+
+	for _, endpoint := range c.Endpoints {
+		for _, upstream := range endpoint.GetUpstreams() {
+			collect(upstream.URL)
+		}
+		if endpoint.Failover != nil {
+			for _, upstream := range endpoint.Failover.Upstreams {
+				collect(upstream)
+			}
+		}
+		for _, headerMap := range endpoint.Headers {
+			for _, value := range headerMap {
+				collect(value)
+			}
+		}
+		for _, paramMap := range endpoint.QueryParams {
+			for _, value := range paramMap {
+				collect(value)
+			}
+		}
+	}
+	return values
+}
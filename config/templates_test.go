@@ -118,6 +118,28 @@ func TestProcessEndpointTemplates(t *testing.T) {
 	}, endpoint.QueryParams)
 }
 
+func TestProcessEndpointTemplatesKeepsConfig(t *testing.T) {
+	t.Setenv("CORSAIR_TEST_TOKEN", "token-value")
+
+	cfg := Config{
+		Endpoints: []Endpoint{{
+			Path:        "/api",
+			RemoteURL:   "https://api.example.com",
+			Headers:     []map[string]string{{"Authorization": "Bearer {{ CORSAIR_TEST_TOKEN }}"}},
+			QueryParams: []map[string]string{{"token": "{{ CORSAIR_TEST_TOKEN }}"}},
+		}},
+	}
+
+	endpoint := cfg.Endpoints[0]
+	ProcessEndpointTemplates(&endpoint)
+
+	assert.Equal(t, "Bearer token-value", endpoint.Headers[0]["Authorization"])
+	assert.Equal(t, "token-value", endpoint.QueryParams[0]["token"])
+	assert.Equal(t, "Bearer {{ CORSAIR_TEST_TOKEN }}", cfg.Endpoints[0].Headers[0]["Authorization"])
+	assert.Equal(t, "{{ CORSAIR_TEST_TOKEN }}", cfg.Endpoints[0].QueryParams[0]["token"])
+	assert.Equal(t, []string{"token-value", "token-value"}, cfg.TemplateValues())
+}
+
 func TestProcessEndpointTemplatesNoEnvVars(t *testing.T) {
 	endpoint := &Endpoint{
 		Path:      "/api",
@@ -139,4 +161,26 @@ func TestProcessEndpointTemplatesNoEnvVars(t *testing.T) {
 	assert.Equal(t, []map[string]string{
 		{"key": "{{ missing_key }}"},
 	}, endpoint.QueryParams)
-}
\ No newline at end of file
+}
+
+func TestTemplateValues(t *testing.T) {
+	t.Setenv("CORSAIR_TEST_BASE", "https://api.example.com")
+	t.Setenv("CORSAIR_TEST_TOKEN", "token-value")
+	t.Setenv("CORSAIR_TEST_KEY", "key-value")
+
+	cfg := Config{
+		Endpoints: []Endpoint{
+			{
+				RemoteURL:   "{{ CORSAIR_TEST_BASE }}/v1",
+				Headers:     []map[string]string{{"Authorization": "Bearer {{CORSAIR_TEST_TOKEN}}"}},
+				QueryParams: []map[string]string{{"api_key": "{{ CORSAIR_TEST_KEY }}", "version": "v1"}},
+			},
+			{
+				RemoteURL: "https://other.example.com",
+				Headers:   []map[string]string{{"X-Missing": "{{ CORSAIR_TEST_UNSET }}"}},
+			},
+		},
+	}
+
+	assert.ElementsMatch(t, []string{"https://api.example.com", "token-value", "key-value"}, cfg.TemplateValues())
+}
@@ -111,6 +111,20 @@ func TestValidateTimeoutConfig(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "invalid shutdown timeout",
+			config: Config{
+				Server: ServerConfig{ShutdownTimeout: "forever"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid shutdown delay",
+			config: Config{
+				Server: ServerConfig{ShutdownDelay: "soon"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "empty timeouts are valid",
 			config: Config{
@@ -133,4 +147,12 @@ func TestValidateTimeoutConfig(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestGetShutdownTimeout(t *testing.T) {
+	assert.Equal(t, DEFAULT_SHUTDOWN, (&Config{}).GetShutdownTimeout())
+	assert.Equal(t, 2*time.Minute, (&Config{Server: ServerConfig{ShutdownTimeout: "2m"}}).GetShutdownTimeout())
+	assert.Equal(t, DEFAULT_SHUTDOWN_DELAY, (&Config{}).GetShutdownDelay())
+	assert.Equal(t, 10*time.Second, (&Config{Server: ServerConfig{ShutdownDelay: "10s"}}).GetShutdownDelay())
+	assert.Equal(t, time.Duration(0), (&Config{Server: ServerConfig{ShutdownDelay: "0s"}}).GetShutdownDelay())
+}
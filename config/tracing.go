@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+const (
+	DEFAULT_TRACING_EXPORTER = "otlp"
+	DEFAULT_TRACING_ENDPOINT = "http://localhost:4318/v1/traces"
+	DEFAULT_SERVICE_NAME     = "corsair"
+)
+
+// TracingConfig controls OpenTelemetry tracing. Spans are exported with
+// OTLP/HTTP to a collector, or written to stdout.
+type TracingConfig struct {
+	Enabled     bool     `yaml:"enabled"`
+	Exporter    string   `yaml:"exporter"`
+	Endpoint    string   `yaml:"endpoint"`
+	ServiceName string   `yaml:"service_name"`
+	SampleRatio *float64 `yaml:"sample_ratio"`
+}
+
+// GetExporter returns the configured exporter, "otlp" or "stdout".
+func (t *TracingConfig) GetExporter() string {
+	if t.Exporter == "" {
+		return DEFAULT_TRACING_EXPORTER
+	}
+	return t.Exporter
+}
+
+// GetEndpoint returns the OTLP/HTTP traces endpoint of the collector.
+func (t *TracingConfig) GetEndpoint() string {
+	if t.Endpoint == "" {
+		return DEFAULT_TRACING_ENDPOINT
+	}
+	return t.Endpoint
+}
+
+func (t *TracingConfig) GetServiceName() string {
+	if t.ServiceName == "" {
+		return DEFAULT_SERVICE_NAME
+	}
+	return t.ServiceName
+}
+
+// GetSampleRatio returns the ratio of new traces that are recorded.
+// Requests carrying a trace context follow the caller's sampling decision.
+func (t *TracingConfig) GetSampleRatio() float64 {
+	if t.SampleRatio == nil {
+		return 1
+	}
+	return *t.SampleRatio
+}
+
+func validateTracingConfig(tracing *TracingConfig) error {
+	switch tracing.GetExporter() {
+	case "otlp", "stdout":
+	default:
+		return fmt.Errorf("invalid exporter '%s' (use 'otlp' or 'stdout')", tracing.Exporter)
+	}
+
+	if tracing.Endpoint != "" {
+		u, err := url.Parse(tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid endpoint '%s' (use a URL like '%s')", tracing.Endpoint, DEFAULT_TRACING_ENDPOINT)
+		}
+	}
+
+	if ratio := tracing.GetSampleRatio(); ratio < 0 || ratio > 1 {
+		return fmt.Errorf("sample_ratio %v must be between 0 and 1", ratio)
+	}
+	return nil
+}
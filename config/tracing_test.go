@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTracingConfig(t *testing.T) {
+	ratio := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		tracing TracingConfig
+		wantErr bool
+	}{
+		{name: "defaults", tracing: TracingConfig{Enabled: true}},
+		{name: "stdout exporter", tracing: TracingConfig{Exporter: "stdout"}},
+		{name: "custom endpoint", tracing: TracingConfig{Endpoint: "https://collector.internal:4318/v1/traces", SampleRatio: ratio(0.25)}},
+		{name: "unknown exporter", tracing: TracingConfig{Exporter: "jaeger"}, wantErr: true},
+		{name: "endpoint without scheme", tracing: TracingConfig{Endpoint: "localhost:4318"}, wantErr: true},
+		{name: "negative sample ratio", tracing: TracingConfig{SampleRatio: ratio(-0.1)}, wantErr: true},
+		{name: "sample ratio above one", tracing: TracingConfig{SampleRatio: ratio(1.5)}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTracingConfig(&tt.tracing)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestTracingConfigDefaults(t *testing.T) {
+	tracing := TracingConfig{}
+	assert.Equal(t, DEFAULT_TRACING_EXPORTER, tracing.GetExporter())
+	assert.Equal(t, DEFAULT_TRACING_ENDPOINT, tracing.GetEndpoint())
+	assert.Equal(t, DEFAULT_SERVICE_NAME, tracing.GetServiceName())
+	assert.Equal(t, 1.0, tracing.GetSampleRatio())
+}
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_IDLE_CONNS          = 100
+	DEFAULT_IDLE_CONN_TIMEOUT       = 90 * time.Second
+	DEFAULT_DIAL_TIMEOUT            = 30 * time.Second
+	DEFAULT_TLS_HANDSHAKE_TIMEOUT   = 10 * time.Second
+	DEFAULT_TCP_KEEP_ALIVE_INTERVAL = 30 * time.Second
+)
+
+// TransportConfig controls connection pooling and low level timeouts of the
+// HTTP transport used to reach upstream servers. Zero values fall back to
+// defaults, and per-endpoint values override the global ones field by field.
+type TransportConfig struct {
+	MaxIdleConns          int    `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost   int    `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost       int    `yaml:"max_conns_per_host"`
+	IdleConnTimeout       string `yaml:"idle_conn_timeout"`
+	DialTimeout           string `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   string `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout string `yaml:"response_header_timeout"`
+	KeepAlive             *bool  `yaml:"keep_alive"`
+	HTTP2                 *bool  `yaml:"http2"`
+}
+
+// Merge returns a copy of the transport configuration where every field set
+// in override replaces the current value.
+func (t TransportConfig) Merge(override TransportConfig) TransportConfig {
+	if override.MaxIdleConns != 0 {
+		t.MaxIdleConns = override.MaxIdleConns
+	}
+	if override.MaxIdleConnsPerHost != 0 {
+		t.MaxIdleConnsPerHost = override.MaxIdleConnsPerHost
+	}
+	if override.MaxConnsPerHost != 0 {
+		t.MaxConnsPerHost = override.MaxConnsPerHost
+	}
+	if override.IdleConnTimeout != "" {
+		t.IdleConnTimeout = override.IdleConnTimeout
+	}
+	if override.DialTimeout != "" {
+		t.DialTimeout = override.DialTimeout
+	}
+	if override.TLSHandshakeTimeout != "" {
+		t.TLSHandshakeTimeout = override.TLSHandshakeTimeout
+	}
+	if override.ResponseHeaderTimeout != "" {
+		t.ResponseHeaderTimeout = override.ResponseHeaderTimeout
+	}
+	if override.KeepAlive != nil {
+		t.KeepAlive = override.KeepAlive
+	}
+	if override.HTTP2 != nil {
+		t.HTTP2 = override.HTTP2
+	}
+	return t
+}
+
+// KeepAliveEnabled reports whether upstream connections are reused (default: true).
+func (t TransportConfig) KeepAliveEnabled() bool {
+	return t.KeepAlive == nil || *t.KeepAlive
+}
+
+// HTTP2Enabled reports whether HTTP/2 is negotiated with upstreams (default: true).
+func (t TransportConfig) HTTP2Enabled() bool {
+	return t.HTTP2 == nil || *t.HTTP2
+}
+
+// GetMaxIdleConns returns the maximum number of idle connections kept across all hosts.
+func (t TransportConfig) GetMaxIdleConns() int {
+	if t.MaxIdleConns <= 0 {
+		return DEFAULT_MAX_IDLE_CONNS
+	}
+	return t.MaxIdleConns
+}
+
+// GetMaxIdleConnsPerHost returns the maximum number of idle connections kept per host.
+// Defaults to max_idle_conns since transports are dedicated to a single endpoint.
+func (t TransportConfig) GetMaxIdleConnsPerHost() int {
+	if t.MaxIdleConnsPerHost <= 0 {
+		return t.GetMaxIdleConns()
+	}
+	return t.MaxIdleConnsPerHost
+}
+
+func (t TransportConfig) GetIdleConnTimeout() time.Duration {
+	return parseTransportDuration("idle_conn_timeout", t.IdleConnTimeout, DEFAULT_IDLE_CONN_TIMEOUT)
+}
+
+func (t TransportConfig) GetDialTimeout() time.Duration {
+	return parseTransportDuration("dial_timeout", t.DialTimeout, DEFAULT_DIAL_TIMEOUT)
+}
+
+func (t TransportConfig) GetTLSHandshakeTimeout() time.Duration {
+	return parseTransportDuration("tls_handshake_timeout", t.TLSHandshakeTimeout, DEFAULT_TLS_HANDSHAKE_TIMEOUT)
+}
+
+// GetResponseHeaderTimeout returns the time to wait for upstream response headers.
+// Zero means no limit other than the request timeout.
+func (t TransportConfig) GetResponseHeaderTimeout() time.Duration {
+	return parseTransportDuration("response_header_timeout", t.ResponseHeaderTimeout, 0)
+}
+
+// GetEffectiveTransport returns the transport configuration for an endpoint,
+// using endpoint-specific settings when set, otherwise the global ones.
+func (c *Config) GetEffectiveTransport(endpoint Endpoint) TransportConfig {
+	return c.Transport.Merge(endpoint.Transport)
+}
+
+func parseTransportDuration(name string, value string, fallback time.Duration) time.Duration {
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Invalid transport duration", "setting", name, "value", value, "error", err)
+		return fallback
+	}
+	return duration
+}
+
+func validateTransportConfig(transport *TransportConfig) error {
+	if transport.MaxIdleConns < 0 {
+		return fmt.Errorf("max_idle_conns cannot be negative")
+	}
+	if transport.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("max_idle_conns_per_host cannot be negative")
+	}
+	if transport.MaxConnsPerHost < 0 {
+		return fmt.Errorf("max_conns_per_host cannot be negative")
+	}
+
+	durations := map[string]string{
+		"idle_conn_timeout":       transport.IdleConnTimeout,
+		"dial_timeout":            transport.DialTimeout,
+		"tls_handshake_timeout":   transport.TLSHandshakeTimeout,
+		"response_header_timeout": transport.ResponseHeaderTimeout,
+	}
+	for name, value := range durations {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("invalid %s '%s': %w (use format like '10s', '1m30s', '2m')", name, value, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEffectiveTransport(t *testing.T) {
+	disabled := false
+	cfg := Config{
+		Transport: TransportConfig{
+			MaxIdleConns:    200,
+			MaxConnsPerHost: 10,
+			IdleConnTimeout: "60s",
+		},
+	}
+
+	// Endpoint without overrides uses the global settings
+	transport := cfg.GetEffectiveTransport(Endpoint{Path: "/api"})
+	assert.Equal(t, cfg.Transport, transport)
+
+	// Endpoint overrides replace global settings field by field
+	transport = cfg.GetEffectiveTransport(Endpoint{
+		Path: "/api",
+		Transport: TransportConfig{
+			MaxConnsPerHost: 50,
+			HTTP2:           &disabled,
+		},
+	})
+	assert.Equal(t, 200, transport.MaxIdleConns)
+	assert.Equal(t, 50, transport.MaxConnsPerHost)
+	assert.Equal(t, 60*time.Second, transport.GetIdleConnTimeout())
+	assert.False(t, transport.HTTP2Enabled())
+	assert.True(t, transport.KeepAliveEnabled())
+}
+
+func TestTransportDefaults(t *testing.T) {
+	transport := TransportConfig{}
+
+	assert.Equal(t, DEFAULT_MAX_IDLE_CONNS, transport.GetMaxIdleConns())
+	assert.Equal(t, DEFAULT_MAX_IDLE_CONNS, transport.GetMaxIdleConnsPerHost())
+	assert.Equal(t, DEFAULT_IDLE_CONN_TIMEOUT, transport.GetIdleConnTimeout())
+	assert.Equal(t, DEFAULT_DIAL_TIMEOUT, transport.GetDialTimeout())
+	assert.Equal(t, DEFAULT_TLS_HANDSHAKE_TIMEOUT, transport.GetTLSHandshakeTimeout())
+	assert.Equal(t, time.Duration(0), transport.GetResponseHeaderTimeout())
+	assert.True(t, transport.KeepAliveEnabled())
+	assert.True(t, transport.HTTP2Enabled())
+}
+
+func TestValidateTransportConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport TransportConfig
+		wantErr   bool
+	}{
+		{
+			name:      "empty config is valid",
+			transport: TransportConfig{},
+			wantErr:   false,
+		},
+		{
+			name: "valid config",
+			transport: TransportConfig{
+				MaxIdleConns:          10,
+				DialTimeout:           "5s",
+				ResponseHeaderTimeout: "1m",
+			},
+			wantErr: false,
+		},
+		{
+			name:      "negative pool size",
+			transport: TransportConfig{MaxConnsPerHost: -1},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid duration",
+			transport: TransportConfig{DialTimeout: "fast"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTransportConfig(&tt.transport)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
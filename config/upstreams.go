@@ -0,0 +1,94 @@
+package config
+
+import (
+	"fmt"
+)
+
+const (
+	LB_ROUND_ROBIN       = "round_robin"
+	LB_WEIGHTED          = "weighted"
+	LB_LEAST_CONNECTIONS = "least_connections"
+	LB_CONSISTENT_HASH   = "consistent_hash"
+
+	DEFAULT_LOAD_BALANCING_STRATEGY = LB_ROUND_ROBIN
+	DEFAULT_UPSTREAM_WEIGHT         = 1
+)
+
+// UpstreamConfig is a remote server of an endpoint. The weight sets its share
+// of the traffic relative to the other upstreams of the endpoint.
+type UpstreamConfig struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"`
+}
+
+// GetWeight returns the weight of the upstream, 1 when not configured.
+func (u *UpstreamConfig) GetWeight() int {
+	if u.Weight == 0 {
+		return DEFAULT_UPSTREAM_WEIGHT
+	}
+	return u.Weight
+}
+
+// LoadBalancingConfig selects how requests are spread over the upstreams of an
+// endpoint. Consistent hashing keys on the hash header or cookie when set,
+// on the client IP otherwise.
+type LoadBalancingConfig struct {
+	Strategy   string `yaml:"strategy"`
+	HashHeader string `yaml:"hash_header"`
+	HashCookie string `yaml:"hash_cookie"`
+}
+
+func (l *LoadBalancingConfig) GetStrategy() string {
+	if l.Strategy == "" {
+		return DEFAULT_LOAD_BALANCING_STRATEGY
+	}
+	return l.Strategy
+}
+
+// GetUpstreams returns all upstreams of the endpoint: remote_url first, then
+// remote_urls, then upstreams.
+func (e *Endpoint) GetUpstreams() []UpstreamConfig {
+	var upstreams []UpstreamConfig
+	if e.RemoteURL != "" {
+		upstreams = append(upstreams, UpstreamConfig{URL: e.RemoteURL})
+	}
+	for _, remoteURL := range e.RemoteURLs {
+		upstreams = append(upstreams, UpstreamConfig{URL: remoteURL})
+	}
+	return append(upstreams, e.Upstreams...)
+}
+
+func validateUpstreams(endpoint *Endpoint) error {
+	upstreams := endpoint.GetUpstreams()
+	if len(upstreams) == 0 {
+		return fmt.Errorf("remote_url cannot be empty (or use remote_urls or upstreams)")
+	}
+	for i, upstream := range upstreams {
+		if upstream.URL == "" {
+			return fmt.Errorf("upstream %d: url cannot be empty", i)
+		}
+		if upstream.Weight < 0 {
+			return fmt.Errorf("upstream %d: weight cannot be negative, got %d", i, upstream.Weight)
+		}
+	}
+
+	lb := endpoint.LoadBalancing
+	switch lb.GetStrategy() {
+	case LB_ROUND_ROBIN, LB_WEIGHTED, LB_LEAST_CONNECTIONS, LB_CONSISTENT_HASH:
+	default:
+		return fmt.Errorf("invalid load balancing strategy '%s' (use '%s', '%s', '%s' or '%s')",
+			lb.Strategy, LB_ROUND_ROBIN, LB_WEIGHTED, LB_LEAST_CONNECTIONS, LB_CONSISTENT_HASH)
+	}
+	if lb.HashHeader != "" || lb.HashCookie != "" {
+		if lb.GetStrategy() != LB_CONSISTENT_HASH {
+			return fmt.Errorf("hash_header and hash_cookie require the '%s' strategy", LB_CONSISTENT_HASH)
+		}
+		if lb.HashHeader != "" && lb.HashCookie != "" {
+			return fmt.Errorf("hash_header and hash_cookie cannot be used together")
+		}
+		if lb.HashHeader != "" && !validHeaderName(lb.HashHeader) {
+			return fmt.Errorf("invalid hash_header '%s'", lb.HashHeader)
+		}
+	}
+	return nil
+}
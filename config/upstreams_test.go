@@ -0,0 +1,89 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUpstreams(t *testing.T) {
+	endpoint := Endpoint{
+		RemoteURL:  "http://a.example.com",
+		RemoteURLs: []string{"http://b.example.com"},
+		Upstreams:  []UpstreamConfig{{URL: "http://c.example.com", Weight: 3}},
+	}
+
+	upstreams := endpoint.GetUpstreams()
+	assert.Equal(t, []UpstreamConfig{
+		{URL: "http://a.example.com"},
+		{URL: "http://b.example.com"},
+		{URL: "http://c.example.com", Weight: 3},
+	}, upstreams)
+	assert.Equal(t, 1, upstreams[0].GetWeight())
+	assert.Equal(t, 3, upstreams[2].GetWeight())
+}
+
+func TestValidateUpstreams(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		wantErr  bool
+	}{
+		{name: "remote_url", endpoint: Endpoint{RemoteURL: "http://example.com"}},
+		{name: "remote_urls", endpoint: Endpoint{RemoteURLs: []string{"http://a.example.com", "http://b.example.com"}}},
+		{
+			name: "weighted upstreams",
+			endpoint: Endpoint{
+				Upstreams:     []UpstreamConfig{{URL: "http://a.example.com", Weight: 3}, {URL: "http://b.example.com"}},
+				LoadBalancing: LoadBalancingConfig{Strategy: LB_WEIGHTED},
+			},
+		},
+		{
+			name: "consistent hash on header",
+			endpoint: Endpoint{
+				RemoteURLs:    []string{"http://a.example.com", "http://b.example.com"},
+				LoadBalancing: LoadBalancingConfig{Strategy: LB_CONSISTENT_HASH, HashHeader: "X-User-ID"},
+			},
+		},
+		{name: "no upstream", endpoint: Endpoint{}, wantErr: true},
+		{name: "empty upstream url", endpoint: Endpoint{Upstreams: []UpstreamConfig{{Weight: 2}}}, wantErr: true},
+		{name: "negative weight", endpoint: Endpoint{Upstreams: []UpstreamConfig{{URL: "http://a.example.com", Weight: -1}}}, wantErr: true},
+		{
+			name:     "unknown strategy",
+			endpoint: Endpoint{RemoteURL: "http://example.com", LoadBalancing: LoadBalancingConfig{Strategy: "random"}},
+			wantErr:  true,
+		},
+		{
+			name:     "hash key without consistent hash",
+			endpoint: Endpoint{RemoteURL: "http://example.com", LoadBalancing: LoadBalancingConfig{HashCookie: "session"}},
+			wantErr:  true,
+		},
+		{
+			name: "hash header and cookie",
+			endpoint: Endpoint{
+				RemoteURL:     "http://example.com",
+				LoadBalancing: LoadBalancingConfig{Strategy: LB_CONSISTENT_HASH, HashHeader: "X-User-ID", HashCookie: "session"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid hash header",
+			endpoint: Endpoint{
+				RemoteURL:     "http://example.com",
+				LoadBalancing: LoadBalancingConfig{Strategy: LB_CONSISTENT_HASH, HashHeader: "X User"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUpstreams(&tt.endpoint)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
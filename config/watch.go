@@ -0,0 +1,54 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Watch polls the configuration file every interval and calls onChange whenever
+// its content differs from the previously seen version. Content hashing is used
+// rather than modification times so atomic replacements (such as Kubernetes
+// ConfigMap symlink swaps) are detected reliably. Watch blocks until ctx is done.
+func Watch(ctx context.Context, filename string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		slog.Debug("Config file watching disabled", "config_file", filename)
+		return
+	}
+
+	last := fileChecksum(filename)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	slog.Debug("Watching config file for changes", "config_file", filename, "interval", interval)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := fileChecksum(filename)
+			if current == nil || bytes.Equal(current, last) {
+				continue
+			}
+			last = current
+			slog.Info("Config file change detected", "config_file", filename)
+			onChange()
+		}
+	}
+}
+
+// fileChecksum returns the SHA-256 of the file content, or nil if it cannot be read.
+// Unreadable files are ignored so a half-written or temporarily missing file
+// never triggers a reload.
+func fileChecksum(filename string) []byte {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		slog.Debug("Unable to read config file for change detection", "config_file", filename, "error", err)
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
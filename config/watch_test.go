@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("server:\n  port: 8080\n"), 0o644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan struct{}, 10)
+	go Watch(ctx, filename, 10*time.Millisecond, func() {
+		changes <- struct{}{}
+	})
+
+	// Rewriting identical content must not trigger a reload
+	time.Sleep(30 * time.Millisecond)
+	require.NoError(t, os.WriteFile(filename, []byte("server:\n  port: 8080\n"), 0o644))
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, changes)
+
+	require.NoError(t, os.WriteFile(filename, []byte("server:\n  port: 9090\n"), 0o644))
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("expected change notification")
+	}
+
+	// A missing file is ignored until it comes back
+	require.NoError(t, os.Remove(filename))
+	time.Sleep(30 * time.Millisecond)
+	assert.Empty(t, changes)
+}
+
+func TestWatchDisabled(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		Watch(context.Background(), "missing.yaml", 0, func() {})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Watch should return immediately when interval is zero")
+	}
+}
+
+func TestGetConfigWatchInterval(t *testing.T) {
+	assert.Equal(t, DEFAULT_WATCH_INTERVAL, (&Config{}).GetConfigWatchInterval())
+	assert.Equal(t, 30*time.Second, (&Config{Server: ServerConfig{ConfigWatchInterval: "30s"}}).GetConfigWatchInterval())
+	assert.Equal(t, time.Duration(0), (&Config{Server: ServerConfig{ConfigWatchInterval: "0s"}}).GetConfigWatchInterval())
+}
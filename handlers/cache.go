@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/bastienwirtz/corsair/cache"
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/middleware"
+)
+
+// notModifiedHeaders are the headers of cached responses sent with 304 Not
+// Modified answers (RFC 9110 section 15.4.5).
+var notModifiedHeaders = []string{"Cache-Control", "Content-Location", "Date", "Etag", "Expires", "Last-Modified", "Vary"}
+
+// serveCached answers r with a cached response, or with 304 Not Modified when
+// the conditional headers of r match it. status is reported in the X-Cache
+// header.
+func serveCached(w http.ResponseWriter, r *http.Request, entry *cache.Entry, now time.Time, status string) {
+	notModified := cache.NotModified(r, entry)
+	for key, values := range entry.Header {
+		if notModified && !slices.Contains(notModifiedHeaders, key) {
+			continue
+		}
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if entry.Header.Get("ETag") == "" && entry.GeneratedETag != "" {
+		w.Header().Set("ETag", entry.GeneratedETag)
+	}
+	w.Header().Set("Age", strconv.Itoa(int(entry.Age(now).Seconds())))
+	w.Header().Set("X-Cache", status)
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		w.Write(entry.Body)
+	}
+}
+
+// newCacheEntry creates the cache entry of a response received at now, fresh
+// for lifetime. The body is set once received.
+func (u *upstream) newCacheEntry(key string, r *http.Request, resp *http.Response, lifetime time.Duration, cfg config.EndpointCacheConfig, now time.Time) *cache.Entry {
+	header := make(http.Header, len(resp.Header))
+	for key, values := range resp.Header {
+		if !u.dropsHeader(key) {
+			header[key] = values
+		}
+	}
+	// Age is computed when serving the entry
+	header.Del("Age")
+
+	date := now
+	if age, err := strconv.Atoi(resp.Header.Get("Age")); err == nil && age > 0 {
+		date = now.Add(-time.Duration(age) * time.Second)
+	}
+	whileRevalidate, ifError := cache.StaleWindows(resp.Header, cfg)
+	return &cache.Entry{
+		Key:                  key,
+		Vary:                 cache.VaryValues(r, resp.Header),
+		Status:               resp.StatusCode,
+		Header:               header,
+		Date:                 date,
+		Expires:              now.Add(lifetime),
+		StaleWhileRevalidate: whileRevalidate,
+		StaleIfError:         ifError,
+	}
+}
+
+// refreshCacheEntry returns entry updated with the headers of the 304 Not
+// Modified response revalidating it, received at now, or nil when it can no
+// longer be stored.
+func (u *upstream) refreshCacheEntry(entry *cache.Entry, r *http.Request, resp *http.Response, cfg config.EndpointCacheConfig, now time.Time) *cache.Entry {
+	header := entry.Header.Clone()
+	for key, values := range resp.Header {
+		// The length is the one of the cached body
+		if key != "Content-Length" {
+			header[key] = values
+		}
+	}
+	lifetime, ok := cache.Freshness(r, entry.Status, header, cfg, now)
+	if !ok {
+		return nil
+	}
+	refreshed := u.newCacheEntry(entry.Key, r, &http.Response{StatusCode: entry.Status, Header: header}, lifetime, cfg, now)
+	refreshed.Body = entry.Body
+	refreshed.GeneratedETag = entry.GeneratedETag
+	return refreshed
+}
+
+// setValidators makes proxyReq conditional on the validators of entry, in
+// place of the conditional headers of the client, so the upstream answers
+// 304 Not Modified when entry is still valid.
+func setValidators(proxyReq *http.Request, entry *cache.Entry) {
+	proxyReq.Header.Del("If-None-Match")
+	proxyReq.Header.Del("If-Modified-Since")
+	for name, values := range cache.Validators(entry) {
+		proxyReq.Header[name] = values
+	}
+}
+
+// revalidationKey marks the background requests refreshing stale responses.
+type revalidationKey struct{}
+
+// revalidationRequest returns a copy of r refreshing its cached response in
+// the background. It outlives r without being recorded in its access log, and
+// drops the conditional headers of the client, so it is only conditional on
+// the validators of the cached response.
+func revalidationRequest(r *http.Request) *http.Request {
+	ctx := middleware.WithoutRequestInfo(context.WithoutCancel(r.Context()))
+	req := r.Clone(context.WithValue(ctx, revalidationKey{}, true))
+	req.Body = http.NoBody
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		req.Header.Del(name)
+	}
+	return req
+}
+
+// isRevalidation reports whether the request of ctx refreshes a stale response.
+func isRevalidation(ctx context.Context) bool {
+	revalidation, _ := ctx.Value(revalidationKey{}).(bool)
+	return revalidation
+}
+
+// staleOnError reports whether a failed upstream request can be answered with
+// a stale response: on connection errors, timeouts and 5xx responses.
+func staleOnError(resp *http.Response, err error) bool {
+	if err != nil {
+		switch upstreamErrorKind(err) {
+		case "timeout", "connection", "circuit_open":
+			return true
+		}
+		return false
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// discardWriter is the response writer of background requests.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
+
+// readAhead reads the body of resp when it does not exceed limit, so that
+// headers computed from it can be set before the response is written. The body
+// of resp is replaced to be read again, and nil is returned when it is larger
+// than limit or cannot be read.
+func readAhead(resp *http.Response, limit int64) []byte {
+	body := resp.Body
+	read, err := io.ReadAll(io.LimitReader(body, limit+1))
+	replay := io.MultiReader(bytes.NewReader(read), body)
+	if err != nil {
+		replay = io.MultiReader(bytes.NewReader(read), errorReader{err})
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{replay, body}
+
+	if err != nil || int64(len(read)) > limit {
+		return nil
+	}
+	return read
+}
+
+// errorReader fails reads with err.
+type errorReader struct {
+	err error
+}
+
+func (r errorReader) Read([]byte) (int, error) { return 0, r.err }
+
+// captureBody keeps a copy of the response body read through it, unless it
+// exceeds limit.
+type captureBody struct {
+	io.ReadCloser
+	limit    int64
+	buf      bytes.Buffer
+	overflow bool
+	complete bool // the whole body was read
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+	if err == io.EOF {
+		b.complete = true
+	}
+	return n, err
+}
+
+// Body returns the captured body, and false when it is incomplete.
+func (b *captureBody) Body() ([]byte, bool) {
+	return b.buf.Bytes(), b.complete && !b.overflow
+}
+
+// WithCache caches the responses of endpoints configuring caching in store,
+// usually shared by all endpoints.
+func WithCache(store cache.Store) ProxyOption {
+	return func(o *proxyOptions) {
+		o.cache = store
+	}
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/cache"
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestProxyHandlerCache(t *testing.T) {
+	var calls atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch r.URL.Path {
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		fmt.Fprintf(w, "%s %d", r.Header.Get("Accept-Language"), n)
+	}))
+	defer mockServer.Close()
+
+	newHandler := func() http.Handler {
+		endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL, Cache: &config.EndpointCacheConfig{}}
+		cfg := config.Config{CORS: config.CORSConfig{Origins: []string{"https://example.com"}}}
+		return ProxyHandler(endpoint, cfg, WithCache(cache.NewMemory(config.CacheConfig{})))
+	}
+	do := func(handler http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for key, values := range header {
+			r.Header[key] = values
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("hit", func(t *testing.T) {
+		calls.Store(0)
+		handler := newHandler()
+
+		w := do(handler, "GET", "/api/users?b=2&a=1", nil)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, " 1", w.Body.String())
+
+		w = do(handler, "GET", "/api/users?a=1&b=2", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Equal(t, " 1", w.Body.String())
+		assert.Equal(t, "max-age=60", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "0", w.Header().Get("Age"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "dropped upstream CORS headers not cached")
+
+		w = do(handler, "HEAD", "/api/users?a=1&b=2", nil)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"), "HEAD cached separately")
+		w = do(handler, "HEAD", "/api/users?a=1&b=2", nil)
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("request directives", func(t *testing.T) {
+		calls.Store(0)
+		handler := newHandler()
+		do(handler, "GET", "/api/users", nil)
+
+		w := do(handler, "GET", "/api/users", http.Header{"Cache-Control": {"no-cache"}})
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, " 2", w.Body.String())
+
+		w = do(handler, "GET", "/api/users", http.Header{"Cache-Control": {"no-store"}})
+		assert.Empty(t, w.Header().Get("X-Cache"))
+		assert.Equal(t, " 3", w.Body.String())
+
+		w = do(handler, "GET", "/api/users", nil)
+		assert.Equal(t, " 2", w.Body.String(), "refreshed by the no-cache request")
+	})
+
+	t.Run("not storable", func(t *testing.T) {
+		calls.Store(0)
+		handler := newHandler()
+		do(handler, "GET", "/api/private", nil)
+
+		w := do(handler, "GET", "/api/private", nil)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("vary", func(t *testing.T) {
+		calls.Store(0)
+		handler := newHandler()
+		do(handler, "GET", "/api/vary", http.Header{"Accept-Language": {"en"}})
+		do(handler, "GET", "/api/vary", http.Header{"Accept-Language": {"fr"}})
+
+		w := do(handler, "GET", "/api/vary", http.Header{"Accept-Language": {"en"}})
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Equal(t, "en 1", w.Body.String())
+		w = do(handler, "GET", "/api/vary", http.Header{"Accept-Language": {"fr"}})
+		assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+		assert.Equal(t, "fr 2", w.Body.String())
+	})
+
+	t.Run("invalidated by unsafe requests", func(t *testing.T) {
+		calls.Store(0)
+		handler := newHandler()
+		do(handler, "GET", "/api/users", nil)
+
+		w := do(handler, "POST", "/api/users", nil)
+		assert.Empty(t, w.Header().Get("X-Cache"))
+
+		w = do(handler, "GET", "/api/users", nil)
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Equal(t, " 3", w.Body.String())
+	})
+
+	t.Run("disabled without endpoint configuration", func(t *testing.T) {
+		calls.Store(0)
+		endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL}
+		handler := ProxyHandler(endpoint, config.Config{}, WithCache(cache.NewMemory(config.CacheConfig{})))
+		do(handler, "GET", "/api/users", nil)
+
+		w := do(handler, "GET", "/api/users", nil)
+		assert.Empty(t, w.Header().Get("X-Cache"))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
+
+func TestProxyHandlerRevalidation(t *testing.T) {
+	var version atomic.Int32
+	var received atomic.Value // If-None-Match header sent upstream
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Store(r.Header.Get("If-None-Match"))
+		etag := fmt.Sprintf(`"v%d"`, version.Load())
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "version %d", version.Load())
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL, Cache: &config.EndpointCacheConfig{}}
+	handler := ProxyHandler(endpoint, config.Config{}, WithCache(cache.NewMemory(config.CacheConfig{})))
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/users", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	version.Store(1)
+	w := get("")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "version 1", w.Body.String())
+
+	// Expired, revalidated upstream with the stored entity tag
+	w = get("")
+	assert.Equal(t, `"v1"`, received.Load())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "REVALIDATED", w.Header().Get("X-Cache"))
+	assert.Equal(t, "version 1", w.Body.String())
+
+	// Clients already holding the response get 304 from the cache
+	w = get(`"v1"`)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "REVALIDATED", w.Header().Get("X-Cache"))
+	assert.Equal(t, `"v1"`, w.Header().Get("ETag"))
+	assert.Empty(t, w.Body.String())
+
+	// The client entity tag is replaced by the stored one
+	version.Store(2)
+	w = get(`"v0"`)
+	assert.Equal(t, `"v1"`, received.Load())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "version 2", w.Body.String())
+
+	w = get("")
+	assert.Equal(t, `"v2"`, received.Load())
+	assert.Equal(t, "REVALIDATED", w.Header().Get("X-Cache"))
+	assert.Equal(t, "version 2", w.Body.String())
+}
+
+func TestProxyHandlerGeneratedETag(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello"))
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL, Cache: &config.EndpointCacheConfig{GenerateETag: true}}
+	handler := ProxyHandler(endpoint, config.Config{}, WithCache(cache.NewMemory(config.CacheConfig{})))
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/api/users", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("")
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, cache.WeakETag([]byte("hello")), etag)
+	assert.Equal(t, "hello", w.Body.String())
+
+	w = get("")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, "hello", w.Body.String())
+
+	w = get(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Empty(t, w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestProxyHandlerGeneratedETagLargeBody(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		// Chunked, the size is unknown before reading the body
+		w.Write([]byte("hello "))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("world"))
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL, Cache: &config.EndpointCacheConfig{GenerateETag: true}}
+	store := cache.NewMemory(config.CacheConfig{MaxEntrySize: "8"})
+	handler := ProxyHandler(endpoint, config.Config{}, WithCache(store))
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+		assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+		assert.Empty(t, w.Header().Get("ETag"))
+		assert.Equal(t, "hello world", w.Body.String())
+	}
+}
+
+func TestProxyHandlerStaleWhileRevalidate(t *testing.T) {
+	var calls atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users", r.URL.Path)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		fmt.Fprintf(w, "%d", calls.Add(1))
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL, Cache: &config.EndpointCacheConfig{}}
+	handler := ProxyHandler(endpoint, config.Config{}, WithCache(cache.NewMemory(config.CacheConfig{})))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+		return w
+	}
+
+	w := get()
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "1", w.Body.String())
+
+	// Served stale immediately, refreshed in the background. The request
+	// may be reused by the server once answered.
+	r := httptest.NewRequest("GET", "/api/users", nil)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	r.URL.Path = "/api/reused"
+	r.Header.Set("Cache-Control", "no-store")
+	assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+	assert.Equal(t, "1", w.Body.String())
+	assert.Eventually(t, func() bool { return get().Body.String() == "2" }, time.Second, 5*time.Millisecond)
+}
+
+func TestProxyHandlerStaleIfError(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		cfg          config.EndpointCacheConfig
+		wantStale    bool
+	}{
+		{name: "response directive", cacheControl: "max-age=0, stale-if-error=60", wantStale: true},
+		{name: "configured", cacheControl: "max-age=0", cfg: config.EndpointCacheConfig{StaleIfError: "1m"}, wantStale: true},
+		{name: "must-revalidate", cacheControl: "max-age=0, must-revalidate", cfg: config.EndpointCacheConfig{StaleIfError: "1m"}},
+		{name: "not configured", cacheControl: "max-age=0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failing atomic.Bool
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if failing.Load() {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				w.Write([]byte("ok"))
+			}))
+			defer mockServer.Close()
+
+			endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL, Cache: &tt.cfg}
+			handler := ProxyHandler(endpoint, config.Config{}, WithCache(cache.NewMemory(config.CacheConfig{})))
+			get := func() *httptest.ResponseRecorder {
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+				return w
+			}
+			assert.Equal(t, "MISS", get().Header().Get("X-Cache"))
+
+			failing.Store(true)
+			w := get()
+			if !tt.wantStale {
+				assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+				return
+			}
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+			assert.Equal(t, "ok", w.Body.String())
+
+			// Connection errors
+			mockServer.Close()
+			w = get()
+			assert.Equal(t, "STALE", w.Header().Get("X-Cache"))
+			assert.Equal(t, "ok", w.Body.String())
+		})
+	}
+}
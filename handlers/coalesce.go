@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/bastienwirtz/corsair/cache"
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+	"github.com/bastienwirtz/corsair/middleware"
+)
+
+// conditionalKeyHeaders change the status of responses, they always key
+// coalesced requests.
+var conditionalKeyHeaders = []string{"If-Match", "If-Modified-Since", "If-None-Match", "If-Range", "If-Unmodified-Since", "Range"}
+
+// coalescer shares the response of a request with the identical requests
+// received while it is in flight, see config.CoalesceConfig.
+type coalescer struct {
+	endpoint   string // configured endpoint path, used as metrics label
+	keyHeaders []string
+	maxBuffer  int64
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+func newCoalescer(endpoint string, cfg config.CoalesceConfig) *coalescer {
+	keyHeaders := slices.Concat(cfg.GetKeyHeaders(), conditionalKeyHeaders)
+	return &coalescer{
+		endpoint:   endpoint,
+		keyHeaders: keyHeaders,
+		maxBuffer:  cfg.GetMaxBufferSize(),
+		flights:    make(map[string]*flight),
+	}
+}
+
+// coalescable reports whether r can share the response of another request:
+// safe requests without body, except background revalidations.
+func coalescable(r *http.Request) bool {
+	return (r.Method == http.MethodGet || r.Method == http.MethodHead) &&
+		r.ContentLength == 0 && !isRevalidation(r.Context())
+}
+
+// wrap coalesces the identical requests served by next.
+func (c *coalescer) wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !coalescable(r) {
+			next(w, r)
+			return
+		}
+		ctx := r.Context()
+		key := cache.Key(r, c.keyHeaders)
+
+		c.mu.Lock()
+		var offset *int64
+		f, joined := c.flights[key]
+		if joined {
+			offset = f.join()
+		}
+		if offset == nil {
+			f, offset = newFlight(ctx, c.maxBuffer)
+			c.flights[key] = f
+			joined = false
+		}
+		c.mu.Unlock()
+
+		if joined {
+			metrics.CoalescedRequests.WithLabelValues(c.endpoint).Inc()
+			middleware.SetEndpoint(ctx, c.endpoint)
+			f.stream(ctx, w, offset)
+			return
+		}
+
+		// The upstream response is received on behalf of all the clients of
+		// the flight, it is only canceled once they are all gone
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			next(&flightWriter{flight: f, header: make(http.Header)}, r.WithContext(f.ctx))
+			c.land(key, f)
+			f.finish()
+		}()
+		f.stream(ctx, w, offset)
+		// Request details are recorded until the response is complete
+		<-done
+	}
+}
+
+// land removes f from the flights once no request can join it anymore.
+func (c *coalescer) land(key string, f *flight) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.flights[key] == f {
+		delete(c.flights, key)
+	}
+}
+
+// flight is a response streamed to several clients. The body is kept while
+// it fits in the buffer limit, so clients can still join, and then only until
+// all clients received it.
+type flight struct {
+	ctx    context.Context // of the request sent upstream
+	cancel context.CancelFunc
+	limit  int64
+
+	mu        sync.Mutex
+	cond      *sync.Cond
+	status    int // 0 until the response headers are received
+	header    http.Header
+	chunks    [][]byte
+	start     int64    // offset of the first chunk in the body
+	end       int64    // length of the body received
+	offsets   []*int64 // offset of the next chunk of each client
+	done      bool
+	abandoned bool // all the clients left
+}
+
+// newFlight creates the flight of the request of ctx, and returns the offset
+// of its client.
+func newFlight(ctx context.Context, limit int64) (*flight, *int64) {
+	f := &flight{limit: limit}
+	f.cond = sync.NewCond(&f.mu)
+	f.ctx, f.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	offset := new(int64)
+	f.offsets = append(f.offsets, offset)
+	return f, offset
+}
+
+// join adds a client to the flight and returns its offset, or nil when the
+// beginning of the body was already released or all the clients left.
+func (f *flight) join() *int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.start > 0 || f.done || f.abandoned {
+		return nil
+	}
+	offset := new(int64)
+	f.offsets = append(f.offsets, offset)
+	return offset
+}
+
+// stream writes the response of the flight to w as it is received, from the
+// offset of the client, until ctx is done.
+func (f *flight) stream(ctx context.Context, w http.ResponseWriter, offset *int64) {
+	stop := context.AfterFunc(ctx, f.broadcast)
+	defer stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.status == 0 && !f.done && ctx.Err() == nil {
+		f.cond.Wait()
+	}
+	if ctx.Err() != nil {
+		f.leave(offset)
+		return
+	}
+	// Headers set by the middlewares of the client, like Vary, are kept
+	for key, values := range f.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.WriteHeader(max(f.status, http.StatusOK))
+	// Send the headers while waiting for the body
+	if *offset == f.end && !f.done {
+		f.mu.Unlock()
+		flush(w)
+		f.mu.Lock()
+	}
+
+	for {
+		for *offset == f.end && !f.done && ctx.Err() == nil {
+			f.cond.Wait()
+		}
+		if *offset == f.end || ctx.Err() != nil {
+			f.leave(offset)
+			return
+		}
+		chunk := f.chunks[0]
+		skipped := *offset - f.start
+		for _, c := range f.chunks {
+			if skipped < int64(len(c)) {
+				chunk = c[skipped:]
+				break
+			}
+			skipped -= int64(len(c))
+		}
+
+		f.mu.Unlock()
+		_, err := w.Write(chunk)
+		if err == nil {
+			flush(w)
+		}
+		f.mu.Lock()
+
+		if err != nil {
+			f.leave(offset)
+			return
+		}
+		*offset += int64(len(chunk))
+		f.release()
+	}
+}
+
+// leave removes the client of offset. The upstream request is canceled when
+// it was the last one. f.mu must be held.
+func (f *flight) leave(offset *int64) {
+	f.offsets = slices.DeleteFunc(f.offsets, func(o *int64) bool { return o == offset })
+	if len(f.offsets) == 0 {
+		f.abandoned = true
+		f.cancel()
+	}
+	f.release()
+}
+
+// finish marks the end of the response.
+func (f *flight) finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.done = true
+	f.cancel()
+	f.cond.Broadcast()
+}
+
+// received returns the length of the body received by all clients. f.mu
+// must be held.
+func (f *flight) received() int64 {
+	received := f.end
+	for _, offset := range f.offsets {
+		received = min(received, *offset)
+	}
+	return received
+}
+
+// release drops the chunks received by all clients once the body exceeds
+// the buffer limit, and wakes up the writer waiting for them. f.mu must be
+// held.
+func (f *flight) release() {
+	received := f.received()
+	for f.end > f.limit && len(f.chunks) > 0 && f.start+int64(len(f.chunks[0])) <= received {
+		f.start += int64(len(f.chunks[0]))
+		f.chunks[0] = nil
+		f.chunks = f.chunks[1:]
+	}
+	f.cond.Broadcast()
+}
+
+func flush(w http.ResponseWriter) {
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (f *flight) broadcast() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// flightWriter receives the response of a flight.
+type flightWriter struct {
+	flight *flight
+	header http.Header
+}
+
+func (w *flightWriter) Header() http.Header { return w.header }
+
+func (w *flightWriter) WriteHeader(status int) {
+	f := w.flight
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.status != 0 {
+		return
+	}
+	f.status = status
+	f.header = w.header.Clone()
+	f.cond.Broadcast()
+}
+
+// Write adds p to the body, once the clients received all but the buffer
+// limit of the body, and releases the chunks received by all clients.
+func (w *flightWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	f := w.flight
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for f.end-f.received() >= f.limit && !f.abandoned {
+		f.cond.Wait()
+	}
+	if f.abandoned {
+		return 0, context.Canceled
+	}
+	f.chunks = append(f.chunks, slices.Clone(p))
+	f.end += int64(len(p))
+	f.release()
+	return len(p), nil
+}
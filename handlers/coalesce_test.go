@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+	"github.com/bastienwirtz/corsair/middleware"
+)
+
+// newCoalescingServer serves an endpoint coalescing requests to an upstream
+// sending "first" and then "second" once release is closed.
+func newCoalescingServer(t *testing.T, path string, calls *atomic.Int32, release chan struct{}) *httptest.Server {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("first "))
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte("second"))
+	}))
+	t.Cleanup(upstream.Close)
+
+	endpoint := config.Endpoint{Path: path, RemoteURL: upstream.URL, Coalesce: &config.CoalesceConfig{}}
+	server := httptest.NewServer(ProxyHandler(endpoint, config.Config{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProxyHandlerCoalesce(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := newCoalescingServer(t, "/coalesce", &calls, release)
+	coalesced := testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce"))
+
+	const clients = 5
+	bodies := make(chan *http.Response, clients)
+	for range clients {
+		go func() {
+			resp, err := http.Get(server.URL + "/coalesce/users")
+			if assert.NoError(t, err) {
+				bodies <- resp
+			}
+		}()
+	}
+
+	// The response is streamed to all clients before it is complete
+	var responses []*http.Response
+	first := make([]byte, len("first "))
+	for range clients {
+		resp := <-bodies
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+		_, err := io.ReadFull(resp.Body, first)
+		require.NoError(t, err)
+		assert.Equal(t, "first ", string(first))
+		responses = append(responses, resp)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, float64(clients-1), testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce"))-coalesced)
+
+	close(release)
+	for _, resp := range responses {
+		rest, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "second", string(rest))
+	}
+
+	// Requests are no longer coalesced once the response is complete
+	resp, err := http.Get(server.URL + "/coalesce/users")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "first second", string(body))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestProxyHandlerCoalesceKey(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		header       http.Header
+		wantCoalesce bool
+	}{
+		{name: "identical", method: "GET", wantCoalesce: true},
+		{name: "other query", method: "GET", header: http.Header{"X-Query": {"page=2"}}},
+		{name: "other credentials", method: "GET", header: http.Header{"Authorization": {"Bearer other"}}},
+		{name: "range", method: "GET", header: http.Header{"Range": {"bytes=0-1"}}},
+		{name: "unsafe method", method: "POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			release := make(chan struct{})
+			server := newCoalescingServer(t, "/coalesce-key", &calls, release)
+
+			send := func(method string, header http.Header) *http.Response {
+				target := server.URL + "/coalesce-key/users"
+				if query := header.Get("X-Query"); query != "" {
+					target += "?" + query
+				}
+				req, err := http.NewRequest(method, target, nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer token")
+				for key, values := range header {
+					req.Header[key] = values
+				}
+				resp, err := http.DefaultClient.Do(req)
+				require.NoError(t, err)
+				return resp
+			}
+
+			coalesced := testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce-key"))
+			first := send("GET", nil)
+			second := make(chan *http.Response, 1)
+			go func() { second <- send(tt.method, tt.header) }()
+
+			// Both requests are in flight until release
+			assert.Eventually(t, func() bool {
+				if tt.wantCoalesce {
+					return testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce-key"))-coalesced == 1
+				}
+				return calls.Load() == 2
+			}, time.Second, 5*time.Millisecond)
+			close(release)
+			for _, resp := range []*http.Response{first, <-second} {
+				body, err := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				require.NoError(t, err)
+				assert.Equal(t, "first second", string(body))
+			}
+
+			want := int32(2)
+			if tt.wantCoalesce {
+				want = 1
+			}
+			assert.Equal(t, want, calls.Load())
+		})
+	}
+}
+
+func TestProxyHandlerCoalesceClientGone(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := newCoalescingServer(t, "/coalesce-gone", &calls, release)
+	coalesced := testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce-gone"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/coalesce-gone/users", nil)
+	leader, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var body string
+	wg.Go(func() {
+		resp, err := http.Get(server.URL + "/coalesce-gone/users")
+		if assert.NoError(t, err) {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(b)
+		}
+	})
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce-gone"))-coalesced == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// The first client leaving does not cancel the upstream request
+	cancel()
+	leader.Body.Close()
+	close(release)
+	wg.Wait()
+	assert.Equal(t, "first second", body)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestProxyHandlerCoalesceHeaders(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer upstream.Close()
+
+	corsConfig := config.CORSConfig{Origins: []string{"https://example.com"}}
+	endpoint := config.Endpoint{Path: "/coalesce-headers", RemoteURL: upstream.URL, Coalesce: &config.CoalesceConfig{}}
+	handler := middleware.CORS(corsConfig)(ProxyHandler(endpoint, config.Config{CORS: corsConfig}))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	coalesced := testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce-headers"))
+
+	get := func() *http.Response {
+		req, _ := http.NewRequest("GET", server.URL+"/coalesce-headers/users", nil)
+		req.Header.Set("Origin", "https://example.com")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	leader := get()
+	defer leader.Body.Close()
+	follower := get()
+	defer follower.Body.Close()
+	close(release)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.CoalescedRequests.WithLabelValues("/coalesce-headers"))-coalesced)
+	assert.Equal(t, int32(1), calls.Load())
+	for _, resp := range []*http.Response{leader, follower} {
+		assert.ElementsMatch(t, []string{"Origin", "Accept-Encoding"}, resp.Header.Values("Vary"))
+		assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestProxyHandlerCoalesceBuffer(t *testing.T) {
+	chunk := strings.Repeat("x", 1000)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for range 100 {
+			w.Write([]byte(chunk))
+		}
+	}))
+	defer upstream.Close()
+
+	// Clients receive the whole response through a buffer smaller than it
+	endpoint := config.Endpoint{Path: "/api", RemoteURL: upstream.URL, Coalesce: &config.CoalesceConfig{MaxBufferSize: "4KB"}}
+	server := httptest.NewServer(ProxyHandler(endpoint, config.Config{}))
+	defer server.Close()
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Go(func() {
+			resp, err := http.Get(server.URL + "/api/large")
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Repeat(chunk, 100), string(body))
+		})
+	}
+	wg.Wait()
+}
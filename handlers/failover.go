@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// isIdempotent reports whether requests with method can safely be sent
+// several times (RFC 9110 section 9.2.2).
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isSafe reports whether requests with method are read-only (RFC 9110
+// section 9.2.1).
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// bufferBody reads the body of r so it can be sent several times. Bodies
+// larger than limit are left in r to be streamed once, and false is returned.
+func bufferBody(r *http.Request, limit int64) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+	if r.ContentLength > limit {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil || int64(len(body)) > limit {
+		// Put back what was read
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return nil, false
+	}
+	return body, true
+}
+
+// failoverReason returns why the request should be sent to a backup upstream
+// after receiving resp or err, or an empty string when it should not.
+func failoverReason(cfg *config.FailoverConfig, resp *http.Response, err error) string {
+	if err != nil {
+		switch kind := upstreamErrorKind(err); kind {
+		case "timeout", "connection":
+			return kind
+		}
+		return ""
+	}
+	if slices.Contains(cfg.OnStatus, resp.StatusCode) {
+		return "status"
+	}
+	return ""
+}
+
+// discardResponse releases the connection of a response that is not used.
+func discardResponse(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestProxyHandlerFailover(t *testing.T) {
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write([]byte("backup " + r.Method + " " + r.URL.Path + " " + string(body)))
+	}))
+	defer backup.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	tests := []struct {
+		name       string
+		primary    string
+		failover   config.FailoverConfig
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "connection error",
+			primary:    down.URL,
+			method:     "GET",
+			wantStatus: http.StatusOK,
+			wantBody:   "backup GET /users ",
+		},
+		{
+			name:       "timeout",
+			primary:    slow.URL,
+			method:     "GET",
+			wantStatus: http.StatusOK,
+			wantBody:   "backup GET /users ",
+		},
+		{
+			name:       "configured status",
+			primary:    unavailable.URL,
+			failover:   config.FailoverConfig{OnStatus: []int{http.StatusServiceUnavailable}},
+			method:     "PUT",
+			body:       `{"name":"corsair"}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `backup PUT /users {"name":"corsair"}`,
+		},
+		{
+			name:       "status not configured",
+			primary:    unavailable.URL,
+			failover:   config.FailoverConfig{OnStatus: []int{http.StatusBadGateway}},
+			method:     "GET",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:       "non idempotent method",
+			primary:    down.URL,
+			method:     "POST",
+			body:       "payload",
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:       "body too large to replay",
+			primary:    unavailable.URL,
+			failover:   config.FailoverConfig{OnStatus: []int{http.StatusServiceUnavailable}, MaxBodySize: "4B"},
+			method:     "PUT",
+			body:       "payload",
+			wantStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failover := tt.failover
+			failover.Upstreams = []string{backup.URL}
+			endpoint := config.Endpoint{
+				Path:      "/api",
+				RemoteURL: tt.primary,
+				Timeout:   "100ms",
+				Failover:  &failover,
+			}
+			handler := ProxyHandler(endpoint, config.Config{})
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, "/api/users", strings.NewReader(tt.body)))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBufferBody(t *testing.T) {
+	r := httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+	r.ContentLength = -1
+	body, ok := bufferBody(r, 4)
+	assert.False(t, ok)
+	assert.Nil(t, body)
+	rest, _ := io.ReadAll(r.Body)
+	assert.Equal(t, "payload", string(rest), "the body read is put back")
+
+	r = httptest.NewRequest("PUT", "/", strings.NewReader("payload"))
+	body, ok = bufferBody(r, 7)
+	assert.True(t, ok)
+	assert.Equal(t, "payload", string(body))
+}
@@ -1,29 +1,79 @@
 package handlers
 
 import (
+	"errors"
 	"log/slog"
 	"net/http"
 	"net/url"
 
 	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/middleware"
+	"github.com/bastienwirtz/corsair/transport"
 )
 
+// ForwardPath is the path of the reserved forward endpoint.
+const ForwardPath = "/forward/"
+
 // ForwardHandler creates an HTTP handler for the /forward endpoint that allows
 // ad-hoc proxying to any URL specified in the 'url' query parameter.
-func ForwardHandler(cfg config.Config) http.Handler {
+// Connections to internal networks are refused unless explicitly allowed.
+// Of the proxy options, only WithResources applies.
+func ForwardHandler(cfg config.Config, opts ...ProxyOption) http.Handler {
+	var options proxyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	guard, err := transport.NewGuard(cfg.Server.Forward)
+	if err != nil {
+		// Should not happen as ranges are checked during config validation
+		slog.Error("Invalid forward address ranges, ignoring them", "error", err)
+		guard, _ = transport.NewGuard(config.ForwardConfig{})
+	}
+
+	allowedHosts, err := config.ParseHostPatterns(cfg.Server.Forward.AllowedHosts)
+	if err != nil {
+		// Should not happen as patterns are checked during config validation.
+		// Fail closed: an unparsable allowlist must not allow everything.
+		slog.Error("Invalid forward allowed hosts, rejecting all forward requests", "error", err)
+		allowedHosts = []config.HostPattern{}
+	}
+	deniedHosts, err := config.ParseHostPatterns(cfg.Server.Forward.DeniedHosts)
+	if err != nil {
+		slog.Error("Invalid forward denied hosts, ignoring them", "error", err)
+	}
+	restrictHosts := len(cfg.Server.Forward.AllowedHosts) > 0
+
+	// Use server default timeout for forward endpoint
+	upstream := newUpstream(ForwardPath, cfg.Transport, cfg.GetDefaultTimeout(), guard, cfg.GetForwardCORS())
+	options.resources.add(upstream.client.CloseIdleConnections)
+
+	// Redirects must satisfy the same host restrictions as the initial target
+	upstream.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if reason := checkForwardTarget(req.URL, allowedHosts, deniedHosts, restrictHosts); reason != "" {
+			return &transport.BlockedError{Destination: req.URL.Host, Reason: reason}
+		}
+		return nil
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		middleware.SetEndpoint(r.Context(), ForwardPath)
+
 		targetURLStr := r.URL.Query().Get("url")
 		if targetURLStr == "" {
-			slog.Warn("Forward request missing URL parameter", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+			slog.WarnContext(r.Context(), "Forward request missing URL parameter", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
 			http.Error(w, "Missing 'url' query parameter", http.StatusBadRequest)
 			return
 		}
 
-		slog.Debug("Processing forward request", "target_url", targetURLStr, "method", r.Method, "remote_addr", r.RemoteAddr)
+		slog.DebugContext(r.Context(), "Processing forward request", "target_url", targetURLStr, "method", r.Method, "remote_addr", r.RemoteAddr)
 
 		targetURL, err := url.Parse(targetURLStr)
 		if err != nil {
-			slog.Warn("Forward request with invalid URL", "error", err, "url", targetURLStr, "remote_addr", r.RemoteAddr)
+			slog.WarnContext(r.Context(), "Forward request with invalid URL", "error", err, "url", targetURLStr, "remote_addr", r.RemoteAddr)
 			http.Error(w, "Invalid URL in 'url' parameter", http.StatusBadRequest)
 			return
 		}
@@ -31,19 +81,26 @@ func ForwardHandler(cfg config.Config) http.Handler {
 		// Default to HTTPS for security
 		if targetURL.Scheme == "" {
 			targetURL.Scheme = "https"
-			slog.Debug("Defaulting to HTTPS scheme", "url", targetURL.String())
+			slog.DebugContext(r.Context(), "Defaulting to HTTPS scheme", "url", targetURL.String())
 		}
 
 		// Security: only allow HTTP/HTTPS protocols
 		if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
-			slog.Warn("Forward request with disallowed scheme", "scheme", targetURL.Scheme, "url", targetURL.String(), "remote_addr", r.RemoteAddr)
+			slog.WarnContext(r.Context(), "Forward request with disallowed scheme", "scheme", targetURL.Scheme, "url", targetURL.String(), "remote_addr", r.RemoteAddr)
 			http.Error(w, "Only HTTP and HTTPS URLs are allowed", http.StatusBadRequest)
 			return
 		}
 
-		proxyReq, err := http.NewRequest(r.Method, targetURL.String(), r.Body)
+		if reason := checkForwardTarget(targetURL, allowedHosts, deniedHosts, restrictHosts); reason != "" {
+			slog.WarnContext(r.Context(), "Forward request to disallowed target", "url", targetURL.String(), "reason", reason, "remote_addr", r.RemoteAddr)
+			http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+			return
+		}
+		slog.DebugContext(r.Context(), "Forward target allowed", "host", targetURL.Host, "path", targetURL.Path)
+
+		proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL.String(), r.Body)
 		if err != nil {
-			slog.Error("Failed to create forward request", "error", err, "url", targetURL.String())
+			slog.ErrorContext(r.Context(), "Failed to create forward request", "error", err, "url", targetURL.String())
 			http.Error(w, "Failed to create request", http.StatusInternalServerError)
 			return
 		}
@@ -60,10 +117,28 @@ func ForwardHandler(cfg config.Config) http.Handler {
 
 		proxyReq.Host = targetURL.Host
 
-		// Use server default timeout for forward endpoint
-		timeout := cfg.GetDefaultTimeout()
-
-		slog.Info("Forwarding request", "target_url", targetURL.String(), "method", r.Method, "timeout", timeout)
-		executeProxyRequest(proxyReq, w, timeout, cfg.CORS)
+		slog.InfoContext(r.Context(), "Forwarding request", "target_url", targetURL.String(), "method", r.Method, "timeout", upstream.client.Timeout)
+		executeProxyRequest(upstream, proxyReq, w)
 	})
 }
+
+// checkForwardTarget returns the reason why target may not be forwarded to,
+// or an empty string when it is allowed. Denied hosts take precedence over
+// allowed hosts, and when restrictHosts is set only allowed hosts are reachable.
+func checkForwardTarget(target *url.URL, allowedHosts, deniedHosts []config.HostPattern, restrictHosts bool) string {
+	for _, pattern := range deniedHosts {
+		if pattern.Matches(target) {
+			return "target matches denied host " + pattern.String()
+		}
+	}
+
+	if !restrictHosts {
+		return ""
+	}
+	for _, pattern := range allowedHosts {
+		if pattern.Matches(target) {
+			return ""
+		}
+	}
+	return "target host is not in the allowed hosts"
+}
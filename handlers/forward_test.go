@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
@@ -14,6 +15,10 @@ func getTestConfig() config.Config {
 	return config.Config{
 		Server: config.ServerConfig{
 			DefaultTimeout: "10s",
+			// Test servers listen on loopback, which is blocked by default
+			Forward: config.ForwardConfig{
+				AllowCIDRs: []string{"127.0.0.0/8", "::1"},
+			},
 		},
 	}
 }
@@ -176,3 +181,187 @@ func TestForwardHandlerUnreachableServer(t *testing.T) {
 	assert.Equal(t, http.StatusBadGateway, w.Code)
 	assert.Contains(t, w.Body.String(), "Request failed")
 }
+
+func TestForwardHandlerBlocksInternalAddresses(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not reach a blocked destination")
+	}))
+	defer mockServer.Close()
+
+	redirectServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer redirectServer.Close()
+
+	tests := []struct {
+		name      string
+		forward   config.ForwardConfig
+		targetURL string
+		expected  string
+	}{
+		{
+			name:      "loopback blocked by default",
+			targetURL: mockServer.URL,
+			expected:  "loopback address",
+		},
+		{
+			name:      "metadata service blocked by default",
+			targetURL: "http://169.254.169.254/latest/meta-data/",
+			expected:  "link-local address",
+		},
+		{
+			name:      "private network blocked by default",
+			targetURL: "http://10.0.0.1/",
+			expected:  "private address",
+		},
+		{
+			name:      "IPv6 loopback blocked by default",
+			targetURL: "http://[::1]:1/",
+			expected:  "loopback address",
+		},
+		{
+			name:      "NAT64 loopback blocked by default",
+			targetURL: "http://[64:ff9b::7f00:1]:1/",
+			expected:  "loopback address embedded in NAT64 address",
+		},
+		{
+			name:      "NAT64 metadata service blocked by default",
+			targetURL: "http://[64:ff9b::a9fe:a9fe]/latest/meta-data/",
+			expected:  "link-local address embedded in NAT64 address",
+		},
+		{
+			name:      "6to4 private network blocked by default",
+			targetURL: "http://[2002:a00:1::]/",
+			expected:  "private address embedded in 6to4 address",
+		},
+		{
+			name:      "hostname resolving to loopback blocked",
+			targetURL: strings.Replace(mockServer.URL, "127.0.0.1", "localhost", 1),
+			expected:  "loopback address",
+		},
+		{
+			name:      "deny range overrides allow range",
+			forward:   config.ForwardConfig{AllowCIDRs: []string{"127.0.0.0/8"}, DenyCIDRs: []string{"127.0.0.1"}},
+			targetURL: mockServer.URL,
+			expected:  "denied range 127.0.0.1/32",
+		},
+		{
+			name:      "redirect to blocked destination",
+			forward:   config.ForwardConfig{AllowCIDRs: []string{"127.0.0.0/8"}},
+			targetURL: redirectServer.URL,
+			expected:  "link-local address",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Config{
+				Server: config.ServerConfig{
+					DefaultTimeout: "1s",
+					Forward:        tt.forward,
+				},
+			}
+			handler := ForwardHandler(cfg)
+
+			req := httptest.NewRequest("GET", "/forward?url="+url.QueryEscape(tt.targetURL), nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusForbidden, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expected)
+		})
+	}
+}
+
+func TestForwardHandlerHostRestrictions(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	defer mockServer.Close()
+
+	mockHost := strings.TrimPrefix(mockServer.URL, "http://")
+
+	tests := []struct {
+		name           string
+		allowedHosts   []string
+		deniedHosts    []string
+		targetURL      string
+		expectedStatus int
+	}{
+		{
+			name:           "no restrictions",
+			targetURL:      mockServer.URL + "/data",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "allowed host",
+			allowedHosts:   []string{mockHost},
+			targetURL:      mockServer.URL + "/data",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "host not in allowlist",
+			allowedHosts:   []string{"api.partner.com"},
+			targetURL:      mockServer.URL + "/data",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "allowed path prefix",
+			allowedHosts:   []string{mockHost + "/public"},
+			targetURL:      mockServer.URL + "/public/data",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "outside allowed path prefix",
+			allowedHosts:   []string{mockHost + "/public"},
+			targetURL:      mockServer.URL + "/private/data",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "denied host takes precedence",
+			allowedHosts:   []string{mockHost},
+			deniedHosts:    []string{"127.0.0.1"},
+			targetURL:      mockServer.URL + "/data",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := getTestConfig()
+			cfg.Server.Forward.AllowedHosts = tt.allowedHosts
+			cfg.Server.Forward.DeniedHosts = tt.deniedHosts
+			handler := ForwardHandler(cfg)
+
+			req := httptest.NewRequest("GET", "/forward?url="+url.QueryEscape(tt.targetURL), nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestForwardHandlerRedirectHostRestrictions(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request should not follow redirect to a disallowed host")
+	}))
+	defer mockServer.Close()
+
+	redirectServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(mockServer.URL, "127.0.0.1", "localhost", 1), http.StatusFound)
+	}))
+	defer redirectServer.Close()
+
+	cfg := getTestConfig()
+	cfg.Server.Forward.AllowedHosts = []string{strings.TrimPrefix(redirectServer.URL, "http://")}
+	handler := ForwardHandler(cfg)
+
+	req := httptest.NewRequest("GET", "/forward?url="+url.QueryEscape(redirectServer.URL), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "not in the allowed hosts")
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// ReadinessCheck reports an error when a dependency is not ready.
+type ReadinessCheck func(ctx context.Context) error
+
+type probeResponse struct {
+	Status string            `json:"status"`
+	Reason string            `json:"reason,omitempty"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// LivenessHandler reports that the process is alive and serving requests.
+func LivenessHandler() http.Handler {
+	return probeHandler(func(w http.ResponseWriter, r *http.Request) {
+		writeProbeJSON(w, http.StatusOK, probeResponse{Status: "ok"})
+	})
+}
+
+// ReadinessHandler reports whether corsair accepts new traffic: ready must
+// return true and all checks must pass. Checks run concurrently.
+func ReadinessHandler(ready func() bool, checks map[string]ReadinessCheck) http.Handler {
+	return probeHandler(func(w http.ResponseWriter, r *http.Request) {
+		if !ready() {
+			writeProbeJSON(w, http.StatusServiceUnavailable, probeResponse{Status: "not ready", Reason: "shutting down"})
+			return
+		}
+		if len(checks) == 0 {
+			writeProbeJSON(w, http.StatusOK, probeResponse{Status: "ready"})
+			return
+		}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		results := make(map[string]string, len(checks))
+		failed := false
+		for name, check := range checks {
+			wg.Go(func() {
+				err := check(r.Context())
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					// Error details stay in logs, probes may be publicly reachable
+					slog.WarnContext(r.Context(), "Readiness check failed", "check", name, "error", err)
+					results[name] = "failed"
+					failed = true
+					return
+				}
+				results[name] = "ok"
+			})
+		}
+		wg.Wait()
+
+		if failed {
+			writeProbeJSON(w, http.StatusServiceUnavailable, probeResponse{Status: "not ready", Reason: "checks failed", Checks: results})
+			return
+		}
+		writeProbeJSON(w, http.StatusOK, probeResponse{Status: "ready", Checks: results})
+	})
+}
+
+// VersionHandler reports the build version.
+func VersionHandler(version string) http.Handler {
+	body := map[string]string{
+		"version":    version,
+		"go_version": runtime.Version(),
+	}
+	return probeHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(body)
+	})
+}
+
+// UpstreamCheck returns a readiness check passing when a remote server of
+// endpoint accepts TCP connections within timeout.
+func UpstreamCheck(endpoint config.Endpoint, timeout time.Duration) ReadinessCheck {
+	return func(ctx context.Context) error {
+		var remoteURLs []string
+		for _, upstream := range endpoint.GetUpstreams() {
+			remoteURLs = append(remoteURLs, upstream.URL)
+		}
+		if endpoint.Failover != nil {
+			remoteURLs = append(remoteURLs, endpoint.Failover.Upstreams...)
+		}
+
+		var errs []error
+		for _, remoteURL := range remoteURLs {
+			err := dialUpstream(ctx, config.ProcessTemplates(remoteURL), timeout)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	}
+}
+
+func dialUpstream(ctx context.Context, remoteURL string, timeout time.Duration) error {
+	target, err := url.Parse(remoteURL)
+	if err != nil {
+		return err
+	}
+	port := target.Port()
+	if port == "" {
+		port = "443"
+		if target.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.Hostname(), port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeHandler restricts probes to GET and HEAD requests.
+func probeHandler(handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		handler(w, r)
+	})
+}
+
+func writeProbeJSON(w http.ResponseWriter, status int, response probeResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
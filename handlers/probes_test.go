@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestLivenessHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	LivenessHandler().ServeHTTP(w, httptest.NewRequest("POST", "/healthz", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD", w.Header().Get("Allow"))
+}
+
+func TestReadinessHandler(t *testing.T) {
+	passing := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		name           string
+		ready          bool
+		checks         map[string]ReadinessCheck
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "ready",
+			ready:          true,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ready"}`,
+		},
+		{
+			name:           "shutting down",
+			ready:          false,
+			checks:         map[string]ReadinessCheck{"/api": passing},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"not ready","reason":"shutting down"}`,
+		},
+		{
+			name:           "checks passing",
+			ready:          true,
+			checks:         map[string]ReadinessCheck{"/api": passing, "/users": passing},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status":"ready","checks":{"/api":"ok","/users":"ok"}}`,
+		},
+		{
+			name:           "check failing",
+			ready:          true,
+			checks:         map[string]ReadinessCheck{"/api": passing, "/users": failing},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status":"not ready","reason":"checks failed","checks":{"/api":"ok","/users":"failed"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := ReadinessHandler(func() bool { return tt.ready }, tt.checks)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	VersionHandler("1.2.3").ServeHTTP(w, httptest.NewRequest("GET", "/version", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "1.2.3", body["version"])
+	assert.NotEmpty(t, body["go_version"])
+}
+
+func TestUpstreamCheck(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer mockServer.Close()
+
+	// Reserve a port with nothing listening on it
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedURL := "http://" + listener.Addr().String()
+	listener.Close()
+
+	t.Setenv("CORSAIR_TEST_UPSTREAM", mockServer.URL)
+
+	tests := []struct {
+		name      string
+		remoteURL string
+		wantErr   bool
+	}{
+		{name: "reachable", remoteURL: mockServer.URL + "/api"},
+		{name: "templated URL", remoteURL: "{{ CORSAIR_TEST_UPSTREAM }}/api"},
+		{name: "unreachable", remoteURL: closedURL, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := UpstreamCheck(config.Endpoint{Path: "/api", RemoteURL: tt.remoteURL}, time.Second)
+			err := check(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
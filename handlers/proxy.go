@@ -1,47 +1,191 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
-	"net/url"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/bastienwirtz/corsair/balancer"
+	"github.com/bastienwirtz/corsair/breaker"
+	"github.com/bastienwirtz/corsair/cache"
 	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/health"
+	"github.com/bastienwirtz/corsair/metrics"
+	"github.com/bastienwirtz/corsair/middleware"
+	"github.com/bastienwirtz/corsair/retry"
+	"github.com/bastienwirtz/corsair/transport"
 )
 
-// executeProxyRequest executes the HTTP request and copies the response back to the client.
-func executeProxyRequest(proxyReq *http.Request, w http.ResponseWriter, timeout time.Duration, corsConfig config.CORSConfig) {
+// upstream bundles what is needed to send requests to a remote server.
+// It is built once per handler so its transport pools connections across requests.
+type upstream struct {
+	endpoint string // configured endpoint path, used as metrics label
+	client   *http.Client
+	cors     config.CORSConfig
+}
 
-	corsHeaders := []string{
-		"access-control-allow-origin",
-		"access-control-allow-methods",
-		"access-control-allow-headers",
-		"access-control-allow-credentials",
+// newUpstream creates the upstream of a configured endpoint path.
+func newUpstream(endpoint string, transportConfig config.TransportConfig, timeout time.Duration, guard *transport.Guard, corsConfig config.CORSConfig) *upstream {
+	return &upstream{
+		endpoint: endpoint,
+		client: &http.Client{
+			Transport: transport.New(transportConfig, guard),
+			Timeout:   timeout,
+		},
+		cors: corsConfig,
 	}
+}
 
-	client := &http.Client{
-		Timeout: timeout,
+// upstreamErrorKind classifies a failed upstream request for metrics.
+func upstreamErrorKind(err error) string {
+	var blocked *transport.BlockedError
+	var open *breaker.OpenError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &blocked):
+		return "blocked"
+	case errors.As(err, &open):
+		return "circuit_open"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
 	}
-	logger := slog.With("url", proxyReq.URL.String(), "timeout", timeout)
+	return "connection"
+}
 
-	logger.Debug("Executing proxy request")
-	resp, err := client.Do(proxyReq)
+// executeProxyRequest executes the HTTP request and copies the response back to the client.
+func executeProxyRequest(u *upstream, proxyReq *http.Request, w http.ResponseWriter) {
+	resp, err := u.send(proxyReq)
 	if err != nil {
-		logger.Error("Request failed", "error", err)
-		http.Error(w, "Request failed", http.StatusBadGateway)
+		u.writeError(w, proxyReq, err)
 		return
 	}
 	defer resp.Body.Close()
+	u.writeResponse(w, proxyReq, resp)
+}
+
+// send sends proxyReq upstream, recording metrics and a client span. The span
+// ends when the response body is closed.
+func (u *upstream) send(proxyReq *http.Request) (*http.Response, error) {
+	ctx := proxyReq.Context()
+	logger := slog.With("url", proxyReq.URL.String(), "timeout", u.client.Timeout)
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("corsair.endpoint", u.endpoint))
+
+	spanCtx, span := otel.Tracer(middleware.TracerName).Start(ctx, proxyReq.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(proxyReq.Method),
+			semconv.ServerAddress(proxyReq.URL.Host),
+			semconv.URLPath(proxyReq.URL.Path),
+			attribute.String("corsair.endpoint", u.endpoint),
+			attribute.Int64("corsair.timeout_ms", u.client.Timeout.Milliseconds()),
+		))
+	// Upstream spans are children of this client span
+	otel.GetTextMapPropagator().Inject(spanCtx, propagation.HeaderCarrier(proxyReq.Header))
+
+	middleware.SetUpstreamURL(ctx, proxyReq.URL.String())
+
+	logger.DebugContext(ctx, "Executing proxy request", "headers", proxyReq.Header)
+	start := time.Now()
+	resp, err := u.client.Do(proxyReq)
+	if err != nil {
+		kind := upstreamErrorKind(err)
+		metrics.UpstreamErrors.WithLabelValues(u.endpoint, kind).Inc()
+		span.SetAttributes(semconv.ErrorTypeKey.String(kind))
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	metrics.UpstreamDuration.WithLabelValues(u.endpoint).Observe(time.Since(start).Seconds())
+	metrics.UpstreamResponses.WithLabelValues(u.endpoint, strconv.Itoa(resp.StatusCode)).Inc()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, resp.Status)
+	}
+
+	logger.DebugContext(ctx, "Received response", "status", resp.StatusCode, "headers", resp.Header)
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
 
-	logger.Debug("Received response", "status", resp.StatusCode)
+// spanBody ends the client span of a response once its body is consumed.
+type spanBody struct {
+	io.ReadCloser
+	span trace.Span
+}
+
+func (b *spanBody) Close() error {
+	defer b.span.End()
+	return b.ReadCloser.Close()
+}
+
+// writeError answers the client of a failed upstream request.
+func (u *upstream) writeError(w http.ResponseWriter, proxyReq *http.Request, err error) {
+	ctx := proxyReq.Context()
+	logger := slog.With("url", proxyReq.URL.String(), "timeout", u.client.Timeout)
+
+	var blocked *transport.BlockedError
+	if errors.As(err, &blocked) {
+		logger.WarnContext(ctx, "Request blocked", "error", blocked)
+		http.Error(w, "Forbidden: "+blocked.Error(), http.StatusForbidden)
+		return
+	}
+	var open *breaker.OpenError
+	if errors.As(err, &open) {
+		logger.WarnContext(ctx, "Circuit breaker is open, rejecting request", "target", open.Target)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(open.RetryAfter)))
+		http.Error(w, "Service Unavailable: circuit breaker is open", http.StatusServiceUnavailable)
+		return
+	}
+	logger.ErrorContext(ctx, "Request failed", "error", err)
+	http.Error(w, "Request failed", http.StatusBadGateway)
+}
+
+// corsHeaders are the upstream response headers dropped when corsair
+// configures CORS.
+var corsHeaders = []string{
+	"access-control-allow-origin",
+	"access-control-allow-methods",
+	"access-control-allow-headers",
+	"access-control-allow-credentials",
+	"access-control-expose-headers",
+	"access-control-max-age",
+}
+
+// dropsHeader reports whether the upstream response header key is not
+// forwarded to clients.
+func (u *upstream) dropsHeader(key string) bool {
+	return u.cors.HasAnyConfiguration() && slices.Contains(corsHeaders, strings.ToLower(key))
+}
+
+// writeResponse copies an upstream response back to the client.
+func (u *upstream) writeResponse(w http.ResponseWriter, proxyReq *http.Request, resp *http.Response) {
+	ctx := proxyReq.Context()
 
 	// Forward response headers to client
 	for key, values := range resp.Header {
-		if corsConfig.HasAnyConfiguration() && slices.Contains(corsHeaders, strings.ToLower(key)) {
-			logger.Warn("Upstream server response includes CORS headers. Dropping them to prevent conflicts with corsair configured CORS headers", "header", key)
+		if u.dropsHeader(key) {
+			slog.WarnContext(ctx, "Upstream server response includes CORS headers. Dropping them to prevent conflicts with corsair configured CORS headers", "header", key, "url", proxyReq.URL.String())
 			continue
 		}
 		for _, value := range values {
@@ -53,69 +197,501 @@ func executeProxyRequest(proxyReq *http.Request, w http.ResponseWriter, timeout
 
 	// Stream response body back to client
 	if _, err := io.Copy(w, resp.Body); err != nil {
-		slog.Error("Failed to copy response body", "error", err, "url", proxyReq.URL.String())
+		slog.ErrorContext(ctx, "Failed to copy response body", "error", err, "url", proxyReq.URL.String())
+	}
+}
+
+// ProxyOption customizes a proxy handler.
+type ProxyOption func(*proxyOptions)
+
+type proxyOptions struct {
+	checker   *health.Checker
+	budget    *retry.Budget
+	cache     cache.Store
+	transport http.RoundTripper
+	resources *Resources
+}
+
+// WithHealthChecker registers the upstreams with checker when the endpoint
+// configures health checks. Unhealthy upstreams receive no traffic, requests
+// are rejected with 503 while all upstreams are unhealthy.
+func WithHealthChecker(checker *health.Checker) ProxyOption {
+	return func(o *proxyOptions) {
+		o.checker = checker
+	}
+}
+
+// WithRetryBudget limits the retries of the endpoint with budget, usually
+// shared by all endpoints. Without budget, retries are only limited by the
+// retry configuration of the endpoint.
+func WithRetryBudget(budget *retry.Budget) ProxyOption {
+	return func(o *proxyOptions) {
+		o.budget = budget
+	}
+}
+
+// withTransport sends the upstream requests with rt instead of a transport
+// built from the endpoint configuration, to compare transports in benchmarks.
+func withTransport(rt http.RoundTripper) ProxyOption {
+	return func(o *proxyOptions) {
+		o.transport = rt
 	}
 }
 
 // ProxyHandler creates an HTTP handler that proxies requests to a configured endpoint.
-func ProxyHandler(endpoint config.Endpoint, cfg config.Config) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logger := slog.With("endpoint_path", endpoint.Path, "request_path", r.URL.Path, "method", r.Method)
-		logger.Debug("Processing proxy request")
+func ProxyHandler(endpoint config.Endpoint, cfg config.Config, opts ...ProxyOption) http.Handler {
+	var options proxyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 
-		// Process template variables in endpoint configuration
-		config.ProcessEndpointTemplates(&endpoint)
+	// Process template variables in endpoint configuration once, requests
+	// may be served concurrently
+	config.ProcessEndpointTemplates(&endpoint)
 
-		targetURL, err := url.Parse(endpoint.RemoteURL)
+	upstream := newUpstream(endpoint.Path, cfg.GetEffectiveTransport(endpoint), cfg.GetEffectiveTimeout(endpoint), nil, cfg.GetEffectiveCORS(endpoint))
+	if options.transport != nil {
+		upstream.client.Transport = options.transport
+	}
+	options.resources.add(upstream.client.CloseIdleConnections)
+
+	// Health checks send the configured headers, which may be required
+	// for authentication
+	var healthHeader http.Header
+	if endpoint.HealthCheck != nil && options.checker != nil {
+		healthHeader = make(http.Header)
+		for _, headerMap := range endpoint.Headers {
+			for key, value := range headerMap {
+				healthHeader.Set(key, config.ProcessTemplates(value))
+			}
+		}
+	}
+
+	newTarget := func(rawURL string, weight int) *balancer.Target {
+		target, err := balancer.NewTarget(config.ProcessTemplates(rawURL), weight)
 		if err != nil {
-			logger.Error("Invalid remote URL in endpoint config", "error", err)
+			slog.Error("Invalid remote URL in endpoint config, upstream ignored", "endpoint_path", endpoint.Path, "error", err)
+			return nil
+		}
+		if healthHeader != nil {
+			target.Health, err = options.checker.Add(endpoint.Path, target.URL.String(), healthHeader, *endpoint.HealthCheck, upstream.client.Transport)
+			if err != nil {
+				slog.Error("Invalid remote URL, health checks disabled", "endpoint_path", endpoint.Path, "error", err)
+			}
+		}
+		if endpoint.CircuitBreaker != nil {
+			target.Breaker = breaker.New(endpoint.Path, target.URL.Host, *endpoint.CircuitBreaker)
+			options.resources.add(target.Breaker.Close)
+		}
+		return target
+	}
+
+	var targets []*balancer.Target
+	for _, upstreamConfig := range endpoint.GetUpstreams() {
+		if target := newTarget(upstreamConfig.URL, upstreamConfig.GetWeight()); target != nil {
+			targets = append(targets, target)
+		}
+	}
+	lb := balancer.New(endpoint.LoadBalancing, targets)
+
+	// Backup upstreams, tried in order when the selected upstream fails
+	var fallbacks []*balancer.Target
+	if endpoint.Failover != nil {
+		for _, remoteURL := range endpoint.Failover.Upstreams {
+			if target := newTarget(remoteURL, 1); target != nil {
+				fallbacks = append(fallbacks, target)
+			}
+		}
+	}
+	// Upstreams and backups, checked together when none can receive a request
+	allTargets := slices.Concat(targets, fallbacks)
+
+	caching := endpoint.Cache != nil && options.cache != nil
+	var refreshing sync.Map // cache keys refreshed in the background
+
+	// Requests sent several times need a body that can be replayed
+	var maxBodySize int64
+	if endpoint.Failover != nil {
+		maxBodySize = endpoint.Failover.GetMaxBodySize()
+	}
+	if endpoint.Retry != nil {
+		maxBodySize = max(maxBodySize, endpoint.Retry.GetMaxBodySize())
+	}
+
+	var serve http.HandlerFunc
+	serve = func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		logger := slog.With("endpoint_path", endpoint.Path, "request_path", r.URL.Path, "method", r.Method)
+		logger.DebugContext(ctx, "Processing proxy request")
+		middleware.SetEndpoint(ctx, endpoint.Path)
+
+		if len(targets) == 0 && len(fallbacks) == 0 {
+			logger.ErrorContext(ctx, "Invalid remote URL in endpoint config")
 			http.Error(w, "Invalid remote URL", http.StatusInternalServerError)
 			return
 		}
 
-		// Strip endpoint path and construct target path
-		path := strings.TrimPrefix(r.URL.Path, endpoint.Path)
-		if path == "" || path[0] != '/' {
-			path = "/" + path
+		var cacheKey string
+		var stale *cache.Entry       // served if the upstream fails
+		var revalidated *cache.Entry // revalidated with its validators
+		if caching && cache.Cacheable(r) {
+			cacheKey = cache.Key(r, endpoint.Cache.KeyHeaders)
+			now := time.Now()
+			entry := options.cache.Get(cacheKey, r)
+			if !isRevalidation(ctx) {
+				switch {
+				case entry != nil && cache.Usable(entry, r, now):
+					metrics.CacheRequests.WithLabelValues(endpoint.Path, "hit").Inc()
+					logger.DebugContext(ctx, "Serving cached response", "age", entry.Age(now))
+					serveCached(w, r, entry, now, "HIT")
+					return
+				case entry != nil && cache.UsableWhileRevalidating(entry, r, now):
+					metrics.CacheRequests.WithLabelValues(endpoint.Path, "stale").Inc()
+					logger.DebugContext(ctx, "Serving stale response while revalidating", "age", entry.Age(now))
+					if _, running := refreshing.LoadOrStore(cacheKey, true); !running {
+						// r must not be used once this request is answered
+						revalidation := revalidationRequest(r)
+						go func() {
+							defer refreshing.Delete(cacheKey)
+							serve(&discardWriter{header: make(http.Header)}, revalidation)
+						}()
+					}
+					serveCached(w, r, entry, now, "STALE")
+					return
+				}
+				metrics.CacheRequests.WithLabelValues(endpoint.Path, "miss").Inc()
+				w.Header().Set("X-Cache", "MISS")
+				stale = entry
+			}
+			if entry != nil && cache.Validators(entry) != nil {
+				revalidated = entry
+			}
+		}
+		// serveStale answers with the stale response when the upstream failed
+		serveStale := func(details ...any) bool {
+			now := time.Now()
+			if stale == nil || !stale.UsableOnError(now) {
+				return false
+			}
+			metrics.CacheStaleOnError.WithLabelValues(endpoint.Path).Inc()
+			logger.WarnContext(ctx, "Upstream request failed, serving stale response", append(details, "age", stale.Age(now))...)
+			serveCached(w, r, stale, now, "STALE")
+			return true
+		}
+		options.budget.Request()
+
+		maxAttempts := 1
+		if endpoint.Retry != nil && (isIdempotent(r.Method) || endpoint.Retry.NonIdempotent) {
+			maxAttempts = endpoint.Retry.GetMaxAttempts()
 		}
+		failover := len(fallbacks) > 0 && isIdempotent(r.Method)
 
-		targetURL.Path = strings.TrimSuffix(targetURL.Path, "/") + path
-		targetURL.RawQuery = r.URL.RawQuery
+		var body []byte
+		replayable := false
+		if maxAttempts > 1 || failover {
+			body, replayable = bufferBody(r, maxBodySize)
+			if !replayable {
+				logger.DebugContext(ctx, "Request body too large to be replayed, retries and failover disabled")
+				maxAttempts, failover = 1, false
+			}
+		}
 
-		logger.Debug("Constructed target URL", "target_url", targetURL.String())
+		for attempt := 1; ; attempt++ {
+			candidates := make([]*balancer.Target, 0, 1+len(fallbacks))
+			if target := lb.Next(r); target != nil {
+				candidates = append(candidates, target)
+			}
+			for _, target := range fallbacks {
+				if target.Available() {
+					candidates = append(candidates, target)
+				}
+			}
+			if len(candidates) == 0 {
+				if serveStale("reason", "unavailable") {
+					return
+				}
+				// Fail fast instead of waiting for known-down upstreams to time out
+				rejectUnavailable(w, r, endpoint.Path, allTargets, logger)
+				return
+			}
+			if !failover {
+				candidates = candidates[:1]
+			}
 
-		proxyReq, err := http.NewRequest(r.Method, targetURL.String(), r.Body)
-		if err != nil {
-			logger.Error("Failed to create proxy request", "error", err)
-			http.Error(w, "Failed to create request", http.StatusInternalServerError)
+			newRequest := func(target *balancer.Target) (*http.Request, error) {
+				var requestBody io.Reader = r.Body
+				if replayable {
+					requestBody = bytes.NewReader(body)
+				}
+				proxyReq, err := newProxyRequest(r, endpoint, target, requestBody)
+				if err == nil && revalidated != nil {
+					setValidators(proxyReq, revalidated)
+				}
+				return proxyReq, err
+			}
+			result := sendWithFailover(upstream, endpoint, candidates, newRequest, logger)
+			if result.proxyReq == nil {
+				logger.ErrorContext(ctx, "Failed to create proxy request", "error", result.err)
+				http.Error(w, "Failed to create request", http.StatusInternalServerError)
+				return
+			}
+
+			if attempt < maxAttempts {
+				if backoff, reason := retryBackoff(endpoint.Retry, attempt, result.resp, result.err); reason != "" {
+					if options.budget.TryRetry() {
+						metrics.UpstreamRetries.WithLabelValues(endpoint.Path, reason).Inc()
+						middleware.SetRetries(ctx, attempt)
+						trace.SpanFromContext(ctx).SetAttributes(attribute.Int("corsair.retries", attempt))
+						details := []any{"reason", reason, "attempt", attempt, "max_attempts", maxAttempts, "backoff", backoff}
+						if result.err != nil {
+							details = append(details, "error", result.err)
+						} else {
+							details = append(details, "status", result.resp.StatusCode)
+						}
+						logger.WarnContext(ctx, "Upstream request failed, retrying", details...)
+						discardResponse(result.resp)
+						result.release()
+
+						timer := time.NewTimer(backoff)
+						select {
+						case <-timer.C:
+							continue
+						case <-ctx.Done():
+							timer.Stop()
+							upstream.writeError(w, result.proxyReq, ctx.Err())
+							return
+						}
+					}
+					metrics.RetryBudgetExhausted.WithLabelValues(endpoint.Path).Inc()
+					logger.WarnContext(ctx, "Retry budget exhausted, not retrying", "reason", reason, "attempt", attempt)
+				}
+			}
+
+			if staleOnError(result.resp, result.err) {
+				details := []any{"error", result.err}
+				if result.err == nil {
+					details = []any{"status", result.resp.StatusCode}
+				}
+				if serveStale(details...) {
+					discardResponse(result.resp)
+					result.release()
+					return
+				}
+			}
+			if result.err != nil {
+				upstream.writeError(w, result.proxyReq, result.err)
+				result.release()
+				return
+			}
+
+			if revalidated != nil {
+				if result.resp.StatusCode == http.StatusNotModified {
+					discardResponse(result.resp)
+					result.release()
+					metrics.CacheRevalidations.WithLabelValues(endpoint.Path, "not_modified").Inc()
+					logger.DebugContext(ctx, "Cached response revalidated")
+					now := time.Now()
+					entry := upstream.refreshCacheEntry(revalidated, r, result.resp, *endpoint.Cache, now)
+					switch {
+					case entry == nil:
+						options.cache.Delete(cacheKey)
+						entry = revalidated
+					case !entry.Expired(now):
+						options.cache.Set(entry)
+					}
+					serveCached(w, r, entry, now, "REVALIDATED")
+					return
+				}
+				metrics.CacheRevalidations.WithLabelValues(endpoint.Path, "modified").Inc()
+			}
+
+			var entry *cache.Entry
+			var capture *captureBody
+			if cacheKey != "" && result.resp.ContentLength <= options.cache.MaxEntrySize() {
+				now := time.Now()
+				if lifetime, ok := cache.Freshness(r, result.resp.StatusCode, result.resp.Header, *endpoint.Cache, now); ok {
+					// Already stale responses are kept while they can be served stale
+					if entry = upstream.newCacheEntry(cacheKey, r, result.resp, lifetime, *endpoint.Cache, now); !entry.Expired(now) {
+						if endpoint.Cache.GenerateETag && r.Method == http.MethodGet && entry.Header.Get("ETag") == "" {
+							// Read first to send the ETag with this response too
+							if body := readAhead(result.resp, options.cache.MaxEntrySize()); body != nil {
+								entry.GeneratedETag = cache.WeakETag(body)
+								result.resp.Header.Set("ETag", entry.GeneratedETag)
+							}
+						}
+						capture = &captureBody{ReadCloser: result.resp.Body, limit: options.cache.MaxEntrySize()}
+						result.resp.Body = capture
+					}
+				}
+			}
+			upstream.writeResponse(w, result.proxyReq, result.resp)
+			result.resp.Body.Close()
+			result.release()
+
+			if capture != nil {
+				if cached, complete := capture.Body(); complete {
+					entry.Body = cached
+					options.cache.Set(entry)
+				}
+			} else if caching && !isSafe(r.Method) && result.resp.StatusCode < http.StatusBadRequest {
+				// Successful unsafe requests may change the cached resource
+				for _, key := range cache.InvalidatedKeys(r, endpoint.Cache.KeyHeaders) {
+					options.cache.Delete(key)
+				}
+			}
 			return
 		}
+	}
+	if endpoint.Coalesce != nil {
+		return newCoalescer(endpoint.Path, *endpoint.Coalesce).wrap(serve)
+	}
+	return serve
+}
+
+// attemptResult is the outcome of sending a request upstream. release must
+// be called once the response is consumed.
+type attemptResult struct {
+	proxyReq *http.Request
+	resp     *http.Response
+	err      error
+	release  func()
+}
 
-		// Forward original request headers
-		for key, values := range r.Header {
-			for _, value := range values {
-				proxyReq.Header.Add(key, value)
+// sendWithFailover sends the request to the first candidate, then to the next
+// ones while the failover policy of endpoint allows it. When the request
+// cannot be created, the result has no proxyReq.
+func sendWithFailover(u *upstream, endpoint config.Endpoint, candidates []*balancer.Target, newRequest func(*balancer.Target) (*http.Request, error), logger *slog.Logger) attemptResult {
+	for i, target := range candidates {
+		proxyReq, err := newRequest(target)
+		if err != nil {
+			return attemptResult{err: err}
+		}
+
+		if !target.Breaker.Allow() {
+			if i < len(candidates)-1 {
+				continue
 			}
+			err := &breaker.OpenError{Target: target.URL.Host, RetryAfter: target.Breaker.RetryAfter()}
+			metrics.UpstreamErrors.WithLabelValues(endpoint.Path, upstreamErrorKind(err)).Inc()
+			return attemptResult{proxyReq: proxyReq, err: err, release: func() {}}
 		}
 
-		// Apply configured headers (override original headers if same key)
-		for _, headerMap := range endpoint.Headers {
-			for key, value := range headerMap {
-				proxyReq.Header.Set(key, value)
+		release := target.Acquire()
+		resp, err := u.send(proxyReq)
+		if err != nil && upstreamErrorKind(err) == "canceled" {
+			// Says nothing about the upstream health
+			target.Breaker.Cancel()
+		} else {
+			target.Breaker.Record(breakerSuccess(resp, err))
+		}
+		if i < len(candidates)-1 {
+			if reason := failoverReason(endpoint.Failover, resp, err); reason != "" {
+				metrics.UpstreamFailovers.WithLabelValues(endpoint.Path, reason).Inc()
+				details := []any{"reason", reason, "upstream", target.URL.Host, "backup_upstream", candidates[i+1].URL.Host}
+				if err != nil {
+					details = append(details, "error", err)
+				} else {
+					details = append(details, "status", resp.StatusCode)
+				}
+				logger.WarnContext(proxyReq.Context(), "Upstream request failed, trying backup upstream", details...)
+				discardResponse(resp)
+				release()
+				continue
 			}
 		}
+		return attemptResult{proxyReq: proxyReq, resp: resp, err: err, release: release}
+	}
+	panic("sendWithFailover called without candidates")
+}
+
+// newProxyRequest creates the request sending r to target with the headers
+// and query parameters configured on endpoint.
+func newProxyRequest(r *http.Request, endpoint config.Endpoint, target *balancer.Target, body io.Reader) (*http.Request, error) {
+	targetURL := *target.URL
+
+	// Strip endpoint path and construct target path
+	path := strings.TrimPrefix(r.URL.Path, endpoint.Path)
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+
+	targetURL.Path = strings.TrimSuffix(targetURL.Path, "/") + path
+	targetURL.RawQuery = r.URL.RawQuery
+
+	slog.DebugContext(r.Context(), "Constructed target URL", "endpoint_path", endpoint.Path, "target_url", targetURL.String())
 
-		// Apply configured query parameters
-		q := proxyReq.URL.Query()
-		for _, paramMap := range endpoint.QueryParams {
-			for key, value := range paramMap {
-				q.Set(key, value)
+	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// Forward original request headers
+	for key, values := range r.Header {
+		for _, value := range values {
+			proxyReq.Header.Add(key, value)
+		}
+	}
+
+	// Apply configured headers (override original headers if same key)
+	for _, headerMap := range endpoint.Headers {
+		for key, value := range headerMap {
+			proxyReq.Header.Set(key, value)
+		}
+	}
+
+	// Apply configured query parameters
+	q := proxyReq.URL.Query()
+	for _, paramMap := range endpoint.QueryParams {
+		for key, value := range paramMap {
+			q.Set(key, value)
+		}
+	}
+	proxyReq.URL.RawQuery = q.Encode()
+	proxyReq.Host = targetURL.Host
+	return proxyReq, nil
+}
+
+// rejectUnavailable answers a request none of targets can receive, because
+// they failed their health checks or their circuit breaker is open.
+func rejectUnavailable(w http.ResponseWriter, r *http.Request, endpoint string, targets []*balancer.Target, logger *slog.Logger) {
+	var retryAfter time.Duration
+	open := false
+	for _, t := range targets {
+		if t.Healthy() && !t.Breaker.Ready() {
+			if wait := t.Breaker.RetryAfter(); !open || wait < retryAfter {
+				retryAfter = wait
 			}
+			open = true
 		}
-		proxyReq.URL.RawQuery = q.Encode()
-		proxyReq.Host = targetURL.Host
+	}
+	if open {
+		metrics.UpstreamErrors.WithLabelValues(endpoint, "circuit_open").Inc()
+		logger.WarnContext(r.Context(), "Circuit breakers of all available upstreams are open, rejecting request", "upstreams", len(targets))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+		http.Error(w, "Service Unavailable: circuit breaker is open", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Unhealthy targets are checked again after their interval
+	for _, t := range targets {
+		if t.Health != nil && (retryAfter == 0 || t.Health.Interval() < retryAfter) {
+			retryAfter = t.Health.Interval()
+		}
+	}
+	metrics.UpstreamErrors.WithLabelValues(endpoint, "unhealthy").Inc()
+	logger.WarnContext(r.Context(), "All upstreams are unhealthy, rejecting request", "upstreams", len(targets))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(retryAfter)))
+	http.Error(w, "Service Unavailable: upstream is unhealthy", http.StatusServiceUnavailable)
+}
+
+// retryAfterSeconds converts a wait to a Retry-After value, at least 1 second.
+func retryAfterSeconds(wait time.Duration) int {
+	return int(max(math.Ceil(wait.Seconds()), 1))
+}
 
-		timeout := cfg.GetEffectiveTimeout(endpoint)
-		executeProxyRequest(proxyReq, w, timeout, cfg.CORS)
-	})
+// breakerSuccess reports whether a completed upstream request counts as a
+// success for its circuit breaker. Requests canceled by the client are
+// neither successes nor failures, they are not recorded.
+func breakerSuccess(resp *http.Response, err error) bool {
+	return err == nil && resp.StatusCode < http.StatusInternalServerError
 }
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// Compare proxy throughput with the pooled transport built for each endpoint
+// against the previous behavior: clients without a transport, so upstream
+// requests go through http.DefaultTransport, which keeps at most 2 idle
+// connections per host. The handler is the same, only the transport changes.
+//
+//	go test -run=^$ -bench=Proxy -benchmem -cpu=4 ./handlers
+
+// benchmarkConcurrency is the number of requests in flight per CPU, above the
+// idle connections kept per host by http.DefaultTransport so connections it
+// cannot keep are closed and dialed again.
+const benchmarkConcurrency = 16
+
+func newBenchmarkBackend() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+}
+
+func runProxyBenchmark(b *testing.B, endpoint config.Endpoint, opts ...ProxyOption) {
+	backend := newBenchmarkBackend()
+	defer backend.Close()
+
+	endpoint.Path = "/bench"
+	endpoint.RemoteURL = backend.URL
+	handler := ProxyHandler(endpoint, config.Config{Server: config.ServerConfig{DefaultTimeout: "10s"}}, opts...)
+
+	b.SetParallelism(benchmarkConcurrency)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req := httptest.NewRequest("GET", "/bench/items", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				b.Fatalf("unexpected status %d", w.Code)
+			}
+		}
+	})
+}
+
+func BenchmarkProxyHandlerSharedTransport(b *testing.B) {
+	runProxyBenchmark(b, config.Endpoint{})
+}
+
+func BenchmarkProxyHandlerDefaultTransport(b *testing.B) {
+	// The idle connections of the default transport are shared with other
+	// tests and benchmarks of the package, drop them before and after
+	http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	defer http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+
+	runProxyBenchmark(b, config.Endpoint{}, withTransport(http.DefaultTransport))
+}
+
+func BenchmarkProxyHandlerKeepAliveDisabled(b *testing.B) {
+	disabled := false
+	runProxyBenchmark(b, config.Endpoint{Transport: config.TransportConfig{KeepAlive: &disabled}})
+}
@@ -1,16 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/health"
+	"github.com/bastienwirtz/corsair/metrics"
+	"github.com/bastienwirtz/corsair/transport"
 )
 
 func TestProxyHandler(t *testing.T) {
@@ -313,3 +320,226 @@ func TestCORSHeaderFiltering(t *testing.T) {
 		})
 	}
 }
+
+func TestUpstreamErrorKind(t *testing.T) {
+	timeoutServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer timeoutServer.Close()
+
+	u := newUpstream("/test", config.TransportConfig{}, 50*time.Millisecond, nil, config.CORSConfig{})
+	_, err := u.client.Get(timeoutServer.URL)
+	assert.Equal(t, "timeout", upstreamErrorKind(err))
+
+	_, err = u.client.Get("http://localhost:1")
+	assert.Equal(t, "connection", upstreamErrorKind(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", timeoutServer.URL, nil)
+	_, err = u.client.Do(req)
+	assert.Equal(t, "canceled", upstreamErrorKind(err))
+
+	assert.Equal(t, "blocked", upstreamErrorKind(&transport.BlockedError{Destination: "10.0.0.1", Reason: "private address"}))
+}
+
+func TestProxyHandlerUnhealthyUpstream(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	proxied := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status" {
+			if !healthy.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		proxied++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{
+		Path:      "/api",
+		RemoteURL: mockServer.URL,
+		HealthCheck: &config.HealthCheckConfig{
+			Path:               "/status",
+			Interval:           "10ms",
+			UnhealthyThreshold: 1,
+			HealthyThreshold:   1,
+		},
+	}
+	checker := health.NewChecker()
+	handler := ProxyHandler(endpoint, config.Config{Server: config.ServerConfig{DefaultTimeout: "1s"}}, WithHealthChecker(checker))
+	checker.Start()
+	defer checker.Stop()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	healthy.Store(false)
+	assert.Eventually(t, func() bool { return checker.Check("/api") != nil }, time.Second, 5*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Equal(t, 1, proxied)
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return checker.Check("/api") == nil }, time.Second, 5*time.Millisecond)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestProxyHandlerLoadBalancing(t *testing.T) {
+	newBackend := func(name string, healthy bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !healthy {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(name + " " + r.URL.Path))
+		}))
+	}
+	backendA := newBackend("a", true)
+	defer backendA.Close()
+	backendB := newBackend("b", true)
+	defer backendB.Close()
+	backendDown := newBackend("down", false)
+	defer backendDown.Close()
+
+	t.Run("round robin", func(t *testing.T) {
+		endpoint := config.Endpoint{
+			Path:       "/api",
+			RemoteURLs: []string{backendA.URL + "/v1", backendB.URL + "/v1"},
+		}
+		handler := ProxyHandler(endpoint, config.Config{})
+
+		var bodies []string
+		for range 4 {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			bodies = append(bodies, w.Body.String())
+		}
+		assert.ElementsMatch(t, []string{"a /v1/users", "b /v1/users", "a /v1/users", "b /v1/users"}, bodies)
+		assert.NotEqual(t, bodies[0], bodies[1])
+	})
+
+	t.Run("unhealthy upstreams are skipped", func(t *testing.T) {
+		endpoint := config.Endpoint{
+			Path:        "/api",
+			Upstreams:   []config.UpstreamConfig{{URL: backendDown.URL, Weight: 5}, {URL: backendA.URL}},
+			HealthCheck: &config.HealthCheckConfig{Interval: "1h", UnhealthyThreshold: 1},
+		}
+		checker := health.NewChecker()
+		handler := ProxyHandler(endpoint, config.Config{}, WithHealthChecker(checker))
+		checker.Start()
+		defer checker.Stop()
+
+		// The down upstream is unhealthy once its first check completes
+		assert.Eventually(t, func() bool {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+			return w.Body.String() == "a /users"
+		}, time.Second, 5*time.Millisecond)
+		for range 5 {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+			assert.Equal(t, "a /users", w.Body.String())
+		}
+	})
+}
+
+func TestProxyHandlerCircuitBreaker(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var calls atomic.Int32
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{
+		Path:           "/api",
+		RemoteURL:      mockServer.URL,
+		CircuitBreaker: &config.CircuitBreakerConfig{MinRequests: 3, OpenDuration: "50ms"},
+	}
+	handler := ProxyHandler(endpoint, config.Config{})
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+		return w
+	}
+
+	for range 3 {
+		assert.Equal(t, http.StatusInternalServerError, get().Code)
+	}
+
+	// Open: requests are rejected without reaching the upstream
+	w := get()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "circuit breaker is open")
+	assert.Equal(t, int32(3), calls.Load())
+
+	// Half-open after the open duration, a successful probe closes it
+	failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, http.StatusOK, get().Code)
+	assert.Equal(t, http.StatusOK, get().Code)
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestProxyHandlerCircuitBreakerCanceled(t *testing.T) {
+	var failing, slow atomic.Bool
+	failing.Store(true)
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-r.Context().Done()
+			return
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer mockServer.Close()
+
+	endpoint := config.Endpoint{
+		Path:           "/breaker-canceled",
+		RemoteURL:      mockServer.URL,
+		CircuitBreaker: &config.CircuitBreakerConfig{MinRequests: 1, OpenDuration: "50ms"},
+	}
+	handler := ProxyHandler(endpoint, config.Config{})
+	state := func() float64 {
+		return testutil.ToFloat64(metrics.CircuitBreakerState.WithLabelValues(endpoint.Path, strings.TrimPrefix(mockServer.URL, "http://")))
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/breaker-canceled/users", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, float64(1), state(), "open")
+
+	// A probe canceled by the client does not close the breaker
+	time.Sleep(60 * time.Millisecond)
+	slow.Store(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/breaker-canceled/users", nil).WithContext(ctx))
+	assert.Equal(t, float64(2), state(), "half-open")
+
+	// The next probe is let through
+	slow.Store(false)
+	failing.Store(false)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/breaker-canceled/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, float64(0), state(), "closed")
+}
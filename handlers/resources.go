@@ -0,0 +1,44 @@
+package handlers
+
+import "sync"
+
+// Resources collects what handlers hold beyond the requests they serve, such
+// as idle upstream connections, so it can be released once the handlers are
+// replaced.
+type Resources struct {
+	mu      sync.Mutex
+	release []func()
+}
+
+// WithResources registers the resources of the handler with resources.
+func WithResources(resources *Resources) ProxyOption {
+	return func(o *proxyOptions) {
+		o.resources = resources
+	}
+}
+
+func (r *Resources) add(release func()) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.release = append(r.release, release)
+}
+
+// Release releases the collected resources. Handlers remain safe to use
+// afterwards, requests still in flight complete normally. Nil resources can
+// be released.
+func (r *Resources) Release() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	release := r.release
+	r.release = nil
+	r.mu.Unlock()
+
+	for _, f := range release {
+		f()
+	}
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestResourcesRelease(t *testing.T) {
+	var released int
+	resources := &Resources{}
+	resources.add(func() { released++ })
+	resources.add(func() { released++ })
+
+	resources.Release()
+	resources.Release()
+	assert.Equal(t, 2, released, "resources are released once")
+
+	var none *Resources
+	none.add(func() { released++ })
+	none.Release()
+	assert.Equal(t, 2, released)
+}
+
+func TestProxyHandlerReleaseIdleConnections(t *testing.T) {
+	var closed atomic.Int32
+	mockServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	mockServer.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	mockServer.Start()
+	defer mockServer.Close()
+
+	resources := &Resources{}
+	endpoint := config.Endpoint{Path: "/api", RemoteURL: mockServer.URL}
+	handler := ProxyHandler(endpoint, config.Config{}, WithResources(resources))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int32(0), closed.Load(), "connection kept idle")
+
+	resources.Release()
+	assert.Eventually(t, func() bool { return closed.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
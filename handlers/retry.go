@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/retry"
+)
+
+// retryBackoff returns why a failed attempt should be retried and how long
+// to wait before, or an empty reason when it should not be retried. Responses
+// asking to retry later than the maximum backoff are not retried.
+func retryBackoff(cfg *config.RetryConfig, attempt int, resp *http.Response, err error) (time.Duration, string) {
+	if cfg == nil {
+		return 0, ""
+	}
+	if err != nil {
+		kind := upstreamErrorKind(err)
+		if !slices.Contains(cfg.GetOnErrors(), kind) {
+			return 0, ""
+		}
+		return retry.Backoff(attempt, cfg.GetInitialBackoff(), cfg.GetMaxBackoff()), kind
+	}
+	if !slices.Contains(cfg.GetOnStatus(), resp.StatusCode) {
+		return 0, ""
+	}
+	if wait, ok := retry.RetryAfter(resp.Header, time.Now()); ok {
+		if wait > cfg.GetMaxBackoff() {
+			return 0, ""
+		}
+		return wait, "status"
+	}
+	return retry.Backoff(attempt, cfg.GetInitialBackoff(), cfg.GetMaxBackoff()), "status"
+}
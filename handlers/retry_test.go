@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/retry"
+)
+
+func TestProxyHandlerRetry(t *testing.T) {
+	zero := 0.0
+	none := 0
+
+	tests := []struct {
+		name       string
+		retry      config.RetryConfig
+		budget     *retry.Budget
+		method     string
+		failures   int32 // requests failing before the upstream recovers
+		failure    func(w http.ResponseWriter, r *http.Request)
+		wantStatus int
+		wantCalls  int32
+	}{
+		{
+			name:       "retried until success",
+			method:     "GET",
+			failures:   2,
+			failure:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			wantStatus: http.StatusOK,
+			wantCalls:  3,
+		},
+		{
+			name:       "max attempts reached",
+			retry:      config.RetryConfig{MaxAttempts: 2},
+			method:     "GET",
+			failures:   5,
+			failure:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+			wantStatus: http.StatusBadGateway,
+			wantCalls:  2,
+		},
+		{
+			name:     "timeout",
+			method:   "GET",
+			failures: 1,
+			failure: func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(time.Second):
+				}
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:       "status not retryable",
+			method:     "GET",
+			failures:   1,
+			failure:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) },
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name:       "non idempotent method",
+			method:     "POST",
+			failures:   1,
+			failure:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  1,
+		},
+		{
+			name:       "non idempotent method allowed",
+			retry:      config.RetryConfig{NonIdempotent: true},
+			method:     "POST",
+			failures:   1,
+			failure:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:     "retry after honored",
+			method:   "GET",
+			failures: 1,
+			failure: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantStatus: http.StatusOK,
+			wantCalls:  2,
+		},
+		{
+			name:     "retry after beyond max backoff",
+			method:   "GET",
+			failures: 1,
+			failure: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "120")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  1,
+		},
+		{
+			name:       "budget exhausted",
+			budget:     retry.NewBudget(config.RetryBudgetConfig{Ratio: &zero, MinRetriesPerSecond: &none}),
+			method:     "GET",
+			failures:   1,
+			failure:    func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			wantStatus: http.StatusServiceUnavailable,
+			wantCalls:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if calls.Add(1) <= tt.failures {
+					tt.failure(w, r)
+					return
+				}
+				w.Write(body)
+			}))
+			defer mockServer.Close()
+
+			retryConfig := tt.retry
+			retryConfig.InitialBackoff = "1ms"
+			retryConfig.MaxBackoff = "10ms"
+			endpoint := config.Endpoint{
+				Path:      "/api",
+				RemoteURL: mockServer.URL,
+				Timeout:   "100ms",
+				Retry:     &retryConfig,
+			}
+			handler := ProxyHandler(endpoint, config.Config{}, WithRetryBudget(tt.budget))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, "/api/users", strings.NewReader("payload")))
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantCalls, calls.Load())
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, "payload", w.Body.String(), "the body is sent again on retries")
+			}
+		})
+	}
+}
+
+func TestProxyHandlerRetryWithFailover(t *testing.T) {
+	var primaryCalls, backupCalls atomic.Int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer primary.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if backupCalls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("backup"))
+	}))
+	defer backup.Close()
+
+	endpoint := config.Endpoint{
+		Path:      "/api",
+		RemoteURL: primary.URL,
+		Failover:  &config.FailoverConfig{Upstreams: []string{backup.URL}, OnStatus: []int{http.StatusServiceUnavailable}},
+		Retry:     &config.RetryConfig{InitialBackoff: "1ms", MaxBackoff: "1ms"},
+	}
+	handler := ProxyHandler(endpoint, config.Config{})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+
+	// Each attempt goes through the primary, then the backup upstream
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "backup", w.Body.String())
+	assert.Equal(t, int32(2), primaryCalls.Load())
+	assert.Equal(t, int32(2), backupCalls.Load())
+}
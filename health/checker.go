@@ -0,0 +1,263 @@
+// Package health runs active health checks against upstream servers.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+// State is the health of an upstream target.
+type State int32
+
+const (
+	// StateUnknown is the state until the first check completes. Unknown
+	// targets receive traffic.
+	StateUnknown State = iota
+	StateHealthy
+	StateUnhealthy
+)
+
+func (s State) String() string {
+	switch s {
+	case StateHealthy:
+		return "healthy"
+	case StateUnhealthy:
+		return "unhealthy"
+	}
+	return "unknown"
+}
+
+// maxBodySize bounds how much of a health check response is read so the
+// connection can be reused.
+const maxBodySize = 64 << 10
+
+// Target is an upstream server checked periodically.
+type Target struct {
+	endpoint string
+	name     string // host of the upstream, used in logs and metrics
+	checkURL string
+	header   http.Header
+	cfg      config.HealthCheckConfig
+	client   *http.Client
+	state    atomic.Int32
+
+	// Only accessed by the goroutine running the checks
+	successes int
+	failures  int
+}
+
+// State returns the current state of the target.
+func (t *Target) State() State {
+	return State(t.state.Load())
+}
+
+// Healthy reports whether the target may receive traffic, which is the case
+// unless it failed its health checks.
+func (t *Target) Healthy() bool {
+	return t.State() != StateUnhealthy
+}
+
+// Name returns the host of the target.
+func (t *Target) Name() string {
+	return t.name
+}
+
+// Interval returns the time between two checks of the target.
+func (t *Target) Interval() time.Duration {
+	return t.cfg.GetInterval()
+}
+
+// Checker runs the health checks of a set of targets in the background.
+type Checker struct {
+	mu      sync.Mutex
+	targets map[string][]*Target // by endpoint path
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func NewChecker() *Checker {
+	return &Checker{targets: make(map[string][]*Target)}
+}
+
+// Add registers a target of endpoint located at remoteURL. Checks send header
+// and use transport, so they share the connection pool and settings of
+// proxied requests. Targets must be added before Start.
+func (c *Checker) Add(endpoint, remoteURL string, header http.Header, cfg config.HealthCheckConfig, transport http.RoundTripper) (*Target, error) {
+	target, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+	checkURL := *target
+	checkURL.Path = strings.TrimSuffix(target.Path, "/") + cfg.Path
+	if cfg.Path == "" {
+		checkURL.Path = target.Path
+	}
+
+	t := &Target{
+		endpoint: endpoint,
+		name:     target.Host,
+		checkURL: checkURL.String(),
+		header:   header,
+		cfg:      cfg,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.GetTimeout(),
+			// A redirect is a valid answer from a health endpoint
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets[endpoint] = append(c.targets[endpoint], t)
+	return t, nil
+}
+
+// Check returns an error when endpoint has health checked targets and none of
+// them is healthy.
+func (c *Checker) Check(endpoint string) error {
+	c.mu.Lock()
+	targets := c.targets[endpoint]
+	c.mu.Unlock()
+
+	if len(targets) == 0 {
+		return nil
+	}
+	var unhealthy []string
+	for _, t := range targets {
+		if t.Healthy() {
+			return nil
+		}
+		unhealthy = append(unhealthy, t.name)
+	}
+	return fmt.Errorf("no healthy upstream, unhealthy: %s", strings.Join(unhealthy, ", "))
+}
+
+// Start runs the checks of all targets until Stop is called.
+func (c *Checker) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	for _, targets := range c.targets {
+		for _, t := range targets {
+			c.wg.Go(func() { t.run(ctx) })
+		}
+	}
+}
+
+// Stop stops the checks and waits for running ones to return. A nil checker
+// can be stopped.
+func (c *Checker) Stop() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	cancel := c.cancel
+	c.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	c.wg.Wait()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, targets := range c.targets {
+		for _, t := range targets {
+			metrics.UpstreamHealthy.DeleteLabelValues(t.endpoint, t.name)
+		}
+	}
+}
+
+func (t *Target) run(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.GetInterval())
+	defer ticker.Stop()
+
+	for {
+		err := t.check(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		t.record(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check sends one health check request.
+func (t *Target) check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.checkURL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range t.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("User-Agent", "corsair-health-check")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodySize))
+
+	if !t.cfg.ExpectsStatus(resp.StatusCode) {
+		return errors.New("unexpected status " + resp.Status)
+	}
+	return nil
+}
+
+// record updates the state from a check result. The first result sets the
+// state directly, then thresholds of consecutive results must be reached.
+func (t *Target) record(err error) {
+	logger := slog.With("endpoint", t.endpoint, "target", t.name)
+	previous := t.State()
+
+	if err == nil {
+		metrics.HealthChecks.WithLabelValues(t.endpoint, t.name, "success").Inc()
+		t.successes++
+		t.failures = 0
+		if previous == StateUnknown || (previous == StateUnhealthy && t.successes >= t.cfg.GetHealthyThreshold()) {
+			t.state.Store(int32(StateHealthy))
+			logger.Info("Upstream is healthy", "previous_state", previous.String())
+		}
+	} else {
+		metrics.HealthChecks.WithLabelValues(t.endpoint, t.name, "failure").Inc()
+		t.failures++
+		t.successes = 0
+		logger.Debug("Health check failed", "error", err, "consecutive_failures", t.failures)
+		if previous == StateUnknown || (previous == StateHealthy && t.failures >= t.cfg.GetUnhealthyThreshold()) {
+			t.state.Store(int32(StateUnhealthy))
+			logger.Warn("Upstream is unhealthy", "previous_state", previous.String(), "error", err)
+		}
+	}
+
+	healthy := 0.0
+	if t.Healthy() {
+		healthy = 1
+	}
+	metrics.UpstreamHealthy.WithLabelValues(t.endpoint, t.name).Set(healthy)
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+func TestTargetRecord(t *testing.T) {
+	failed := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		results  []error
+		expected []State
+	}{
+		{
+			name:     "first success is healthy",
+			results:  []error{nil},
+			expected: []State{StateHealthy},
+		},
+		{
+			name:     "first failure is unhealthy",
+			results:  []error{failed},
+			expected: []State{StateUnhealthy},
+		},
+		{
+			name:     "unhealthy after threshold of consecutive failures",
+			results:  []error{nil, failed, failed, nil, failed, failed, failed},
+			expected: []State{StateHealthy, StateHealthy, StateHealthy, StateHealthy, StateHealthy, StateHealthy, StateUnhealthy},
+		},
+		{
+			name:     "healthy after threshold of consecutive successes",
+			results:  []error{failed, nil, failed, nil, nil},
+			expected: []State{StateUnhealthy, StateUnhealthy, StateUnhealthy, StateUnhealthy, StateHealthy},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := &Target{endpoint: "/test-record", name: "api.example.com", cfg: config.HealthCheckConfig{}}
+			for i, result := range tt.results {
+				target.record(result)
+				assert.Equal(t, tt.expected[i], target.State(), "after check %d", i+1)
+			}
+		})
+	}
+}
+
+func TestCheckerAdd(t *testing.T) {
+	tests := []struct {
+		name      string
+		remoteURL string
+		path      string
+		expected  string
+	}{
+		{name: "remote URL", remoteURL: "https://api.example.com/v1", expected: "https://api.example.com/v1"},
+		{name: "path appended", remoteURL: "https://api.example.com/v1/", path: "/health", expected: "https://api.example.com/v1/health"},
+		{name: "query kept", remoteURL: "https://api.example.com?tenant=1", path: "/health", expected: "https://api.example.com/health?tenant=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := NewChecker().Add("/api", tt.remoteURL, nil, config.HealthCheckConfig{Path: tt.path}, http.DefaultTransport)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, target.checkURL)
+			assert.Equal(t, StateUnknown, target.State())
+			assert.True(t, target.Healthy())
+		})
+	}
+}
+
+func TestChecker(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	var authorization atomic.Value
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/health", r.URL.Path)
+		authorization.Store(r.Header.Get("Authorization"))
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer upstream.Close()
+
+	checker := NewChecker()
+	cfg := config.HealthCheckConfig{Path: "/health", Interval: "10ms", HealthyThreshold: 1, UnhealthyThreshold: 1}
+	header := http.Header{"Authorization": {"Bearer token"}}
+	target, err := checker.Add("/test-checker", upstream.URL+"/v1", header, cfg, http.DefaultTransport)
+	require.NoError(t, err)
+	assert.NoError(t, checker.Check("/test-checker"))
+
+	checker.Start()
+	defer checker.Stop()
+
+	assert.Eventually(t, func() bool { return target.State() == StateHealthy }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "Bearer token", authorization.Load())
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.UpstreamHealthy.WithLabelValues("/test-checker", target.Name())))
+
+	status.Store(http.StatusServiceUnavailable)
+	assert.Eventually(t, func() bool { return target.State() == StateUnhealthy }, time.Second, 5*time.Millisecond)
+	assert.ErrorContains(t, checker.Check("/test-checker"), "no healthy upstream")
+	assert.NoError(t, checker.Check("/unchecked"))
+	assert.Positive(t, testutil.ToFloat64(metrics.HealthChecks.WithLabelValues("/test-checker", target.Name(), "failure")))
+
+	status.Store(http.StatusOK)
+	assert.Eventually(t, func() bool { return target.Healthy() }, time.Second, 5*time.Millisecond)
+}
+
+func TestCheckerExpectedStatus(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer upstream.Close()
+
+	target, err := NewChecker().Add("/api", upstream.URL, nil, config.HealthCheckConfig{ExpectedStatus: http.StatusOK}, http.DefaultTransport)
+	require.NoError(t, err)
+	assert.ErrorContains(t, target.check(t.Context()), "unexpected status 204")
+
+	target.cfg.ExpectedStatus = 0
+	assert.NoError(t, target.check(t.Context()))
+}
+
+func TestCheckerStop(t *testing.T) {
+	var nilChecker *Checker
+	nilChecker.Stop()
+
+	// Stopping a checker that never started does not block
+	NewChecker().Stop()
+}
@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds all Corsair metrics.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 30s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Metrics are labeled by configured endpoint path rather than request URL,
+// so cardinality stays bounded by the configuration.
+var (
+	RequestsTotal = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_requests_total",
+		Help: "Total number of requests handled, by endpoint, method and status code.",
+	}, []string{"endpoint", "method", "code"})
+	RequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "corsair_request_duration_seconds",
+		Help:    "Time spent handling requests, including the upstream request.",
+		Buckets: DefaultBuckets,
+	}, []string{"endpoint", "method"})
+	RequestsInFlight = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "corsair_requests_in_flight",
+		Help: "Number of requests currently being handled.",
+	}, []string{"endpoint"})
+	RequestBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_request_bytes_total",
+		Help: "Total number of request body bytes received from clients.",
+	}, []string{"endpoint"})
+	ResponseBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_response_bytes_total",
+		Help: "Total number of response body bytes sent to clients.",
+	}, []string{"endpoint"})
+
+	UpstreamResponses = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_upstream_responses_total",
+		Help: "Total number of upstream responses, by endpoint and status code.",
+	}, []string{"endpoint", "code"})
+	UpstreamErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_upstream_errors_total",
+		Help: "Total number of failed upstream requests, by endpoint and error kind (timeout, connection, canceled, blocked, unhealthy, circuit_open).",
+	}, []string{"endpoint", "kind"})
+	UpstreamDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "corsair_upstream_request_duration_seconds",
+		Help:    "Time until upstream response headers are received.",
+		Buckets: DefaultBuckets,
+	}, []string{"endpoint"})
+	UpstreamFailovers = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_upstream_failovers_total",
+		Help: "Total number of requests sent again to a backup upstream, by endpoint and reason (timeout, connection, status).",
+	}, []string{"endpoint", "reason"})
+	UpstreamRetries = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_upstream_retries_total",
+		Help: "Total number of retried upstream requests, by endpoint and reason (timeout, connection, status).",
+	}, []string{"endpoint", "reason"})
+	RetryBudgetExhausted = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_retry_budget_exhausted_total",
+		Help: "Total number of retries skipped because the retry budget was exhausted.",
+	}, []string{"endpoint"})
+
+	UpstreamHealthy = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "corsair_upstream_healthy",
+		Help: "Whether the upstream passes its active health checks (1) or not (0).",
+	}, []string{"endpoint", "target"})
+	HealthChecks = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_health_checks_total",
+		Help: "Total number of active health checks, by endpoint, target and result (success, failure).",
+	}, []string{"endpoint", "target", "result"})
+
+	CircuitBreakerState = factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "corsair_circuit_breaker_state",
+		Help: "State of the circuit breaker of an upstream: closed (0), open (1) or half-open (2).",
+	}, []string{"endpoint", "target"})
+	CircuitBreakerTransitions = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_circuit_breaker_transitions_total",
+		Help: "Total number of circuit breaker state changes, by endpoint, target and new state (closed, open, half_open).",
+	}, []string{"endpoint", "target", "state"})
+
+	CoalescedRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_coalesced_requests_total",
+		Help: "Total number of requests sharing the upstream response of an identical request in flight.",
+	}, []string{"endpoint"})
+
+	CacheRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_cache_requests_total",
+		Help: "Total number of requests looked up in the response cache, by endpoint and result (hit, miss, stale).",
+	}, []string{"endpoint", "result"})
+	CacheStaleOnError = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_cache_stale_on_error_total",
+		Help: "Total number of failed upstream requests answered with a stale cached response.",
+	}, []string{"endpoint"})
+	CacheRevalidations = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "corsair_cache_revalidations_total",
+		Help: "Total number of expired cached responses revalidated upstream, by endpoint and result (not_modified, modified).",
+	}, []string{"endpoint", "result"})
+	CacheSize = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "corsair_cache_size_bytes",
+		Help: "Approximate memory used by the cached responses.",
+	})
+	CacheEntries = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "corsair_cache_entries",
+		Help: "Number of cached responses.",
+	})
+	CacheEvictions = factory.NewCounter(prometheus.CounterOpts{
+		Name: "corsair_cache_evictions_total",
+		Help: "Total number of cached responses evicted to stay within the cache size.",
+	})
+)
+
+// Handler serves the metrics in the format negotiated with the scraper, the
+// Prometheus text exposition format by default.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Method normalizes HTTP methods so unknown methods cannot inflate label cardinality.
+func Method(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
@@ -0,0 +1,28 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler(t *testing.T) {
+	// Families are only exported once they have a series
+	RequestsTotal.WithLabelValues("/test", "GET", "200").Inc()
+	defer RequestsTotal.DeleteLabelValues("/test", "GET", "200")
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain")
+	assert.Contains(t, w.Body.String(), "# TYPE corsair_requests_total counter")
+	assert.Contains(t, w.Body.String(), `corsair_requests_total{code="200",endpoint="/test",method="GET"} 1`)
+}
+
+func TestMethod(t *testing.T) {
+	assert.Equal(t, "GET", Method("GET"))
+	assert.Equal(t, "OTHER", Method("PROPFIND"))
+}
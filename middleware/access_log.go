@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// RequestInfo holds request details resolved by handlers, such as the matched
+// endpoint, so they can be reported in the access log.
+type RequestInfo struct {
+	Endpoint    string
+	UpstreamURL string
+	Retries     int
+}
+
+type requestInfoKey struct{}
+
+// RequestInfoFromContext returns the request details of ctx, or nil when the
+// access log is disabled.
+func RequestInfoFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+	return info
+}
+
+// WithoutRequestInfo returns a copy of ctx in which request details are no
+// longer recorded, for work outliving the logged request.
+func WithoutRequestInfo(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, (*RequestInfo)(nil))
+}
+
+// SetEndpoint records the configured endpoint path handling the request.
+func SetEndpoint(ctx context.Context, endpoint string) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.Endpoint = endpoint
+	}
+}
+
+// SetUpstreamURL records the URL the request is proxied to.
+func SetUpstreamURL(ctx context.Context, upstreamURL string) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.UpstreamURL = upstreamURL
+	}
+}
+
+// SetRetries records the number of times the upstream request was retried.
+func SetRetries(ctx context.Context, retries int) {
+	if info := RequestInfoFromContext(ctx); info != nil {
+		info.Retries = retries
+	}
+}
+
+// AccessLogger logs one line per completed request through the default
+// slog logger, so it follows the logging configuration. The request ID is
+// added by the logger from the request context.
+type AccessLogger struct {
+	format       string
+	sampleRatio  float64
+	excludePaths []string
+}
+
+// NewAccessLogger returns an access logger, or nil when the access log is disabled.
+func NewAccessLogger(cfg config.AccessLogConfig) *AccessLogger {
+	if !cfg.Enabled {
+		return nil
+	}
+	excludePaths := make([]string, 0, len(cfg.ExcludePaths))
+	for _, path := range cfg.ExcludePaths {
+		excludePaths = append(excludePaths, strings.TrimSuffix(path, "/"))
+	}
+	return &AccessLogger{
+		format:       cfg.GetFormat(),
+		sampleRatio:  cfg.GetSampleRatio(),
+		excludePaths: excludePaths,
+	}
+}
+
+// Middleware wraps next to log its requests. A nil logger returns next unchanged.
+func (l *AccessLogger) Middleware(next http.Handler) http.Handler {
+	if l == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if l.excluded(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Inner middlewares may rewrite the URL, log the original one
+		start := time.Now()
+		requestURI := r.URL.RequestURI()
+		path := r.URL.Path
+
+		info := &RequestInfo{}
+		recorder := newResponseRecorder(w)
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+
+		status := recorder.Status()
+		// Server errors are always logged, other requests are sampled
+		if status < http.StatusInternalServerError && l.sampleRatio < 1 && rand.Float64() >= l.sampleRatio {
+			return
+		}
+
+		duration := time.Since(start)
+		switch l.format {
+		case "common", "combined":
+			slog.InfoContext(r.Context(), l.formatCLF(r, requestURI, status, recorder.bytes, start))
+		default:
+			slog.LogAttrs(r.Context(), slog.LevelInfo, "Request completed",
+				slog.String("method", r.Method),
+				slog.String("path", path),
+				slog.String("endpoint", info.Endpoint),
+				slog.String("upstream_url", info.UpstreamURL),
+				slog.Int("retries", info.Retries),
+				slog.Int("status", status),
+				slog.Int64("bytes", recorder.bytes),
+				slog.Duration("duration", duration),
+				slog.String("client_ip", clientIP(r)),
+				slog.String("origin", r.Header.Get("Origin")),
+			)
+		}
+	})
+}
+
+// excluded reports whether path is one of the excluded paths or below one.
+func (l *AccessLogger) excluded(path string) bool {
+	for _, excluded := range l.excludePaths {
+		if path == excluded || strings.HasPrefix(path, excluded+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatCLF formats a request in Common Log Format, or Combined Log Format
+// which adds the referer and user agent.
+func (l *AccessLogger) formatCLF(r *http.Request, requestURI string, status int, bytes int64, start time.Time) string {
+	size := "-"
+	if bytes > 0 {
+		size = strconv.FormatInt(bytes, 10)
+	}
+	user := "-"
+	if username, _, ok := r.BasicAuth(); ok && username != "" {
+		user = escapeCLF(username)
+	}
+
+	var b strings.Builder
+	b.WriteString(clientIP(r))
+	b.WriteString(" - ")
+	b.WriteString(user)
+	b.WriteString(" [")
+	b.WriteString(start.Format("02/Jan/2006:15:04:05 -0700"))
+	b.WriteString(`] "`)
+	b.WriteString(escapeCLF(r.Method + " " + requestURI + " " + r.Proto))
+	b.WriteString(`" `)
+	b.WriteString(strconv.Itoa(status))
+	b.WriteString(" ")
+	b.WriteString(size)
+	if l.format == "combined" {
+		b.WriteString(` "`)
+		b.WriteString(escapeCLF(r.Referer()))
+		b.WriteString(`" "`)
+		b.WriteString(escapeCLF(r.UserAgent()))
+		b.WriteString(`"`)
+	}
+	return b.String()
+}
+
+func escapeCLF(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// clientIP returns the IP address of the client connection.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// captureLogs redirects the default logger to a buffer for the duration of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func TestAccessLogJSON(t *testing.T) {
+	logs := captureLogs(t)
+
+	logger := NewAccessLogger(config.AccessLogConfig{Enabled: true})
+	handler := logger.Middleware(TrailingSlash()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetEndpoint(r.Context(), "/api")
+		SetUpstreamURL(r.Context(), "https://api.example.com/users")
+		SetRetries(r.Context(), 2)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})))
+
+	req := httptest.NewRequest("POST", "/api/users?page=2", nil)
+	req.RemoteAddr = "203.0.113.7:52100"
+	req.Header.Set("Origin", "https://app.example.com")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "Request completed", entry["msg"])
+	assert.Equal(t, "POST", entry["method"])
+	assert.Equal(t, "/api/users", entry["path"])
+	assert.Equal(t, "/api", entry["endpoint"])
+	assert.Equal(t, "https://api.example.com/users", entry["upstream_url"])
+	assert.Equal(t, float64(2), entry["retries"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, float64(7), entry["bytes"])
+	assert.Contains(t, entry, "duration")
+	assert.Equal(t, "203.0.113.7", entry["client_ip"])
+	assert.Equal(t, "https://app.example.com", entry["origin"])
+}
+
+func TestAccessLogCLF(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+		absent   string
+	}{
+		{
+			name:     "common",
+			format:   "common",
+			expected: `203.0.113.7 - alice [`,
+			absent:   `curl/8.0`,
+		},
+		{
+			name:     "combined",
+			format:   "combined",
+			expected: `"GET /api/items?id=\"1\" HTTP/1.1" 200 2 "https://app.example.com/" "curl/8.0"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			logger := NewAccessLogger(config.AccessLogConfig{Enabled: true, Format: tt.format})
+			handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+
+			req := httptest.NewRequest("GET", `/api/items?id="1"`, nil)
+			req.RemoteAddr = "203.0.113.7:52100"
+			req.SetBasicAuth("alice", "secret")
+			req.Header.Set("Referer", "https://app.example.com/")
+			req.Header.Set("User-Agent", "curl/8.0")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+			msg := entry["msg"].(string)
+			assert.Contains(t, msg, tt.expected)
+			assert.Contains(t, msg, `" 200 2`)
+			if tt.absent != "" {
+				assert.NotContains(t, msg, tt.absent)
+			}
+		})
+	}
+}
+
+func TestAccessLogFiltering(t *testing.T) {
+	never := 0.0
+
+	tests := []struct {
+		name   string
+		config config.AccessLogConfig
+		path   string
+		status int
+		logged bool
+	}{
+		{
+			name:   "logged",
+			config: config.AccessLogConfig{Enabled: true},
+			path:   "/api/",
+			status: http.StatusOK,
+			logged: true,
+		},
+		{
+			name:   "excluded path",
+			config: config.AccessLogConfig{Enabled: true, ExcludePaths: []string{"/metrics"}},
+			path:   "/metrics",
+			status: http.StatusOK,
+		},
+		{
+			name:   "below excluded path",
+			config: config.AccessLogConfig{Enabled: true, ExcludePaths: []string{"/health/"}},
+			path:   "/health/live",
+			status: http.StatusOK,
+		},
+		{
+			name:   "excluded path matches whole segments",
+			config: config.AccessLogConfig{Enabled: true, ExcludePaths: []string{"/metrics"}},
+			path:   "/metrics-backend/",
+			status: http.StatusOK,
+			logged: true,
+		},
+		{
+			name:   "sampled out",
+			config: config.AccessLogConfig{Enabled: true, SampleRatio: &never},
+			path:   "/api/",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "server errors are always logged",
+			config: config.AccessLogConfig{Enabled: true, SampleRatio: &never},
+			path:   "/api/",
+			status: http.StatusBadGateway,
+			logged: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			logger := NewAccessLogger(tt.config)
+			handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+
+			assert.Equal(t, tt.logged, logs.Len() > 0)
+		})
+	}
+}
+
+func TestAccessLogDisabled(t *testing.T) {
+	logger := NewAccessLogger(config.AccessLogConfig{})
+	assert.Nil(t, logger)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Nil(t, RequestInfoFromContext(r.Context()))
+		SetEndpoint(r.Context(), "/api")
+	})
+	logger.Middleware(next).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/", nil))
+}
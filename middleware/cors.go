@@ -1,22 +1,44 @@
 package middleware
 
 import (
+	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/bastienwirtz/corsair/config"
 )
 
 // CORS returns a middleware that handles CORS headers and preflight requests.
-// Supports wildcard origins (*), specific origins, and subdomain wildcards (*.domain.com).
+// Supports wildcard origins (*), specific origins, subdomain and port wildcards
+// and regular expressions (see config.OriginPattern).
 // Prevents wildcard origins when credentials are enabled for security compliance.
+// Preflight requests asking for a disallowed origin, method or header are rejected with 403.
 func CORS(corsConfig config.CORSConfig) func(http.Handler) http.Handler {
+	originPatterns, err := config.ParseOriginPatterns(corsConfig.Origins)
+	if err != nil {
+		// Should not happen as patterns are checked during config validation
+		slog.Error("Invalid CORS origin patterns, no origin will be allowed", "error", err)
+	}
+	allowedMethods := parseHeaderList(corsConfig.Methods)
+	allowedHeaders := parseHeaderList(corsConfig.Headers)
+	maxAge := strconv.Itoa(int(corsConfig.GetMaxAge().Seconds()))
+
+	// With credentials, browsers treat "*" literally instead of as a wildcard,
+	// so the requested methods and headers are reflected instead.
+	reflectMethods := corsConfig.Credentials && corsConfig.Methods == "*"
+	reflectHeaders := corsConfig.Credentials && corsConfig.Headers == "*"
+
+	// Responses differ depending on the request origin unless any origin gets "*"
+	anyOrigin := corsConfig.WildcardOriginAllowed() && !corsConfig.Credentials
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
 
-			slog.Debug("Processing CORS request",
+			slog.DebugContext(r.Context(), "Processing CORS request",
 				"origin", origin,
 				"method", r.Method,
 				"path", r.URL.Path,
@@ -25,16 +47,21 @@ func CORS(corsConfig config.CORSConfig) func(http.Handler) http.Handler {
 
 			// Determine allowed origin: "*" only when single wildcard without credentials
 			allowedOrigin := ""
-			if corsConfig.WildcardOriginAllowed() && !corsConfig.Credentials {
+			if anyOrigin {
 				allowedOrigin = "*"
-			} else if isOriginAllowed(origin, corsConfig.Origins) {
+			} else if isOriginAllowed(origin, originPatterns) {
 				allowedOrigin = origin
 			} else if origin != "" {
-				slog.Warn("Origin rejected",
+				slog.WarnContext(r.Context(), "Origin rejected",
 					"origin", origin,
 					"allowed_origins", corsConfig.Origins)
 			}
 
+			if !anyOrigin {
+				// Shared caches must not serve a response allowed for one origin to another
+				w.Header().Add("Vary", "Origin")
+			}
+
 			if allowedOrigin != "" {
 				w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 			}
@@ -53,43 +80,162 @@ func CORS(corsConfig config.CORSConfig) func(http.Handler) http.Handler {
 
 			// Handle preflight OPTIONS requests
 			if r.Method == "OPTIONS" {
-				slog.Debug("Skiping remote url request for preflight request",
+				requestMethod := r.Header.Get("Access-Control-Request-Method")
+				requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+
+				if requestMethod != "" {
+					w.Header().Add("Vary", "Access-Control-Request-Method")
+					w.Header().Add("Vary", "Access-Control-Request-Headers")
+
+					if reason := checkPreflight(allowedOrigin, requestMethod, requestHeaders, allowedMethods, allowedHeaders); reason != "" {
+						slog.WarnContext(r.Context(), "Preflight request rejected",
+							"origin", origin,
+							"path", r.URL.Path,
+							"requested_method", requestMethod,
+							"requested_headers", requestHeaders,
+							"reason", reason)
+						clearCORSHeaders(w.Header())
+						http.Error(w, "CORS preflight rejected: "+reason, http.StatusForbidden)
+						return
+					}
+
+					if reflectMethods {
+						w.Header().Set("Access-Control-Allow-Methods", requestMethod)
+					}
+					if reflectHeaders {
+						if requestHeaders != "" {
+							w.Header().Set("Access-Control-Allow-Headers", requestHeaders)
+						} else {
+							w.Header().Del("Access-Control-Allow-Headers")
+						}
+					}
+				}
+
+				slog.DebugContext(r.Context(), "Skiping remote url request for preflight request",
 					"origin", origin,
 					"allowed", allowedOrigin != "",
 					"path", r.URL.Path)
-				w.Header().Set("Access-Control-Max-Age", "86400")
+				w.Header().Set("Access-Control-Max-Age", maxAge)
 				w.WriteHeader(http.StatusOK)
 				return
 			}
 
+			if corsConfig.Enforce {
+				if reason := checkEnforcedOrigin(r, corsConfig, originPatterns); reason != "" {
+					slog.WarnContext(r.Context(), "Request rejected by origin enforcement",
+						"origin", origin,
+						"referer", r.Header.Get("Referer"),
+						"method", r.Method,
+						"path", r.URL.Path,
+						"reason", reason)
+					clearCORSHeaders(w.Header())
+					http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+					return
+				}
+			}
+
+			if corsConfig.ExposeHeaders != "" {
+				w.Header().Set("Access-Control-Expose-Headers", corsConfig.ExposeHeaders)
+			}
+
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// checkPreflight returns the reason why a preflight request must be rejected,
+// or an empty string when the actual request is allowed.
+func checkPreflight(allowedOrigin, requestMethod, requestHeaders string, allowedMethods, allowedHeaders map[string]bool) string {
+	if allowedOrigin == "" {
+		return "origin not allowed"
+	}
+
+	// CORS-safelisted methods never require an explicit allowance
+	method := strings.ToUpper(strings.TrimSpace(requestMethod))
+	safelisted := method == "GET" || method == "HEAD" || method == "POST"
+	if !safelisted && !allowedMethods["*"] && !allowedMethods[method] {
+		return "method " + method + " not allowed"
+	}
+
+	if allowedHeaders["*"] {
+		return ""
+	}
+	for header := range strings.SplitSeq(requestHeaders, ",") {
+		header = strings.TrimSpace(header)
+		if header != "" && !allowedHeaders[strings.ToUpper(header)] {
+			return "header " + header + " not allowed"
+		}
+	}
+	return ""
+}
+
+// checkEnforcedOrigin returns the reason why a request must be rejected in
+// enforce mode, or an empty string when its origin is allowed. Requests without
+// an Origin header are checked using the Referer origin when the fallback is
+// enabled, and otherwise rejected unless missing origins are allowed.
+func checkEnforcedOrigin(r *http.Request, corsConfig config.CORSConfig, originPatterns []config.OriginPattern) string {
+	origin := r.Header.Get("Origin")
+	if origin != "" {
+		if isOriginAllowed(origin, originPatterns) {
+			return ""
+		}
+		return "origin not allowed"
+	}
+
+	if referer := r.Header.Get("Referer"); corsConfig.RefererFallback && referer != "" {
+		refererURL, err := url.Parse(referer)
+		if err != nil || refererURL.Scheme == "" || refererURL.Host == "" {
+			return "invalid referer"
+		}
+		if isOriginAllowed(refererURL.Scheme+"://"+refererURL.Host, originPatterns) {
+			return ""
+		}
+		return "referer not allowed"
+	}
+
+	if corsConfig.AllowMissingOrigin {
+		return ""
+	}
+	return "missing origin"
+}
+
+// parseHeaderList parses a comma separated list of header names or methods
+// into an uppercased set for case-insensitive lookups.
+func parseHeaderList(value string) map[string]bool {
+	result := make(map[string]bool)
+	for item := range strings.SplitSeq(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result[strings.ToUpper(item)] = true
+		}
+	}
+	return result
+}
+
+// clearCORSHeaders removes any CORS allowance from a rejected response.
+func clearCORSHeaders(header http.Header) {
+	for _, name := range []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Allow-Credentials",
+	} {
+		header.Del(name)
+	}
+}
+
 // isOriginAllowed checks if origin matches any allowed pattern.
-// Supports exact matches, "*" wildcard, and "*.domain.com" subdomain wildcards.
-func isOriginAllowed(origin string, allowedOrigins []string) bool {
+func isOriginAllowed(origin string, allowedOrigins []config.OriginPattern) bool {
 	if origin == "" {
 		return false
 	}
 
 	for _, allowed := range allowedOrigins {
-		// Exact match or global wildcard
-		if allowed == "*" || allowed == origin {
-			slog.Debug("Origin matched", "origin", origin, "pattern", allowed, "match_type", "exact")
+		if allowed.Matches(origin) {
+			slog.Debug("Origin matched", "origin", origin, "pattern", allowed.String())
 			return true
 		}
-
-		// Subdomain wildcard: *.domain.com matches sub.domain.com but not domain.com
-		if strings.HasPrefix(allowed, "*.") {
-			domain := allowed[2:]
-			if strings.HasSuffix(origin, "."+domain) {
-				slog.Debug("Origin matched", "origin", origin, "pattern", allowed, "match_type", "subdomain_wildcard")
-				return true
-			}
-		}
 	}
-	slog.Debug("Origin not matched", "origin", origin, "allowed_patterns", allowedOrigins)
+	slog.Debug("Origin not matched", "origin", origin, "allowed_patterns", fmt.Sprint(allowedOrigins))
 	return false
 }
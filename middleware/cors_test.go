@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/bastienwirtz/corsair/config"
 )
@@ -190,12 +191,325 @@ func TestIsOriginAllowed(t *testing.T) {
 			allowedOrigins: []string{"*.example.com"},
 			expected:       false,
 		},
+		{
+			name:           "scheme-aware subdomain wildcard rejects http",
+			origin:         "http://evil.example.com",
+			allowedOrigins: []string{"https://*.example.com"},
+			expected:       false,
+		},
+		{
+			name:           "scheme-less subdomain wildcard rejects http",
+			origin:         "http://evil.example.com",
+			allowedOrigins: []string{"*.example.com"},
+			expected:       false,
+		},
+		{
+			name:           "subdomain wildcard rejects non default port",
+			origin:         "https://api.example.com:8443",
+			allowedOrigins: []string{"*.example.com"},
+			expected:       false,
+		},
+		{
+			name:           "port wildcard",
+			origin:         "http://localhost:5173",
+			allowedOrigins: []string{"http://localhost:*"},
+			expected:       true,
+		},
+		{
+			name:           "anchored regex",
+			origin:         "https://pr-42.preview.example.com",
+			allowedOrigins: []string{`regex:https://pr-\d+\.preview\.example\.com`},
+			expected:       true,
+		},
+		{
+			name:           "anchored regex rejects suffix",
+			origin:         "https://pr-42.preview.example.com.evil.org",
+			allowedOrigins: []string{`regex:https://pr-\d+\.preview\.example\.com`},
+			expected:       false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := isOriginAllowed(tt.origin, tt.allowedOrigins)
+			patterns, err := config.ParseOriginPatterns(tt.allowedOrigins)
+			require.NoError(t, err)
+
+			result := isOriginAllowed(tt.origin, patterns)
 			assert.Equal(t, tt.expected, result)
 		})
 	}
 }
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name            string
+		corsConfig      config.CORSConfig
+		origin          string
+		requestMethod   string
+		requestHeaders  string
+		expectedStatus  int
+		expectedMethods string
+		expectedHeaders string
+	}{
+		{
+			name: "allowed method and headers",
+			corsConfig: config.CORSConfig{
+				Origins: []string{"https://app.example.com"},
+				Methods: "GET, PUT, DELETE",
+				Headers: "Content-Type, Authorization",
+			},
+			origin:          "https://app.example.com",
+			requestMethod:   "PUT",
+			requestHeaders:  "content-type, authorization",
+			expectedStatus:  http.StatusOK,
+			expectedMethods: "GET, PUT, DELETE",
+			expectedHeaders: "Content-Type, Authorization",
+		},
+		{
+			name: "disallowed origin",
+			corsConfig: config.CORSConfig{
+				Origins: []string{"https://app.example.com"},
+				Methods: "GET, PUT",
+			},
+			origin:         "https://evil.example.org",
+			requestMethod:  "PUT",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "disallowed method",
+			corsConfig: config.CORSConfig{
+				Origins: []string{"*"},
+				Methods: "GET, POST",
+			},
+			origin:         "https://app.example.com",
+			requestMethod:  "DELETE",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "safelisted method always allowed",
+			corsConfig: config.CORSConfig{
+				Origins: []string{"*"},
+				Methods: "PUT",
+			},
+			origin:          "https://app.example.com",
+			requestMethod:   "POST",
+			expectedStatus:  http.StatusOK,
+			expectedMethods: "PUT",
+		},
+		{
+			name: "disallowed header",
+			corsConfig: config.CORSConfig{
+				Origins: []string{"*"},
+				Methods: "GET",
+				Headers: "Content-Type",
+			},
+			origin:         "https://app.example.com",
+			requestMethod:  "GET",
+			requestHeaders: "Content-Type, X-Secret",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "wildcard headers without credentials",
+			corsConfig: config.CORSConfig{
+				Origins: []string{"*"},
+				Methods: "*",
+				Headers: "*",
+			},
+			origin:          "https://app.example.com",
+			requestMethod:   "PATCH",
+			requestHeaders:  "X-Anything",
+			expectedStatus:  http.StatusOK,
+			expectedMethods: "*",
+			expectedHeaders: "*",
+		},
+		{
+			name: "wildcard headers with credentials are reflected",
+			corsConfig: config.CORSConfig{
+				Origins:     []string{"https://app.example.com"},
+				Methods:     "*",
+				Headers:     "*",
+				Credentials: true,
+			},
+			origin:          "https://app.example.com",
+			requestMethod:   "PATCH",
+			requestHeaders:  "X-Anything, Authorization",
+			expectedStatus:  http.StatusOK,
+			expectedMethods: "PATCH",
+			expectedHeaders: "X-Anything, Authorization",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CORS(tt.corsConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("preflight requests should not reach the next handler")
+			}))
+
+			req := httptest.NewRequest("OPTIONS", "/test", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Contains(t, w.Header().Values("Vary"), "Access-Control-Request-Method")
+
+			if tt.expectedStatus != http.StatusOK {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Methods"))
+				return
+			}
+
+			assert.NotEmpty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.expectedMethods, w.Header().Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, tt.expectedHeaders, w.Header().Get("Access-Control-Allow-Headers"))
+		})
+	}
+}
+
+func TestCORSExposeHeadersAndMaxAge(t *testing.T) {
+	handler := CORS(config.CORSConfig{
+		Origins:       []string{"https://app.example.com"},
+		ExposeHeaders: "X-Total-Count, ETag",
+		MaxAge:        "10m",
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "X-Total-Count, ETag", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+
+	req = httptest.NewRequest("OPTIONS", "/test", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+	assert.Empty(t, w.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestCORSVary(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	// Wildcard responses are identical for every origin
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	CORS(config.CORSConfig{Origins: []string{"*"}})(next).ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Values("Vary"))
+
+	// Rejected origins still vary, the response differs from an allowed origin
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Origin", "https://evil.example.org")
+	CORS(config.CORSConfig{Origins: []string{"https://app.example.com"}})(next).ServeHTTP(w, req)
+	assert.Equal(t, []string{"Origin"}, w.Header().Values("Vary"))
+}
+
+func TestCORSEnforce(t *testing.T) {
+	tests := []struct {
+		name           string
+		corsConfig     config.CORSConfig
+		origin         string
+		referer        string
+		expectedStatus int
+	}{
+		{
+			name:           "allowed origin",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true},
+			origin:         "https://app.example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "disallowed origin",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true},
+			origin:         "https://evil.example.org",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "disallowed origin without enforcement",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}},
+			origin:         "https://evil.example.org",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing origin rejected",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "missing origin allowed",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true, AllowMissingOrigin: true},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wildcard still requires an origin",
+			corsConfig:     config.CORSConfig{Origins: []string{"*"}, Enforce: true},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "allowed referer fallback",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true, RefererFallback: true},
+			referer:        "https://app.example.com/dashboard?tab=1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "disallowed referer fallback",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true, RefererFallback: true, AllowMissingOrigin: true},
+			referer:        "https://evil.example.org/page",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "referer ignored without fallback",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true},
+			referer:        "https://app.example.com/dashboard",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "origin takes precedence over referer",
+			corsConfig:     config.CORSConfig{Origins: []string{"https://app.example.com"}, Enforce: true, RefererFallback: true},
+			origin:         "https://evil.example.org",
+			referer:        "https://app.example.com/dashboard",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached := false
+			handler := CORS(tt.corsConfig)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedStatus == http.StatusOK, reached)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
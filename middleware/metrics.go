@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+// Metrics returns a middleware recording request count, latency, in-flight
+// requests and body sizes, labeled with the configured endpoint path.
+func Metrics(endpoint string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			method := metrics.Method(r.Method)
+
+			metrics.RequestsInFlight.WithLabelValues(endpoint).Inc()
+			defer metrics.RequestsInFlight.WithLabelValues(endpoint).Dec()
+
+			var body *countingReader
+			if r.Body != nil && r.Body != http.NoBody {
+				body = &countingReader{ReadCloser: r.Body}
+				r.Body = body
+			}
+			recorder := newResponseRecorder(w)
+
+			next.ServeHTTP(recorder, r)
+
+			metrics.RequestsTotal.WithLabelValues(endpoint, method, strconv.Itoa(recorder.Status())).Inc()
+			metrics.RequestDuration.WithLabelValues(endpoint, method).Observe(time.Since(start).Seconds())
+			metrics.ResponseBytes.WithLabelValues(endpoint).Add(float64(recorder.bytes))
+			if body != nil {
+				metrics.RequestBytes.WithLabelValues(endpoint).Add(float64(body.bytes))
+			}
+		})
+	}
+}
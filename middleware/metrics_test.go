@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	endpoint := "/metrics-test"
+	handler := Metrics(endpoint)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RequestsInFlight.WithLabelValues(endpoint)))
+
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("received " + string(body)))
+	}))
+
+	req := httptest.NewRequest("POST", "/metrics-test/items", strings.NewReader("hello"))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.RequestsTotal.WithLabelValues(endpoint, "POST", "201")))
+	assert.Equal(t, uint64(1), histogramCount(t, metrics.RequestDuration.WithLabelValues(endpoint, "POST")))
+	assert.Equal(t, float64(0), testutil.ToFloat64(metrics.RequestsInFlight.WithLabelValues(endpoint)))
+	assert.Equal(t, float64(5), testutil.ToFloat64(metrics.RequestBytes.WithLabelValues(endpoint)))
+	assert.Equal(t, float64(len("received hello")), testutil.ToFloat64(metrics.ResponseBytes.WithLabelValues(endpoint)))
+}
+
+func TestResponseRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	recorder := newResponseRecorder(w)
+
+	recorder.Write([]byte("chunk"))
+	recorder.Flush()
+
+	assert.True(t, w.Flushed)
+	assert.Equal(t, http.StatusOK, recorder.Status())
+	assert.Equal(t, int64(5), recorder.bytes)
+	assert.NoError(t, http.NewResponseController(recorder).Flush())
+}
+
+// histogramCount returns the number of observations of a histogram series.
+func histogramCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var m dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request, or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestID returns a middleware assigning an ID to each request, read from
+// header when the client sent a valid one, or generated otherwise. The ID is
+// set on the request headers so it is forwarded upstream, echoed on the
+// response, and stored in the request context for logging.
+func RequestID(header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			r.Header.Set(header, id)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			next.ServeHTTP(&requestIDWriter{ResponseWriter: w, header: header, id: id}, r.WithContext(ctx))
+		})
+	}
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII characters, so
+// clients cannot inject arbitrarily long or malformed values into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random UUID (version 4).
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// requestIDWriter sets the request ID header when the response headers are
+// written, replacing any value copied from the upstream response.
+type requestIDWriter struct {
+	http.ResponseWriter
+	header      string
+	id          string
+	wroteHeader bool
+}
+
+func (w *requestIDWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set(w.header, w.id)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *requestIDWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *requestIDWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *requestIDWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		incoming   string
+		expectedID string
+	}{
+		{name: "generated when missing", header: "X-Request-ID"},
+		{name: "incoming ID kept", header: "X-Request-ID", incoming: "abc-123", expectedID: "abc-123"},
+		{name: "custom header", header: "X-Correlation-ID", incoming: "corr-42", expectedID: "corr-42"},
+		{name: "ID with spaces replaced", header: "X-Request-ID", incoming: "abc 123"},
+		{name: "oversized ID replaced", header: "X-Request-ID", incoming: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var contextID, forwardedID string
+			handler := RequestID(tt.header)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = RequestIDFromContext(r.Context())
+				forwardedID = r.Header.Get(tt.header)
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+
+			req := httptest.NewRequest("GET", "/api/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(tt.header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if tt.expectedID != "" {
+				assert.Equal(t, tt.expectedID, contextID)
+			} else {
+				assert.Regexp(t, uuidPattern, contextID)
+			}
+			assert.Equal(t, contextID, forwardedID)
+			assert.Equal(t, contextID, w.Header().Get(tt.header))
+			assert.Equal(t, http.StatusBadGateway, w.Code)
+		})
+	}
+}
+
+func TestRequestIDReplacesUpstreamValue(t *testing.T) {
+	handler := RequestID("X-Request-ID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Headers copied from the upstream response
+		w.Header().Add("X-Request-ID", "upstream-id")
+		w.Write([]byte("ok"))
+	}))
+
+	req := httptest.NewRequest("GET", "/api/", nil)
+	req.Header.Set("X-Request-ID", "client-id")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, []string{"client-id"}, w.Header().Values("X-Request-ID"))
+	assert.Equal(t, "ok", w.Body.String())
+}
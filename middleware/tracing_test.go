@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestTracing(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		handler := Tracing()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.False(t, trace.SpanFromContext(r.Context()).IsRecording())
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/", nil))
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+		provider.Shutdown(context.Background())
+	})
+
+	tests := []struct {
+		name        string
+		traceparent string
+		traceID     string
+		parentID    string
+		recorded    bool
+	}{
+		{name: "new trace", recorded: true},
+		{
+			name:        "continues incoming trace",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+			parentID:    "00f067aa0ba902b7",
+			recorded:    true,
+		},
+		{
+			name:        "follows caller sampling decision",
+			traceparent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			traceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		},
+		{name: "invalid traceparent starts new trace", traceparent: "00-invalid-01", recorded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sc trace.SpanContext
+			handler := Tracing()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sc = trace.SpanContextFromContext(r.Context())
+				w.WriteHeader(http.StatusBadGateway)
+			}))
+
+			req := httptest.NewRequest("GET", "/api/", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			w := httptest.NewRecorder()
+			before := len(recorder.Ended())
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadGateway, w.Code)
+			assert.True(t, sc.IsValid())
+			if tt.traceID != "" {
+				assert.Equal(t, tt.traceID, sc.TraceID().String())
+			}
+			if !tt.recorded {
+				assert.Len(t, recorder.Ended(), before)
+				return
+			}
+
+			spans := recorder.Ended()
+			require.Len(t, spans, before+1)
+			span := spans[before]
+			assert.Equal(t, sc.SpanID(), span.SpanContext().SpanID())
+			assert.Equal(t, trace.SpanKindServer, span.SpanKind())
+			assert.Equal(t, codes.Error, span.Status().Code)
+			if tt.parentID != "" {
+				assert.Equal(t, tt.parentID, span.Parent().SpanID().String())
+			} else {
+				assert.False(t, span.Parent().IsValid())
+			}
+		})
+	}
+}
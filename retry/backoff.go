@@ -0,0 +1,44 @@
+package retry
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Backoff returns how long to wait before retry number attempt, starting at
+// 1. The wait is random up to initial doubled on each retry and capped at
+// max, so clients retrying together spread out ("full jitter").
+func Backoff(attempt int, initial, max time.Duration) time.Duration {
+	ceiling := initial
+	for i := 1; i < attempt && ceiling < max; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, max)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// RetryAfter returns the wait requested by the Retry-After header of a
+// response, given in seconds or as an HTTP date.
+func RetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	return max(date.Sub(now), 0), true
+}
@@ -0,0 +1,62 @@
+package retry
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		ceiling time.Duration
+	}{
+		{attempt: 1, ceiling: 100 * time.Millisecond},
+		{attempt: 2, ceiling: 200 * time.Millisecond},
+		{attempt: 3, ceiling: 400 * time.Millisecond},
+		{attempt: 10, ceiling: time.Second},
+	}
+
+	for _, tt := range tests {
+		var longest time.Duration
+		for range 1000 {
+			backoff := Backoff(tt.attempt, 100*time.Millisecond, time.Second)
+			assert.GreaterOrEqual(t, backoff, time.Duration(0))
+			assert.LessOrEqual(t, backoff, tt.ceiling)
+			longest = max(longest, backoff)
+		}
+		assert.Greater(t, longest, tt.ceiling/2, "attempt %d: waits are spread up to the ceiling", tt.attempt)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{name: "missing", value: ""},
+		{name: "seconds", value: "3", want: 3 * time.Second, wantOK: true},
+		{name: "date", value: now.Add(5 * time.Second).Format(http.TimeFormat), want: 5 * time.Second, wantOK: true},
+		{name: "past date", value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, wantOK: true},
+		{name: "negative", value: "-1"},
+		{name: "invalid", value: "soon"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.value != "" {
+				header.Set("Retry-After", tt.value)
+			}
+			wait, ok := RetryAfter(header, now)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, wait)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package retry provides the backoff and budget of upstream request retries.
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// budgetSlots is the number of slots the budget window is divided into.
+// Counts expire one slot at a time.
+const budgetSlots = 10
+
+// Budget limits retries to a ratio of the requests seen over a sliding
+// window, plus a minimum rate so low traffic can still be retried. A nil
+// budget allows every retry.
+type Budget struct {
+	mu           sync.Mutex
+	ratio        float64
+	minRetries   float64 // allowed over the window regardless of traffic
+	slotDuration time.Duration
+	slots        [budgetSlots]budgetSlot
+	now          func() time.Time
+}
+
+type budgetSlot struct {
+	index    int64 // slot number since the epoch
+	requests int
+	retries  int
+}
+
+func NewBudget(cfg config.RetryBudgetConfig) *Budget {
+	window := cfg.GetWindow()
+	return &Budget{
+		ratio:        cfg.GetRatio(),
+		minRetries:   float64(cfg.GetMinRetriesPerSecond()) * window.Seconds(),
+		slotDuration: window / budgetSlots,
+		now:          time.Now,
+	}
+}
+
+// Request records a request, which gives credit for retries.
+func (b *Budget) Request() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.current().requests++
+}
+
+// TryRetry reports whether a retry is within budget, and records it if so.
+func (b *Budget) TryRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := b.current()
+	requests, retries := 0, 0
+	for _, slot := range b.slots {
+		if slot.index > current.index-budgetSlots {
+			requests += slot.requests
+			retries += slot.retries
+		}
+	}
+	if float64(retries+1) > b.ratio*float64(requests)+b.minRetries {
+		return false
+	}
+	current.retries++
+	return true
+}
+
+// current returns the slot of the current time, resetting it when it last
+// held counts of a previous window.
+func (b *Budget) current() *budgetSlot {
+	index := b.now().UnixNano() / int64(b.slotDuration)
+	slot := &b.slots[index%budgetSlots]
+	if slot.index != index {
+		*slot = budgetSlot{index: index}
+	}
+	return slot
+}
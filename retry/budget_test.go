@@ -0,0 +1,68 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func newTestBudget(ratio float64, minPerSecond int) (*Budget, *time.Time) {
+	now := time.Unix(1000, 0)
+	budget := NewBudget(config.RetryBudgetConfig{Ratio: &ratio, MinRetriesPerSecond: &minPerSecond, Window: "10s"})
+	budget.now = func() time.Time { return now }
+	return budget, &now
+}
+
+func TestBudgetRatio(t *testing.T) {
+	budget, _ := newTestBudget(0.2, 0)
+
+	assert.False(t, budget.TryRetry(), "no request, no retry")
+	for range 10 {
+		budget.Request()
+	}
+	assert.True(t, budget.TryRetry())
+	assert.True(t, budget.TryRetry())
+	assert.False(t, budget.TryRetry(), "2 retries for 10 requests")
+}
+
+func TestBudgetMinRetries(t *testing.T) {
+	budget, _ := newTestBudget(0, 1)
+
+	allowed := 0
+	for budget.TryRetry() {
+		allowed++
+	}
+	assert.Equal(t, 10, allowed, "1 retry per second over a 10s window")
+}
+
+func TestBudgetWindow(t *testing.T) {
+	budget, now := newTestBudget(1, 0)
+
+	for range 5 {
+		budget.Request()
+	}
+	for range 5 {
+		assert.True(t, budget.TryRetry())
+	}
+	assert.False(t, budget.TryRetry())
+
+	// Counts expire slot by slot as the window slides
+	*now = now.Add(5 * time.Second)
+	budget.Request()
+	assert.True(t, budget.TryRetry())
+	assert.False(t, budget.TryRetry(), "earlier retries still count")
+
+	*now = now.Add(6 * time.Second)
+	assert.False(t, budget.TryRetry(), "earlier requests expired too")
+	budget.Request()
+	assert.True(t, budget.TryRetry())
+}
+
+func TestNilBudget(t *testing.T) {
+	var budget *Budget
+	budget.Request()
+	assert.True(t, budget.TryRetry())
+}
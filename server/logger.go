@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"os"
@@ -8,11 +9,15 @@ import (
 	"time"
 
 	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/middleware"
 	"github.com/lmittmann/tint"
 	"github.com/mattn/go-isatty"
 )
 
-func SetupLogger(cfg config.LoggingConfig, version string) error {
+// SetupLogger installs the default logger. Values of secrets, such as resolved
+// templates, are masked in all log records along with sensitive query
+// parameters and headers.
+func SetupLogger(cfg config.LoggingConfig, version string, secrets []string) error {
 	var level slog.Level
 	switch strings.ToLower(cfg.Level) {
 	case "debug":
@@ -45,8 +50,30 @@ func SetupLogger(cfg config.LoggingConfig, version string) error {
 		return fmt.Errorf("invalid log format: %s", cfg.Format)
 	}
 
-	logger := slog.New(handler).With("version", version)
+	handler = &redactHandler{handler, newRedactor(cfg.Redact, secrets)}
+	logger := slog.New(&contextHandler{handler}).With("version", version)
 	slog.SetDefault(logger)
 
 	return nil
 }
+
+// contextHandler adds request scoped attributes, such as the request ID,
+// to records logged with a request context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := middleware.RequestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
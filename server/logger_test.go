@@ -0,0 +1,33 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bastienwirtz/corsair/middleware"
+)
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(&contextHandler{slog.NewJSONHandler(&buf, nil)}).With("version", "test")
+
+	handler := middleware.RequestID("X-Request-ID")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.InfoContext(r.Context(), "Handling request")
+	}))
+	req := httptest.NewRequest("GET", "/api/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Contains(t, buf.String(), `"version":"test"`)
+	assert.Contains(t, buf.String(), `"request_id":"abc-123"`)
+
+	buf.Reset()
+	logger.InfoContext(context.Background(), "Outside of a request")
+	assert.NotContains(t, buf.String(), "request_id")
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+const redacted = "[REDACTED]"
+
+// Values of these query parameters and headers are always masked in logs.
+var (
+	defaultSensitiveQueryParams = []string{
+		"access_token", "api_key", "apikey", "client_secret", "key", "password", "secret", "signature", "token",
+	}
+	defaultSensitiveHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key", "X-Auth-Token",
+	}
+)
+
+// Secrets shorter than this are not masked, they would match too many
+// unrelated strings to keep logs readable.
+const minSecretLength = 4
+
+// redactor masks secrets in log messages and attributes: template values,
+// sensitive query parameters and headers, and URL passwords.
+type redactor struct {
+	secrets     *strings.Replacer
+	queryParams *regexp.Regexp
+	headers     map[string]bool
+}
+
+var userinfoRegex = regexp.MustCompile(`(://[^:/@\s]*:)[^@/\s]+@`)
+
+func newRedactor(cfg config.RedactConfig, secrets []string) *redactor {
+	// Template values are also masked in their URL encoded forms
+	var values []string
+	for _, secret := range secrets {
+		if len(secret) < minSecretLength {
+			continue
+		}
+		values = append(values, secret, url.QueryEscape(secret), url.PathEscape(secret))
+	}
+	// Longest first so a secret containing another one is fully masked
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	var pairs []string
+	for _, value := range values {
+		pairs = append(pairs, value, redacted)
+	}
+
+	var names []string
+	for _, name := range append(defaultSensitiveQueryParams, cfg.QueryParams...) {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+
+	headers := make(map[string]bool)
+	for _, name := range append(defaultSensitiveHeaders, cfg.Headers...) {
+		headers[strings.ToLower(name)] = true
+	}
+
+	return &redactor{
+		secrets:     strings.NewReplacer(pairs...),
+		queryParams: regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(names, "|") + `)=)[^&#\s"']*`),
+		headers:     headers,
+	}
+}
+
+// redactString masks secrets found in s, which may contain URLs.
+func (r *redactor) redactString(s string) string {
+	s = r.secrets.Replace(s)
+	if strings.Contains(s, "=") {
+		s = r.queryParams.ReplaceAllString(s, "${1}"+redacted)
+	}
+	if strings.Contains(s, "@") {
+		s = userinfoRegex.ReplaceAllString(s, "${1}"+redacted+"@")
+	}
+	return s
+}
+
+// redactHeader returns a copy of header with secrets masked.
+func (r *redactor) redactHeader(header http.Header) http.Header {
+	clone := make(http.Header, len(header))
+	for key, values := range header {
+		masked := make([]string, len(values))
+		for i, value := range values {
+			if r.headers[strings.ToLower(key)] {
+				masked[i] = redacted
+			} else {
+				masked[i] = r.redactString(value)
+			}
+		}
+		clone[key] = masked
+	}
+	return clone
+}
+
+func (r *redactor) redactAttr(attr slog.Attr) slog.Attr {
+	attr.Value = attr.Value.Resolve()
+	if r.headers[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, redacted)
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		attr.Value = slog.StringValue(r.redactString(attr.Value.String()))
+	case slog.KindGroup:
+		group := attr.Value.Group()
+		masked := make([]slog.Attr, len(group))
+		for i, a := range group {
+			masked[i] = r.redactAttr(a)
+		}
+		attr.Value = slog.GroupValue(masked...)
+	case slog.KindAny:
+		switch v := attr.Value.Any().(type) {
+		case http.Header:
+			attr.Value = slog.AnyValue(r.redactHeader(v))
+		case error:
+			attr.Value = slog.StringValue(r.redactString(v.Error()))
+		case fmt.Stringer:
+			attr.Value = slog.StringValue(r.redactString(v.String()))
+		case []string:
+			masked := make([]string, len(v))
+			for i, s := range v {
+				masked[i] = r.redactString(s)
+			}
+			attr.Value = slog.AnyValue(masked)
+		}
+	}
+	return attr
+}
+
+// redactHandler masks secrets in records before passing them to the wrapped handler.
+type redactHandler struct {
+	slog.Handler
+	redactor *redactor
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	masked := slog.NewRecord(record.Time, record.Level, h.redactor.redactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		masked.AddAttrs(h.redactor.redactAttr(attr))
+		return true
+	})
+	return h.Handler.Handle(ctx, masked)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	masked := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		masked[i] = h.redactor.redactAttr(attr)
+	}
+	return &redactHandler{h.Handler.WithAttrs(masked), h.redactor}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{h.Handler.WithGroup(name), h.redactor}
+}
@@ -1,44 +1,226 @@
 package server
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/bastienwirtz/corsair/cache"
 	"github.com/bastienwirtz/corsair/config"
 	"github.com/bastienwirtz/corsair/handlers"
+	"github.com/bastienwirtz/corsair/health"
+	"github.com/bastienwirtz/corsair/metrics"
 	"github.com/bastienwirtz/corsair/middleware"
+	"github.com/bastienwirtz/corsair/retry"
 )
 
+// Version is the build version reported by the version endpoint.
+var Version = "dev"
+
 // Handler implements the http.Handler interface with dynamic routing
 // based on configuration. Provides CORS middleware and trailing slash normalization.
+// The routing table can be replaced at runtime with Reload; requests already
+// being served keep using the routing table they started with.
 type Handler struct {
-	mux    *http.ServeMux
-	config config.Config
+	mu        sync.Mutex // serializes reloads
+	mux       atomic.Pointer[http.ServeMux]
+	requests  atomic.Pointer[requestSettings]
+	config    config.Config
+	checker   *health.Checker     // health checks of the current routes
+	resources *handlers.Resources // released when the current routes are replaced
+	cache     cache.Store         // response cache, kept across reloads
+	draining  atomic.Bool
+	active    atomic.Int64
 }
 
 // NewDynamicRoutingHandler creates a new handler with routes registered from configuration.
 func NewDynamicRoutingHandler(cfg config.Config) *Handler {
 	handler := &Handler{
-		mux:    http.NewServeMux(),
-		config: cfg,
+		config:    cfg,
+		checker:   health.NewChecker(),
+		resources: &handlers.Resources{},
+		cache:     openCache(cfg.Cache),
 	}
-	handler.registerRoutes()
+	handler.mux.Store(handler.registerRoutes(handler.checker, handler.resources))
+	handler.requests.Store(newRequestSettings(cfg))
+	handler.checker.Start()
 	return handler
 }
 
-// registerRoutes sets up all HTTP routes based on configuration.
+// requestSettings holds the configuration of middlewares applied to every
+// request, outside of the routing table.
+type requestSettings struct {
+	requestIDHeader string
+	accessLog       *middleware.AccessLogger
+}
+
+func newRequestSettings(cfg config.Config) *requestSettings {
+	return &requestSettings{
+		requestIDHeader: cfg.GetRequestIDHeader(),
+		accessLog:       middleware.NewAccessLogger(cfg.Logging.AccessLog),
+	}
+}
+
+// Reload rebuilds the routing table from cfg and atomically swaps it in.
+// The configuration must already be validated (see config.LoadConfig). If the
+// routes cannot be built, the error is returned and the current routing table
+// stays live.
+func (h *Handler) Reload(cfg config.Config) (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previous, previousCache := h.config, h.cache
+	h.config = cfg
+	if cfg.Cache != previous.Cache {
+		h.cache = openCache(cfg.Cache)
+	}
+	checker, resources := health.NewChecker(), &handlers.Resources{}
+	defer func() {
+		// http.ServeMux panics on conflicting patterns, never let a bad
+		// configuration take the running server down.
+		if r := recover(); r != nil {
+			resources.Release()
+			if h.cache != previousCache {
+				if err := h.cache.Close(); err != nil {
+					slog.Warn("Failed to close cache", "error", err)
+				}
+			}
+			h.config, h.cache = previous, previousCache
+			err = fmt.Errorf("failed to register routes: %v", r)
+		}
+	}()
+
+	mux := h.registerRoutes(checker, resources)
+	h.mux.Store(mux)
+	h.requests.Store(newRequestSettings(cfg))
+
+	// Requests still using the previous store once it is closed are served
+	// without caching.
+	if h.cache != previousCache {
+		if err := previousCache.Close(); err != nil {
+			slog.Warn("Failed to close cache", "error", err)
+		}
+	}
+
+	// Upstreams of the new routes are checked from scratch
+	h.checker.Stop()
+	h.checker = checker
+	h.checker.Start()
+
+	// Idle connections and breaker states of the previous routes are dropped
+	h.resources.Release()
+	h.resources = resources
+
+	if previous.Server.Address != cfg.Server.Address || previous.Server.Port != cfg.Server.Port {
+		slog.Warn("Listen address changes require a restart to take effect",
+			"address", previous.Server.Address,
+			"port", previous.Server.Port)
+	}
+	slog.Info("Configuration reloaded", "endpoints", len(cfg.Endpoints))
+	return nil
+}
+
+// Config returns the configuration currently in use.
+func (h *Handler) Config() config.Config {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.config
+}
+
+// BeginShutdown marks the handler as draining: it reports itself as not ready
+// and asks clients to close their keep-alive connections, so load balancers
+// stop routing new traffic while in-flight requests complete.
+func (h *Handler) BeginShutdown() {
+	if h.draining.CompareAndSwap(false, true) {
+		slog.Info("Draining connections", "active_requests", h.ActiveRequests())
+	}
+}
+
+// Close stops background health checks, releases the resources of the routes
+// and closes the response cache.
+func (h *Handler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checker.Stop()
+	h.resources.Release()
+	if err := h.cache.Close(); err != nil {
+		slog.Warn("Failed to close cache", "error", err)
+	}
+}
+
+// openCache opens the response cache configured by cfg. When the store cannot
+// be opened, responses are cached in memory.
+func openCache(cfg config.CacheConfig) cache.Store {
+	store, err := cache.New(cfg)
+	if err != nil {
+		slog.Error("Failed to open cache, using memory store", "store", cfg.GetStore(), "path", cfg.Path, "error", err)
+		return cache.NewMemory(cfg)
+	}
+	return store
+}
+
+// Ready reports whether the handler accepts new traffic.
+func (h *Handler) Ready() bool {
+	return !h.draining.Load()
+}
+
+// ActiveRequests returns the number of requests currently being served.
+func (h *Handler) ActiveRequests() int64 {
+	return h.active.Load()
+}
+
+// registerRoutes builds a new router with all HTTP routes based on configuration.
 // Handles both the optional forward endpoint and configured proxy endpoints.
-func (h *Handler) registerRoutes() {
-	h.mux = http.NewServeMux()
+// Health checked upstreams are registered with checker, which is not started,
+// and the resources of the handlers with resources.
+func (h *Handler) registerRoutes(checker *health.Checker, resources *handlers.Resources) *http.ServeMux {
+	mux := http.NewServeMux()
 
 	corsMiddleware := middleware.CORS(h.config.CORS)
 	slog.Debug("Initialized CORS middleware", "origins", h.config.CORS.Origins, "credentials", h.config.CORS.Credentials)
 
+	// Paths of internal endpoints, configured endpoints cannot use them
+	reserved := map[string]bool{
+		strings.TrimSuffix(handlers.ForwardPath, "/"): true,
+	}
+
+	// Register metrics endpoint on the main listener if enabled
+	if h.config.Metrics.Enabled && !h.config.Metrics.SeparateListener() {
+		metricsPath := h.config.Metrics.GetPath()
+		reserved[strings.TrimSuffix(metricsPath, "/")] = true
+		mux.Handle(routePattern(metricsPath)+"{$}", metrics.Handler())
+		slog.Info("Metrics endpoint enabled", "path", metricsPath)
+	}
+
+	// Reserve health, readiness and version endpoints, registered once the
+	// endpoints their readiness checks depend on are known
+	probes := h.config.Server.Probes
+	if probes.IsEnabled() {
+		for _, path := range []string{probes.GetLivenessPath(), probes.GetReadinessPath(), probes.GetVersionPath()} {
+			reserved[strings.TrimSuffix(path, "/")] = true
+		}
+	}
+	readinessChecks := make(map[string]handlers.ReadinessCheck)
+
+	// Retries of all endpoints share the same budget
+	retryBudget := retry.NewBudget(h.config.RetryBudget)
+
 	// Register forward endpoint if enabled
 	if h.config.Server.ForwardEndpointEnabled != nil && *h.config.Server.ForwardEndpointEnabled {
-		h.mux.Handle("/forward/", corsMiddleware(handlers.ForwardHandler(h.config)))
-		slog.Info("Forward endpoint enabled", "path", "/forward/")
+		forwardCORS := corsMiddleware
+		if h.config.Server.Forward.CORS != nil {
+			forwardCORS = middleware.CORS(h.config.GetForwardCORS())
+			slog.Debug("Using CORS override for forward endpoint", "origins", h.config.GetForwardCORS().Origins)
+		}
+		mux.Handle(handlers.ForwardPath, h.withMetrics(handlers.ForwardPath, forwardCORS(handlers.ForwardHandler(h.config, handlers.WithResources(resources)))))
+		slog.Info("Forward endpoint enabled", "path", handlers.ForwardPath)
 	} else {
 		slog.Info("Forward endpoint disabled")
 	}
@@ -50,7 +232,7 @@ func (h *Handler) registerRoutes() {
 		path := endpoint.Path
 
 		// Prevent registration of reserved internal endpoints
-		if strings.TrimSuffix(path, "/") == "/forward" {
+		if reserved[strings.TrimSuffix(path, "/")] {
 			slog.Warn("Skipping reserved endpoint", "path", path, "remote_url", endpoint.RemoteURL)
 			skippedCount++
 			continue
@@ -63,35 +245,116 @@ func (h *Handler) registerRoutes() {
 		// This allows our proxy to handle sub-paths correctly.
 		// The trailing slash middleware normalizes incoming requests to
 		// match routes with a ending "/".
-		if !strings.HasSuffix(path, "/") {
-			path += "/"
-		}
+		path = routePattern(path)
 
 		// Create proxy handler that will forward requests to the remote URL.
 		// The ProxyHandler handles path manipulation internally by stripping
 		// the endpoint path and appending the remaining path to the remote URL.
-		handler := handlers.ProxyHandler(endpoint, h.config)
-		handler = corsMiddleware(handler)
+		handler := handlers.ProxyHandler(endpoint, h.config, handlers.WithHealthChecker(checker), handlers.WithRetryBudget(retryBudget), handlers.WithCache(h.cache), handlers.WithResources(resources))
+		if endpoint.CORS != nil {
+			endpointCORS := h.config.GetEffectiveCORS(endpoint)
+			handler = middleware.CORS(endpointCORS)(handler)
+			slog.Debug("Using CORS override for endpoint", "path", path, "origins", endpointCORS.Origins, "credentials", endpointCORS.Credentials)
+		} else {
+			handler = corsMiddleware(handler)
+		}
+
+		handler = h.withMetrics(endpoint.Path, handler)
 
 		// Register the handler. No StripPrefix needed here since ProxyHandler
 		// handles path processing internally.
-		h.mux.Handle(path, handler)
-		slog.Debug("Registered endpoint", "path", path, "remote_url", endpoint.RemoteURL)
+		mux.Handle(path, handler)
+		slog.Debug("Registered endpoint", "path", path, "remote_url", endpoint.RemoteURL, "upstreams", len(endpoint.GetUpstreams()))
 		registeredCount++
+
+		if probes.CheckUpstreams {
+			if endpoint.HealthCheck != nil {
+				// Use the known state instead of connecting on every probe
+				endpointPath := endpoint.Path
+				readinessChecks[endpointPath] = func(context.Context) error { return checker.Check(endpointPath) }
+			} else {
+				readinessChecks[endpoint.Path] = handlers.UpstreamCheck(endpoint, probes.GetUpstreamTimeout())
+			}
+		}
+	}
+
+	if probes.IsEnabled() {
+		mux.Handle(routePattern(probes.GetLivenessPath())+"{$}", handlers.LivenessHandler())
+		mux.Handle(routePattern(probes.GetReadinessPath())+"{$}", handlers.ReadinessHandler(h.Ready, readinessChecks))
+		mux.Handle(routePattern(probes.GetVersionPath())+"{$}", handlers.VersionHandler(Version))
+		slog.Info("Probe endpoints enabled",
+			"liveness_path", probes.GetLivenessPath(),
+			"readiness_path", probes.GetReadinessPath(),
+			"version_path", probes.GetVersionPath(),
+			"check_upstreams", probes.CheckUpstreams)
 	}
 
 	slog.Info("Route registration complete",
 		"registered", registeredCount,
 		"skipped", skippedCount,
 		"total_configured", len(h.config.Endpoints))
+
+	return mux
+}
+
+// withMetrics wraps handler with the metrics middleware when metrics are enabled.
+func (h *Handler) withMetrics(endpoint string, handler http.Handler) http.Handler {
+	if !h.config.Metrics.Enabled {
+		return handler
+	}
+	return middleware.Metrics(endpoint)(handler)
+}
+
+// routePattern ensures path ends with "/" so it matches all sub-paths.
+func routePattern(path string) string {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return path
+}
+
+// NewMetricsServer returns the HTTP server of the dedicated metrics listener,
+// or nil when metrics are disabled or served on the main listener.
+func NewMetricsServer(cfg config.Config) *http.Server {
+	if !cfg.Metrics.Enabled || !cfg.Metrics.SeparateListener() {
+		return nil
+	}
+
+	address := cfg.Metrics.Address
+	if address == "" {
+		address = cfg.Server.Address
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(cfg.Metrics.GetPath(), metrics.Handler())
+
+	return &http.Server{
+		Addr:         net.JoinHostPort(address, strconv.Itoa(cfg.Metrics.Port)),
+		Handler:      mux,
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
 }
 
 // ServeHTTP implements the http.Handler interface
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.active.Add(1)
+	defer h.active.Add(-1)
+
+	if h.draining.Load() {
+		// Have clients reconnect elsewhere instead of reusing this connection
+		w.Header().Set("Connection", "close")
+	}
+
 	// Apply trailing slash middleware to the entire mux to normalize requests
 	// before they reach the router, preventing unwanted redirects.
 	trailingSlashMiddleware := middleware.TrailingSlash()
-	handler := trailingSlashMiddleware(h.mux)
+	handler := middleware.Tracing()(trailingSlashMiddleware(h.mux.Load()))
+
+	// The request ID wraps the access log so its records carry the ID
+	settings := h.requests.Load()
+	handler = settings.accessLog.Middleware(handler)
+	handler = middleware.RequestID(settings.requestIDHeader)(handler)
 
 	handler.ServeHTTP(w, r)
 }
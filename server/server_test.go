@@ -1,13 +1,28 @@
 package server
 
 import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
 
 	"github.com/bastienwirtz/corsair/config"
+	"github.com/bastienwirtz/corsair/metrics"
 )
 
 func TestTrailingSlashHandling(t *testing.T) {
@@ -161,3 +176,606 @@ func TestForwardEndpointValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestReload(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	defer mockBackend.Close()
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/old", RemoteURL: mockBackend.URL}},
+	})
+
+	serve := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve("/old"))
+	assert.Equal(t, http.StatusNotFound, serve("/new"))
+
+	err := handler.Reload(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/new", RemoteURL: mockBackend.URL}},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusNotFound, serve("/old"))
+	assert.Equal(t, http.StatusOK, serve("/new"))
+}
+
+func TestReloadKeepsTemplateValues(t *testing.T) {
+	t.Setenv("CORSAIR_TEST_TOKEN", "token-value")
+
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token-value", r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	cfg := config.Config{
+		Endpoints: []config.Endpoint{{
+			Path:      "/api",
+			RemoteURL: mockBackend.URL,
+			Headers:   []map[string]string{{"Authorization": "Bearer {{ CORSAIR_TEST_TOKEN }}"}},
+		}},
+	}
+	handler := NewDynamicRoutingHandler(cfg)
+	require.NoError(t, handler.Reload(cfg))
+
+	// The logger is set up with the values of the reloaded configuration
+	assert.Equal(t, []string{"token-value"}, cfg.TemplateValues())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReloadClosesIdleConnections(t *testing.T) {
+	var closed atomic.Int32
+	mockBackend := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	mockBackend.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed.Add(1)
+		}
+	}
+	mockBackend.Start()
+	defer mockBackend.Close()
+
+	cfg := config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	}
+	handler := NewDynamicRoutingHandler(cfg)
+	defer handler.Close()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The transports of the replaced routes drop their idle connections
+	require.NoError(t, handler.Reload(cfg))
+	assert.Eventually(t, func() bool { return closed.Load() == 1 }, time.Second, 5*time.Millisecond)
+}
+
+func TestReloadCircuitBreakerMetrics(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	count := func() int { return testutil.CollectAndCount(metrics.CircuitBreakerState) }
+	series := count()
+
+	cfg := config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL, CircuitBreaker: &config.CircuitBreakerConfig{}}},
+	}
+	handler := NewDynamicRoutingHandler(cfg)
+	defer handler.Close()
+	assert.Equal(t, series+1, count())
+
+	// The state of the same upstream stays exported across reloads
+	require.NoError(t, handler.Reload(cfg))
+	assert.Equal(t, series+1, count())
+
+	// Breakers of removed upstreams no longer export their state
+	require.NoError(t, handler.Reload(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	}))
+	assert.Equal(t, series, count())
+}
+
+func TestReloadKeepsPreviousRoutesOnError(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	})
+
+	// Conflicting patterns make http.ServeMux panic during registration
+	err := handler.Reload(config.Config{
+		Endpoints: []config.Endpoint{
+			{Path: "/other", RemoteURL: mockBackend.URL},
+			{Path: "/other/", RemoteURL: mockBackend.URL},
+		},
+	})
+	assert.Error(t, err)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReloadCache(t *testing.T) {
+	var calls atomic.Int32
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("ok"))
+	}))
+	defer mockBackend.Close()
+
+	cfg := config.Config{
+		Cache:     config.CacheConfig{Store: config.CACHE_STORE_DISK, Path: t.TempDir()},
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL, Cache: &config.EndpointCacheConfig{}}},
+	}
+	handler := NewDynamicRoutingHandler(cfg)
+	defer handler.Close()
+
+	serve := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+		return w.Header().Get("X-Cache")
+	}
+
+	assert.Equal(t, "MISS", serve())
+	assert.Equal(t, "HIT", serve())
+
+	// The store is kept while the cache configuration is unchanged
+	cfg.Endpoints[0].Timeout = "5s"
+	require.NoError(t, handler.Reload(cfg))
+	assert.Equal(t, "HIT", serve())
+
+	// Entries stored on disk survive reopening the store
+	cfg.Cache.MaxSize = "128MB"
+	require.NoError(t, handler.Reload(cfg))
+	assert.Equal(t, "HIT", serve())
+
+	cfg.Cache = config.CacheConfig{}
+	require.NoError(t, handler.Reload(cfg))
+	assert.Equal(t, "MISS", serve())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestReloadCacheOnError(t *testing.T) {
+	var calls atomic.Int32
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("ok"))
+	}))
+	defer mockBackend.Close()
+
+	cfg := config.Config{
+		Cache:     config.CacheConfig{Store: config.CACHE_STORE_DISK, Path: t.TempDir()},
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL, Cache: &config.EndpointCacheConfig{}}},
+	}
+	handler := NewDynamicRoutingHandler(cfg)
+	defer handler.Close()
+
+	serve := func() string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+		return w.Header().Get("X-Cache")
+	}
+
+	assert.Equal(t, "MISS", serve())
+
+	// The store of a configuration that cannot be applied is discarded,
+	// the current routes keep using the current store
+	bad := cfg
+	bad.Cache.MaxSize = "128MB"
+	bad.Endpoints = append([]config.Endpoint{{Path: "/bad/{x", RemoteURL: mockBackend.URL}}, cfg.Endpoints...)
+	assert.Error(t, handler.Reload(bad))
+	assert.Equal(t, "HIT", serve())
+
+	cfg.Endpoints[0].Timeout = "5s"
+	require.NoError(t, handler.Reload(cfg))
+	assert.Equal(t, "HIT", serve())
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestBeginShutdown(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	})
+	assert.True(t, handler.Ready())
+
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api", nil))
+		done <- w.Code
+	}()
+
+	<-started
+	assert.Equal(t, int64(1), handler.ActiveRequests())
+
+	handler.BeginShutdown()
+	assert.False(t, handler.Ready())
+
+	// In-flight requests complete normally while draining
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, int64(0), handler.ActiveRequests())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	assert.Equal(t, "close", w.Header().Get("Connection"))
+}
+
+func TestEndpointCORSOverride(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	disabled := false
+	handler := NewDynamicRoutingHandler(config.Config{
+		CORS: config.CORSConfig{
+			Origins:     []string{"https://app.example.com"},
+			Credentials: true,
+		},
+		Endpoints: []config.Endpoint{
+			{
+				Path:      "/public",
+				RemoteURL: mockBackend.URL,
+				CORS: &config.CORSOverride{
+					Origins:     []string{"*"},
+					Credentials: &disabled,
+				},
+			},
+			{Path: "/private", RemoteURL: mockBackend.URL},
+		},
+	})
+
+	serve := func(path string, origin string) http.Header {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	public := serve("/public", "https://random.example.org")
+	assert.Equal(t, "*", public.Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, public.Get("Access-Control-Allow-Credentials"))
+
+	private := serve("/private", "https://random.example.org")
+	assert.Empty(t, private.Get("Access-Control-Allow-Origin"))
+
+	private = serve("/private", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", private.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", private.Get("Access-Control-Allow-Credentials"))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Metrics: config.MetricsConfig{Enabled: true},
+		Endpoints: []config.Endpoint{
+			{Path: "/metrics", RemoteURL: mockBackend.URL},
+			{Path: "/instrumented", RemoteURL: mockBackend.URL},
+		},
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/instrumented/items", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The configured "/metrics" endpoint is skipped as the path is reserved
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `corsair_requests_total{code="200",endpoint="/instrumented",method="GET"} 1`)
+	assert.Contains(t, w.Body.String(), `corsair_upstream_responses_total{code="200",endpoint="/instrumented"} 1`)
+}
+
+func TestNewMetricsServer(t *testing.T) {
+	assert.Nil(t, NewMetricsServer(config.Config{}))
+	assert.Nil(t, NewMetricsServer(config.Config{Metrics: config.MetricsConfig{Enabled: true}}))
+
+	srv := NewMetricsServer(config.Config{
+		Server:  config.ServerConfig{Address: "localhost"},
+		Metrics: config.MetricsConfig{Enabled: true, Port: 9090},
+	})
+	assert.NotNil(t, srv)
+	assert.Equal(t, "localhost:9090", srv.Addr)
+}
+
+func TestTracingPropagation(t *testing.T) {
+	var upstreamTraceparent string
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamTraceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	// Spans are exported as OTLP/HTTP protobuf payloads
+	var exported []*tracepb.Span
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var payload coltracepb.ExportTraceServiceRequest
+		require.NoError(t, proto.Unmarshal(body, &payload))
+		for _, resourceSpans := range payload.ResourceSpans {
+			assert.Equal(t, "corsair", stringAttribute(resourceSpans.Resource.Attributes, "service.name"))
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				exported = append(exported, scopeSpans.Spans...)
+			}
+		}
+	}))
+	defer collector.Close()
+
+	shutdown := SetupTracing(config.TracingConfig{Enabled: true, Endpoint: collector.URL + "/v1/traces"}, "test")
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	})
+
+	incoming := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req.Header.Set("traceparent", incoming)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The trace continues upstream with the proxy client span as parent
+	parts := strings.Split(upstreamTraceparent, "-")
+	require.Len(t, parts, 4)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", parts[1])
+	assert.NotEqual(t, "00f067aa0ba902b7", parts[2])
+	assert.Equal(t, "01", parts[3])
+
+	shutdown()
+	require.Len(t, exported, 2)
+	client, server := exported[0], exported[1]
+	assert.Equal(t, parts[2], hex.EncodeToString(client.SpanId))
+	assert.Equal(t, tracepb.Span_SPAN_KIND_CLIENT, client.Kind)
+	assert.Equal(t, server.SpanId, client.ParentSpanId)
+	assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(server.ParentSpanId))
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, server.Kind)
+	assert.Equal(t, "/api", stringAttribute(server.Attributes, "corsair.endpoint"))
+
+	// Tracing is disabled after shutdown, the trace context of clients is
+	// forwarded as is
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(t, incoming, upstreamTraceparent)
+}
+
+func stringAttribute(attributes []*commonpb.KeyValue, key string) string {
+	for _, attribute := range attributes {
+		if attribute.Key == key {
+			return attribute.Value.GetStringValue()
+		}
+	}
+	return ""
+}
+
+func TestAccessLog(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer mockBackend.Close()
+
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	cfg := config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	}
+	handler := NewDynamicRoutingHandler(cfg)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items", nil))
+	assert.NotContains(t, logs.String(), "Request completed")
+
+	// Applied on reload
+	cfg.Logging.AccessLog.Enabled = true
+	require.NoError(t, handler.Reload(cfg))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/items", nil))
+
+	assert.Contains(t, logs.String(), `"msg":"Request completed"`)
+	assert.Contains(t, logs.String(), `"endpoint":"/api"`)
+	assert.Contains(t, logs.String(), `"upstream_url":"`+mockBackend.URL+`/items/"`)
+	assert.Contains(t, logs.String(), `"status":202`)
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var upstreamID string
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamID = r.Header.Get("X-Correlation-ID")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Server: config.ServerConfig{RequestIDHeader: "X-Correlation-ID"},
+		Endpoints: []config.Endpoint{
+			{Path: "/api", RemoteURL: mockBackend.URL},
+			{Path: "/down", RemoteURL: "http://localhost:1"},
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/api/items", nil)
+	req.Header.Set("X-Correlation-ID", "abc-123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "abc-123", upstreamID)
+	assert.Equal(t, "abc-123", w.Header().Get("X-Correlation-ID"))
+
+	// Generated IDs are also returned on upstream failures
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/down/items", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.NotEmpty(t, w.Header().Get("X-Correlation-ID"))
+}
+
+func TestProbeEndpoints(t *testing.T) {
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("probe requests should not be proxied")
+	}))
+	defer mockBackend.Close()
+
+	Version = "1.2.3"
+	t.Cleanup(func() { Version = "dev" })
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Server: config.ServerConfig{
+			Probes: config.ProbesConfig{Enabled: true, CheckUpstreams: true},
+		},
+		Endpoints: []config.Endpoint{
+			{Path: "/api", RemoteURL: mockBackend.URL},
+		},
+	})
+
+	tests := []struct {
+		path           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{path: "/healthz", expectedStatus: http.StatusOK, expectedBody: `"status":"ok"`},
+		{path: "/healthz/", expectedStatus: http.StatusOK, expectedBody: `"status":"ok"`},
+		{path: "/readyz", expectedStatus: http.StatusOK, expectedBody: `"checks":{"/api":"ok"}`},
+		{path: "/version", expectedStatus: http.StatusOK, expectedBody: `"version":"1.2.3"`},
+		{path: "/healthz/extra", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tt.expectedBody)
+		})
+	}
+
+	handler.BeginShutdown()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "shutting down")
+
+	// Liveness is unaffected by draining
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestProbeEndpointsConfiguration(t *testing.T) {
+	var proxied []string
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockBackend.Close()
+
+	endpoints := []config.Endpoint{
+		{Path: "/healthz", RemoteURL: mockBackend.URL},
+	}
+
+	// Probes are disabled by default, leaving their paths to configured endpoints
+	handler := NewDynamicRoutingHandler(config.Config{
+		Endpoints: endpoints,
+	})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, proxied, 1)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Custom paths are served instead of the default ones
+	handler = NewDynamicRoutingHandler(config.Config{
+		Server:    config.ServerConfig{Probes: config.ProbesConfig{Enabled: true, LivenessPath: "/live"}},
+		Endpoints: endpoints,
+	})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/live", nil))
+	assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, proxied, 2)
+}
+
+func TestReadinessWithHealthChecks(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	mockBackend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer mockBackend.Close()
+
+	handler := NewDynamicRoutingHandler(config.Config{
+		Server: config.ServerConfig{
+			Probes: config.ProbesConfig{Enabled: true, CheckUpstreams: true},
+		},
+		Endpoints: []config.Endpoint{{
+			Path:        "/api",
+			RemoteURL:   mockBackend.URL,
+			HealthCheck: &config.HealthCheckConfig{Interval: "10ms", UnhealthyThreshold: 1},
+		}},
+	})
+	defer handler.Close()
+
+	readiness := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, readiness())
+
+	healthy.Store(false)
+	assert.Eventually(t, func() bool { return readiness() == http.StatusServiceUnavailable }, time.Second, 5*time.Millisecond)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// Reloading without health checks stops them and forgets their state
+	require.NoError(t, handler.Reload(config.Config{
+		Endpoints: []config.Endpoint{{Path: "/api", RemoteURL: mockBackend.URL}},
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/items", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.NotContains(t, w.Body.String(), "upstream is unhealthy")
+}
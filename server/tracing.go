@@ -0,0 +1,71 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// SetupTracing installs the global OpenTelemetry tracer provider and W3C
+// Trace Context propagator described by cfg. It returns a function flushing
+// pending spans, to be called on shutdown.
+func SetupTracing(cfg config.TracingConfig, version string) func() {
+	disable := func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}
+	if !cfg.Enabled {
+		disable()
+		return func() {}
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.GetExporter() {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(cfg.GetEndpoint()))
+	}
+	if err != nil {
+		slog.Error("Failed to create trace exporter, tracing disabled", "exporter", cfg.GetExporter(), "error", err)
+		disable()
+		return func() {}
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(cfg.GetServiceName()),
+			semconv.ServiceVersion(version))),
+		// Requests carrying a trace context follow the caller's sampling decision
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.GetSampleRatio()))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	slog.Info("Tracing enabled",
+		"exporter", cfg.GetExporter(),
+		"endpoint", cfg.GetEndpoint(),
+		"sample_ratio", cfg.GetSampleRatio())
+
+	return func() {
+		disable()
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			slog.Warn("Failed to flush pending spans", "error", err)
+		}
+	}
+}
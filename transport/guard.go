@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"syscall"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// Address ranges blocked by default that are not covered by netip.Addr helpers.
+var (
+	thisNetwork     = netip.MustParsePrefix("0.0.0.0/8")
+	sharedAddresses = netip.MustParsePrefix("100.64.0.0/10")
+	broadcast       = netip.MustParseAddr("255.255.255.255")
+)
+
+// IPv6 ranges embedding an IPv4 address, which can be used to reach it.
+var (
+	nat64     = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour = netip.MustParsePrefix("2002::/16")
+)
+
+// BlockedError is returned when a request to a disallowed destination is attempted.
+type BlockedError struct {
+	Destination string
+	Reason      string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("destination %s is not allowed (%s)", e.Destination, e.Reason)
+}
+
+// Guard prevents connections to internal networks (SSRF protection).
+// It is enforced at dial time on the resolved IP address, so DNS rebinding
+// and redirects to internal hosts cannot bypass it.
+type Guard struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewGuard creates a guard blocking private, loopback, link-local, multicast and
+// unspecified addresses, with configured allow and deny ranges applied on top.
+func NewGuard(cfg config.ForwardConfig) (*Guard, error) {
+	guard := &Guard{}
+	for _, cidr := range cfg.AllowCIDRs {
+		prefix, err := config.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow range '%s': %w", cidr, err)
+		}
+		guard.allow = append(guard.allow, prefix)
+	}
+	for _, cidr := range cfg.DenyCIDRs {
+		prefix, err := config.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny range '%s': %w", cidr, err)
+		}
+		guard.deny = append(guard.deny, prefix)
+	}
+	return guard, nil
+}
+
+// Check returns a *BlockedError if connections to ip are not allowed.
+func (g *Guard) Check(ip netip.Addr) error {
+	ip = ip.Unmap()
+
+	for _, prefix := range g.deny {
+		if prefix.Contains(ip) {
+			return &BlockedError{Destination: ip.String(), Reason: "denied range " + prefix.String()}
+		}
+	}
+	for _, prefix := range g.allow {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	if reason := restrictedReason(ip); reason != "" {
+		return &BlockedError{Destination: ip.String(), Reason: reason}
+	}
+	if embedded, kind, ok := embeddedIPv4(ip); ok {
+		if err := g.Check(embedded); err != nil {
+			blocked := err.(*BlockedError)
+			return &BlockedError{Destination: ip.String(), Reason: blocked.Reason + " embedded in " + kind + " address"}
+		}
+	}
+	return nil
+}
+
+// Control is meant to be used as net.Dialer.Control, it runs right before
+// connecting with the resolved destination address.
+func (g *Guard) Control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if err := g.Check(ip); err != nil {
+		slog.Warn("Blocked connection to restricted address", "network", network, "address", address, "error", err)
+		return err
+	}
+	return nil
+}
+
+// restrictedReason describes why ip is blocked by default, or returns "" if it is public.
+func restrictedReason(ip netip.Addr) string {
+	switch {
+	case ip.IsUnspecified() || thisNetwork.Contains(ip):
+		return "unspecified address"
+	case ip.IsLoopback():
+		return "loopback address"
+	case ip.IsPrivate() || sharedAddresses.Contains(ip):
+		return "private address"
+	case ip.IsLinkLocalUnicast():
+		return "link-local address"
+	case ip.IsMulticast() || ip == broadcast:
+		return "multicast address"
+	}
+	return ""
+}
+
+// embeddedIPv4 returns the IPv4 address embedded in a NAT64 or 6to4 address,
+// along with the kind of address it was found in.
+func embeddedIPv4(ip netip.Addr) (netip.Addr, string, bool) {
+	b := ip.As16()
+	switch {
+	case nat64.Contains(ip):
+		return netip.AddrFrom4([4]byte(b[12:16])), "NAT64", true
+	case sixToFour.Contains(ip):
+		return netip.AddrFrom4([4]byte(b[2:6])), "6to4", true
+	}
+	return netip.Addr{}, "", false
+}
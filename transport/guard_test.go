@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestGuardCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		forward config.ForwardConfig
+		ip      string
+		blocked bool
+	}{
+		{name: "public IPv4", ip: "93.184.216.34", blocked: false},
+		{name: "public IPv6", ip: "2606:2800:220:1:248:1893:25c8:1946", blocked: false},
+		{name: "IPv4 loopback", ip: "127.0.0.1", blocked: true},
+		{name: "IPv6 loopback", ip: "::1", blocked: true},
+		{name: "RFC1918 10/8", ip: "10.1.2.3", blocked: true},
+		{name: "RFC1918 172.16/12", ip: "172.31.0.1", blocked: true},
+		{name: "RFC1918 192.168/16", ip: "192.168.1.1", blocked: true},
+		{name: "shared address space", ip: "100.64.0.1", blocked: true},
+		{name: "IPv6 unique local", ip: "fd00::1", blocked: true},
+		{name: "IPv4 link-local metadata", ip: "169.254.169.254", blocked: true},
+		{name: "IPv6 link-local", ip: "fe80::1", blocked: true},
+		{name: "IPv4 multicast", ip: "224.0.0.1", blocked: true},
+		{name: "IPv6 multicast", ip: "ff02::1", blocked: true},
+		{name: "broadcast", ip: "255.255.255.255", blocked: true},
+		{name: "IPv4 unspecified", ip: "0.0.0.0", blocked: true},
+		{name: "IPv6 unspecified", ip: "::", blocked: true},
+		{name: "IPv4-mapped loopback", ip: "::ffff:127.0.0.1", blocked: true},
+		{name: "NAT64 public", ip: "64:ff9b::5db8:d822", blocked: false},
+		{name: "NAT64 loopback", ip: "64:ff9b::7f00:1", blocked: true},
+		{name: "NAT64 metadata", ip: "64:ff9b::a9fe:a9fe", blocked: true},
+		{name: "6to4 public", ip: "2002:5db8:d822::1", blocked: false},
+		{name: "6to4 private", ip: "2002:c0a8:101::1", blocked: true},
+		{
+			name:    "NAT64 address in denied range",
+			forward: config.ForwardConfig{DenyCIDRs: []string{"93.184.216.0/24"}},
+			ip:      "64:ff9b::5db8:d822",
+			blocked: true,
+		},
+		{
+			name:    "NAT64 address in allowed range",
+			forward: config.ForwardConfig{AllowCIDRs: []string{"10.0.0.0/24"}},
+			ip:      "64:ff9b::a00:5",
+			blocked: false,
+		},
+		{
+			name:    "allowed private range",
+			forward: config.ForwardConfig{AllowCIDRs: []string{"10.0.0.0/24"}},
+			ip:      "10.0.0.5",
+			blocked: false,
+		},
+		{
+			name:    "private address outside allowed range",
+			forward: config.ForwardConfig{AllowCIDRs: []string{"10.0.0.0/24"}},
+			ip:      "10.0.1.5",
+			blocked: true,
+		},
+		{
+			name:    "denied public range",
+			forward: config.ForwardConfig{DenyCIDRs: []string{"93.184.216.0/24"}},
+			ip:      "93.184.216.34",
+			blocked: true,
+		},
+		{
+			name:    "deny takes precedence over allow",
+			forward: config.ForwardConfig{AllowCIDRs: []string{"0.0.0.0/0"}, DenyCIDRs: []string{"192.168.1.1"}},
+			ip:      "192.168.1.1",
+			blocked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard, err := NewGuard(tt.forward)
+			require.NoError(t, err)
+
+			err = guard.Check(netip.MustParseAddr(tt.ip))
+			if tt.blocked {
+				var blocked *BlockedError
+				assert.ErrorAs(t, err, &blocked)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGuardControl(t *testing.T) {
+	guard, err := NewGuard(config.ForwardConfig{})
+	require.NoError(t, err)
+
+	assert.Error(t, guard.Control("tcp4", "127.0.0.1:80", nil))
+	assert.Error(t, guard.Control("tcp6", "[fe80::1]:443", nil))
+	assert.NoError(t, guard.Control("tcp4", "93.184.216.34:443", nil))
+}
+
+func TestNewGuardInvalidRange(t *testing.T) {
+	_, err := NewGuard(config.ForwardConfig{AllowCIDRs: []string{"not-a-range"}})
+	assert.Error(t, err)
+}
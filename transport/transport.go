@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+// New builds an HTTP transport from configuration. Transports are meant to be
+// built once per upstream and shared by all requests so connections are pooled
+// and reused instead of being re-established on every request.
+// When guard is not nil, every connection is checked against it at dial time.
+func New(cfg config.TransportConfig, guard *Guard) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: cfg.GetDialTimeout(),
+	}
+	if cfg.KeepAliveEnabled() {
+		dialer.KeepAlive = config.DEFAULT_TCP_KEEP_ALIVE_INTERVAL
+	} else {
+		dialer.KeepAlive = -1
+	}
+
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          cfg.GetMaxIdleConns(),
+		MaxIdleConnsPerHost:   cfg.GetMaxIdleConnsPerHost(),
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.GetIdleConnTimeout(),
+		TLSHandshakeTimeout:   cfg.GetTLSHandshakeTimeout(),
+		ResponseHeaderTimeout: cfg.GetResponseHeaderTimeout(),
+		ExpectContinueTimeout: time.Second,
+		DisableKeepAlives:     !cfg.KeepAliveEnabled(),
+		ForceAttemptHTTP2:     cfg.HTTP2Enabled(),
+	}
+
+	if guard != nil {
+		dialer.Control = guard.Control
+		// An outbound proxy would connect to the destination on our behalf,
+		// bypassing the guard, so guarded transports always dial directly.
+		t.Proxy = nil
+	}
+
+	if !cfg.HTTP2Enabled() {
+		// A non-nil empty map disables the automatic HTTP/2 upgrade over TLS
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	slog.Debug("Created upstream transport",
+		"max_idle_conns", t.MaxIdleConns,
+		"max_idle_conns_per_host", t.MaxIdleConnsPerHost,
+		"max_conns_per_host", t.MaxConnsPerHost,
+		"idle_conn_timeout", t.IdleConnTimeout,
+		"keep_alive", !t.DisableKeepAlives,
+		"http2", t.ForceAttemptHTTP2)
+
+	return t
+}
@@ -0,0 +1,95 @@
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bastienwirtz/corsair/config"
+)
+
+func TestNew(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name   string
+		config config.TransportConfig
+		check  func(t *testing.T, tr *http.Transport)
+	}{
+		{
+			name:   "defaults",
+			config: config.TransportConfig{},
+			check: func(t *testing.T, tr *http.Transport) {
+				assert.Equal(t, config.DEFAULT_MAX_IDLE_CONNS, tr.MaxIdleConns)
+				assert.Equal(t, config.DEFAULT_MAX_IDLE_CONNS, tr.MaxIdleConnsPerHost)
+				assert.Equal(t, 0, tr.MaxConnsPerHost)
+				assert.Equal(t, config.DEFAULT_IDLE_CONN_TIMEOUT, tr.IdleConnTimeout)
+				assert.Equal(t, config.DEFAULT_TLS_HANDSHAKE_TIMEOUT, tr.TLSHandshakeTimeout)
+				assert.False(t, tr.DisableKeepAlives)
+				assert.True(t, tr.ForceAttemptHTTP2)
+				assert.Nil(t, tr.TLSNextProto)
+			},
+		},
+		{
+			name: "custom pool and timeouts",
+			config: config.TransportConfig{
+				MaxIdleConns:          50,
+				MaxIdleConnsPerHost:   10,
+				MaxConnsPerHost:       20,
+				IdleConnTimeout:       "30s",
+				TLSHandshakeTimeout:   "5s",
+				ResponseHeaderTimeout: "2s",
+			},
+			check: func(t *testing.T, tr *http.Transport) {
+				assert.Equal(t, 50, tr.MaxIdleConns)
+				assert.Equal(t, 10, tr.MaxIdleConnsPerHost)
+				assert.Equal(t, 20, tr.MaxConnsPerHost)
+				assert.Equal(t, 30*time.Second, tr.IdleConnTimeout)
+				assert.Equal(t, 5*time.Second, tr.TLSHandshakeTimeout)
+				assert.Equal(t, 2*time.Second, tr.ResponseHeaderTimeout)
+			},
+		},
+		{
+			name: "keep-alive and HTTP/2 disabled",
+			config: config.TransportConfig{
+				KeepAlive: &disabled,
+				HTTP2:     &disabled,
+			},
+			check: func(t *testing.T, tr *http.Transport) {
+				assert.True(t, tr.DisableKeepAlives)
+				assert.False(t, tr.ForceAttemptHTTP2)
+				assert.NotNil(t, tr.TLSNextProto)
+				assert.Empty(t, tr.TLSNextProto)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, New(tt.config, nil))
+		})
+	}
+}
+
+func TestNewReusesConnections(t *testing.T) {
+	var remoteAddrs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddrs = append(remoteAddrs, r.RemoteAddr)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: New(config.TransportConfig{}, nil)}
+	for range 3 {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Len(t, remoteAddrs, 3)
+	assert.Equal(t, remoteAddrs[0], remoteAddrs[1])
+	assert.Equal(t, remoteAddrs[0], remoteAddrs[2])
+}